@@ -1,9 +1,45 @@
 package ast
 
+import "reflect"
+
 type Stmt interface {
 	stmt()
 }
 
+// Pos records the source lines a statement starts and ends on. Statements
+// embed it; the parser fills it in, the compiler turns Line into the
+// artifact's line table and the formatter uses both to place comments.
+type Pos struct {
+	Line int
+	End  int
+}
+
+func (p Pos) Position() Pos {
+	return p
+}
+
+// Positioned is implemented by statements that embed Pos.
+type Positioned interface {
+	Position() Pos
+}
+
+// WithPos returns a copy of stmt with its Pos set to pos. Statements that
+// do not embed Pos are returned unchanged.
+func WithPos(stmt Stmt, pos Pos) Stmt {
+	v := reflect.ValueOf(stmt)
+	if v.Kind() != reflect.Struct {
+		return stmt
+	}
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	field := copied.FieldByName("Pos")
+	if !field.IsValid() {
+		return stmt
+	}
+	field.Set(reflect.ValueOf(pos))
+	return copied.Interface().(Stmt)
+}
+
 type Expr interface {
 	expr()
 }
@@ -5,6 +5,10 @@ import "github.com/peiblow/vvm/lexer"
 // Literals Expressions
 type NumberExpr struct {
 	Value float64
+	// Literal keeps the source text of hex literals (e.g. "0xABC"). Hex
+	// literals denote addresses, so they evaluate to this text rather than
+	// to Value. Empty for decimal literals.
+	Literal string
 }
 
 func (n NumberExpr) expr() {}
@@ -68,7 +72,10 @@ type AssignmentExpr struct {
 func (n AssignmentExpr) expr() {}
 
 type ArrayLiteralExpr struct {
-	Items []Expr
+	Items     []Expr
+	ItemLines []int // linha de início de cada item
+	Line      int   // linha do '['
+	End       int   // linha do ']'
 }
 
 func (n ArrayLiteralExpr) expr() {}
@@ -83,6 +90,7 @@ func (n ArrayAccessItemExpr) expr() {}
 type ObjectPropertyExpr struct {
 	Key   Expr
 	Value Expr
+	Line  int // linha da chave
 }
 
 func (n ObjectPropertyExpr) expr() {}
@@ -90,6 +98,8 @@ func (n ObjectPropertyExpr) expr() {}
 type ObjectAssignmentExpr struct {
 	Name   Expr
 	Fields []ObjectPropertyExpr
+	Line   int // linha do '{'
+	End    int // linha do '}'
 }
 
 func (n ObjectAssignmentExpr) expr() {}
@@ -0,0 +1,83 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ExprString renders an expression back to Synx source. Nested binary
+// expressions are parenthesized, so the text is unambiguous but may carry
+// more parentheses than the original.
+func ExprString(expr Expr) string {
+	switch e := expr.(type) {
+	case nil:
+		return ""
+	case NumberExpr:
+		if e.Literal != "" {
+			return e.Literal
+		}
+		return strconv.FormatFloat(e.Value, 'f', -1, 64)
+	case StringExpr:
+		return strconv.Quote(e.Value)
+	case SymbolExpr:
+		return e.Value
+	case ThisExpr:
+		return "this"
+	case BooleanLiteralExpr:
+		return strconv.FormatBool(e.Value)
+	case NullExpr:
+		return "null"
+	case BinaryExpr:
+		return operand(e.Left) + " " + e.Operator.Literal + " " + operand(e.Right)
+	case PrefixExpr:
+		return e.Operator.Literal + operand(e.RightExpr)
+	case IncDecExpr:
+		return ExprString(e.Left) + e.Operator.Literal
+	case AssignmentExpr:
+		return ExprString(e.Left) + " " + e.Operator.Literal + " " + ExprString(e.Right)
+	case ArrayLiteralExpr:
+		return "[" + exprList(e.Items) + "]"
+	case ArrayAccessItemExpr:
+		return ExprString(e.Array) + "[" + ExprString(e.Index) + "]"
+	case ObjectAssignmentExpr:
+		if len(e.Fields) == 0 {
+			return "{}"
+		}
+		fields := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			fields[i] = ExprString(f.Key) + ": " + ExprString(f.Value)
+		}
+		return "{ " + strings.Join(fields, ", ") + " }"
+	case CallExpr:
+		return ExprString(e.Calle) + "(" + exprList(e.Arguments) + ")"
+	case MemberExpr:
+		return ExprString(e.Object) + "." + ExprString(e.Property)
+	case GetEnvExpr:
+		return "getEnv(" + ExprString(e.VariableName) + ")"
+	case NonceExpr:
+		return "nonce(" + ExprString(e.Size) + ")"
+	case HashExpr:
+		return "hash(" + exprList(append([]Expr{e.HashType}, e.Data...)) + ")"
+	case ErrorExpr:
+		return "Error(" + ExprString(e.Code) + ", " + ExprString(e.Message) + ")"
+	case ExpressionStmt:
+		return ExprString(e.Expression)
+	}
+	return ""
+}
+
+func operand(expr Expr) string {
+	switch expr.(type) {
+	case BinaryExpr, AssignmentExpr:
+		return "(" + ExprString(expr) + ")"
+	}
+	return ExprString(expr)
+}
+
+func exprList(exprs []Expr) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = ExprString(e)
+	}
+	return strings.Join(parts, ", ")
+}
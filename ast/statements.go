@@ -7,6 +7,7 @@ type BlockStmt struct {
 func (n BlockStmt) stmt() {}
 
 type ContractStmt struct {
+	Pos
 	Identifier string
 	Body       []Stmt
 }
@@ -14,12 +15,14 @@ type ContractStmt struct {
 func (n ContractStmt) stmt() {}
 
 type ExpressionStmt struct {
+	Pos
 	Expression Expr
 }
 
 func (n ExpressionStmt) stmt() {}
 
 type VarDeclStmt struct {
+	Pos
 	Identifier    string
 	Constant      bool
 	AssignedValue Expr
@@ -29,14 +32,17 @@ type VarDeclStmt struct {
 func (n VarDeclStmt) stmt() {}
 
 type IfStmt struct {
+	Pos
 	Condition Expr
 	Then      Stmt
 	Else      Stmt
+	ElseLine  int // line of the else keyword, 0 without an else branch
 }
 
 func (n IfStmt) stmt() {}
 
 type WhileStmt struct {
+	Pos
 	Condition Expr
 	Body      []Stmt
 }
@@ -44,6 +50,7 @@ type WhileStmt struct {
 func (n WhileStmt) stmt() {}
 
 type ForStmt struct {
+	Pos
 	Init      Stmt
 	Condition Expr
 	Post      Stmt
@@ -52,7 +59,34 @@ type ForStmt struct {
 
 func (n ForStmt) stmt() {}
 
+// ForEachStmt iterates over an array or object. With a single variable the
+// loop binds each element (arrays) or each key (objects) to Value; with two
+// variables Key receives the index or key and Value the element.
+type ForEachStmt struct {
+	Pos
+	Key      string
+	Value    string
+	Iterable Expr
+	Body     []Stmt
+}
+
+func (n ForEachStmt) stmt() {}
+
+type BreakStmt struct {
+	Pos
+}
+
+func (n BreakStmt) stmt() {}
+
+type ContinueStmt struct {
+	Pos
+}
+
+func (n ContinueStmt) stmt() {}
+
 type FuncStmt struct {
+	Pos
+	Doc        string // the /// comment above the declaration
 	Name       Expr
 	Arguments  []ArgsStmt
 	Body       Stmt
@@ -62,11 +96,13 @@ type FuncStmt struct {
 type ArgsStmt struct {
 	ArgName Expr
 	ArgType Expr
+	Line    int
 }
 
 func (n FuncStmt) stmt() {}
 
 type ArrayItemAssignmentStmt struct {
+	Pos
 	Name  Expr
 	Index Expr
 	Value Expr
@@ -75,43 +111,130 @@ type ArrayItemAssignmentStmt struct {
 func (n ArrayItemAssignmentStmt) stmt() {}
 
 type ReturnStmt struct {
+	Pos
 	Value Expr
 }
 
 func (n ReturnStmt) stmt() {}
 
+// RequireStmt aborts the call when Condition is false. Code and Details
+// are optional: `require(cond; "CODE", "message", {details})`.
 type RequireStmt struct {
+	Pos
 	Condition Expr
+	Code      Expr
 	Message   Expr
+	Details   Expr
 }
 
 func (n RequireStmt) stmt() {}
 
+// CheckStmt is a soft require: a failing check is recorded and execution
+// continues, and the call fails at the end with every failed check.
+type CheckStmt struct {
+	Pos
+	Condition Expr
+	Code      Expr
+	Message   Expr
+	Details   Expr
+}
+
+func (n CheckStmt) stmt() {}
+
+// MetadataField is one `key: value` entry of an agent or registry block,
+// kept in source order.
+type MetadataField struct {
+	Key   string
+	Value Expr
+	Line  int
+}
+
+func lookupField(fields []MetadataField, key string) Expr {
+	for _, f := range fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
 type AgentStmt struct {
+	Pos
 	Identifier Expr
-	Hash       Expr
-	Version    Expr
-	Owner      Expr
-	Purpose    Expr
+	Fields     []MetadataField
 }
 
 func (n AgentStmt) stmt() {}
 
+// Field returns the value declared for key, or nil if the agent omits it.
+func (n AgentStmt) Field(key string) Expr {
+	return lookupField(n.Fields, key)
+}
+
+// RegistryStmt declares an entry of the model/dataset/tool registry that
+// agents are validated against: `registry Model Name { ... }`.
+type RegistryStmt struct {
+	Pos
+	Kind       string
+	Identifier Expr
+	Fields     []MetadataField
+}
+
+func (n RegistryStmt) stmt() {}
+
+// Field returns the value declared for key, or nil if the entry omits it.
+func (n RegistryStmt) Field(key string) Expr {
+	return lookupField(n.Fields, key)
+}
+
+// PolicyRule is one `key: value` entry of a policy, kept in source order.
+// Param marks a rule written `key: param value`, whose value may be
+// overridden at deploy time.
+type PolicyRule struct {
+	Key   string
+	Value Expr
+	Param bool
+	Line  int
+}
+
 type PolicyStmt struct {
+	Pos
+	Doc        string // the /// comment above the declaration
 	Identifier Expr
-	Rules      map[string]Expr
+	Rules      []PolicyRule
 }
 
 func (n PolicyStmt) stmt() {}
 
+// TypeField is one `name: Type` entry of a type declaration, kept in source order.
+type TypeField struct {
+	Name string
+	Type Expr
+	Line int
+}
+
 type TypeDeclareStmt struct {
+	Pos
+	Doc    string // the /// comment above the declaration
 	Name   Expr
-	Fields map[string]Expr
+	Fields []TypeField
 }
 
 func (n TypeDeclareStmt) stmt() {}
 
+// ErrorDeclStmt declares a typed error, `error Name { field: Type }`. It is
+// raised by calling it like a function with one argument per field (and
+// optionally a message), and caught with `catch (e: Name)`.
+type ErrorDeclStmt struct {
+	Pos
+	Name   string
+	Fields []TypeField
+}
+
+func (n ErrorDeclStmt) stmt() {}
+
 type EmitStmt struct {
+	Pos
 	EventName Expr
 	Arguments Expr
 }
@@ -119,15 +242,67 @@ type EmitStmt struct {
 func (n EmitStmt) stmt() {}
 
 type GetEnvStmt struct {
+	Pos
 	VariableName Expr
 }
 
 func (n GetEnvStmt) stmt() {}
 
+// CatchClause handles errors raised in a try block. A clause with a Type
+// only handles errors of that declared error type.
+type CatchClause struct {
+	Pos
+	Var  string
+	Type string
+	Body []Stmt
+}
+
 type TryCatchStmt struct {
-	TryBlock   []Stmt
-	CatchVar   string
-	CatchBlock []Stmt
+	Pos
+	TryBlock []Stmt
+	Catches  []CatchClause
 }
 
 func (n TryCatchStmt) stmt() {}
+
+// TestStmt is a `test "name" { ... }` block. Tests are compiled only for
+// the test runner, each as a function with no arguments run on a fresh
+// deployment of the contract.
+type TestStmt struct {
+	Pos
+	Name string
+	Body []Stmt
+}
+
+func (n TestStmt) stmt() {}
+
+// ExpectStmt fails the test when Condition is false: `expect(cond)` or
+// `expect(cond; "message")`.
+type ExpectStmt struct {
+	Pos
+	Condition Expr
+	Message   Expr
+}
+
+func (n ExpectStmt) stmt() {}
+
+// ExpectRevertStmt fails the test unless Body raises an error with the
+// given code: `expectRevert("CODE") { ... }`.
+type ExpectRevertStmt struct {
+	Pos
+	Code Expr
+	Body []Stmt
+}
+
+func (n ExpectRevertStmt) stmt() {}
+
+// ExpectEmitStmt fails the test unless an event named EventName has been
+// emitted whose payload contains every field of Payload (nil matches any
+// payload): `expectEmit("Approved", { amount: 100 })`.
+type ExpectEmitStmt struct {
+	Pos
+	EventName Expr
+	Payload   Expr
+}
+
+func (n ExpectEmitStmt) stmt() {}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/peiblow/vvm/vm"
+)
+
+func runABI(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("abi", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	function := fs.String("function", "", "print only this function's entry")
+	schema := fs.Bool("schema", false, "print only the JSON Schema of the function's arguments (requires --function)")
+	strict := fs.Bool("strict", false, "forbid non-deterministic natives")
+	params := paramFlags{}
+	fs.Var(params, "param", "override a param policy rule, as Policy.rule=value (repeatable)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 || (*schema && *function == "") {
+		fmt.Fprintln(stderr, "usage: synx abi [--function FN [--schema]] [--strict] [--param Policy.rule=value ...] <contract.snx | artifact.json>")
+		return 2
+	}
+
+	artifact, err := loadArtifact(positional[0], vm.BuildOptions{Strict: *strict, Params: params})
+	if err != nil {
+		fmt.Fprintf(stderr, "abi: %v\n", err)
+		return 1
+	}
+
+	abi := artifact.ABI()
+	var out interface{} = abi
+	if *function != "" {
+		fn, ok := abi.Functions[*function]
+		if !ok {
+			fmt.Fprintf(stderr, "abi: function '%s' not found in contract\n", *function)
+			return 1
+		}
+		out = fn
+		if *schema {
+			out = fn.Input
+		}
+	}
+
+	encoded, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "abi: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, string(encoded))
+	return 0
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/peiblow/vvm/compiler"
+	"github.com/peiblow/vvm/vm"
+)
+
+func runBuild(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	out := fs.String("o", "", "write the artifact to this path (default: <source>.json)")
+	verify := fs.Bool("verify", false, "compile twice and fail unless the artifacts are byte-identical")
+	strict := fs.Bool("strict", false, "forbid non-deterministic natives")
+	params := paramFlags{}
+	fs.Var(params, "param", "override a param policy rule, as Policy.rule=value (repeatable)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(stderr, "usage: synx build [-o artifact.json] [--verify] [--strict] [--param Policy.rule=value ...] <contract.snx>")
+		return 2
+	}
+
+	srcPath := positional[0]
+	src, err := os.ReadFile(srcPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "build: %v\n", err)
+		return 1
+	}
+
+	first, err := buildArtifact(src, vm.BuildOptions{Strict: *strict, Params: params})
+	if err != nil {
+		fmt.Fprintf(stderr, "build: %v\n", err)
+		return 1
+	}
+
+	if *verify {
+		second, err := buildArtifact(src, vm.BuildOptions{Strict: *strict, Params: params})
+		if err != nil {
+			fmt.Fprintf(stderr, "build: second compilation failed: %v\n", err)
+			return 1
+		}
+		if !bytes.Equal(first, second) {
+			fmt.Fprintf(stderr, "build: artifacts differ between compilations (first difference at byte %d)\n",
+				firstDifference(first, second))
+			return 1
+		}
+	}
+
+	dest := *out
+	if dest == "" {
+		dest = strings.TrimSuffix(srcPath, ".snx") + ".json"
+	}
+	if err := os.WriteFile(dest, first, 0o644); err != nil {
+		fmt.Fprintf(stderr, "build: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "wrote %s (sha256 %s)\n", dest, compiler.DigestBytes(first))
+	if *verify {
+		fmt.Fprintln(stdout, "verified: recompilation is byte-identical")
+	}
+	return 0
+}
+
+// buildArtifact compiles src on a fresh runtime and returns the artifact's
+// JSON encoding.
+func buildArtifact(src []byte, opts vm.BuildOptions) (encoded []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	artifact, err := vm.NewRuntime().Build(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(artifact)
+}
+
+func firstDifference(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// paramFlags collects repeated --param Policy.rule=value flags. Values are
+// parsed as JSON, so numbers, booleans and arrays keep their type; anything
+// that is not valid JSON is taken as a plain string.
+type paramFlags map[string]interface{}
+
+func (p paramFlags) String() string {
+	return ""
+}
+
+func (p paramFlags) Set(s string) error {
+	key, raw, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected Policy.rule=value, got %q", s)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+	p[key] = value
+	return nil
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/peiblow/vvm/vm"
+)
+
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	strict := fs.Bool("strict", false, "forbid non-deterministic natives")
+	paths, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(stderr, "usage: synx check [--strict] <contract.snx> ...")
+		return 2
+	}
+
+	code := 0
+	for _, path := range paths {
+		if err := checkFile(path, vm.BuildOptions{Strict: *strict}); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			code = 1
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: ok\n", path)
+	}
+	return code
+}
+
+// checkFile lexes, parses and analyzes one contract source.
+func checkFile(path string, opts vm.BuildOptions) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = vm.NewRuntime().Check(src, opts)
+	return err
+}
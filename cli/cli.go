@@ -0,0 +1,84 @@
+// Package cli implements the synx command-line tool: subcommands that work
+// on contract sources and artifacts directly, plus the wire protocol server.
+//
+// Every subcommand returns the process exit code: 0 on success, 1 when the
+// contract is invalid or the call fails, and 2 for usage errors.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/peiblow/vvm/vm"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{name: "check", summary: "lex, parse and analyze contracts without compiling them", run: runCheck},
+	{name: "build", summary: "compile a contract to an artifact (--verify checks reproducibility)", run: runBuild},
+	{name: "compile", summary: "alias for build", run: runBuild},
+	{name: "test", summary: "run the test blocks of contracts (text, TAP or JUnit output)", run: runTest},
+	{name: "run", summary: "deploy a contract in-process and execute one function", run: runRun},
+	{name: "debug", summary: "step through a function call in an interactive debugger", run: runDebug},
+	{name: "repl", summary: "evaluate statements and expressions against a contract interactively", run: runREPL},
+	{name: "fmt", summary: "format contract sources (--check lists unformatted files)", run: runFmt},
+	{name: "disasm", summary: "disassemble an artifact (or a contract source)", run: runDisasm},
+	{name: "abi", summary: "print a contract's ABI with a JSON Schema for each argument", run: runABI},
+	{name: "lsp", summary: "start a language server on stdin/stdout", run: runLSP},
+	{name: "serve", summary: "start the wire protocol server", run: runServe},
+}
+
+// Run executes the subcommand named by args[0] and returns the process exit
+// code.
+func Run(args []string) int {
+	return run(args, os.Stdout, os.Stderr)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	vm.Output = stderr
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: synx <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+}
+
+// parseArgs parses fs's flags wherever they appear among args, so that
+// `synx run contract.snx approve --args a.json` works as well as putting the
+// flags first, and returns the positional arguments in order.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
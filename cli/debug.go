@@ -0,0 +1,310 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peiblow/vvm/compiler"
+	"github.com/peiblow/vvm/vm"
+)
+
+const debugHelp = `commands:
+  s, step          run to the next statement, entering calls
+  n, next          run to the next statement, stepping over calls
+  o, out           run until the current function returns
+  si, stepi        execute one instruction
+  c, continue      run until a breakpoint or the end of the call
+  b, break LINE    set a breakpoint on a source line (@PC for an address)
+  clear PC         remove the breakpoint at PC
+  bt, where        show the call stack
+  stack            show the operand stack
+  p, print NAME    show a variable's storage value
+  vars             show every named variable
+  try              show the active try blocks
+  l, list          show the source around the current line
+  q, quit          stop debugging`
+
+func runDebug(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	argsPath := fs.String("args", "", "JSON file with the call's arguments, keyed by name (- reads stdin)")
+	timestamp := fs.Int64("timestamp", 0, "evaluate the call at this Unix time (default: now)")
+	params := paramFlags{}
+	fs.Var(params, "param", "override a param policy rule, as Policy.rule=value (repeatable)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fmt.Fprintln(stderr, "usage: synx debug [--args args.json] [--timestamp unix] [--param Policy.rule=value ...] <contract.snx> <function>")
+		return 2
+	}
+	srcPath, function := positional[0], positional[1]
+
+	src, err := os.ReadFile(srcPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "debug: %v\n", err)
+		return 1
+	}
+	callArgs, err := readCallArgs(*argsPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "debug: %v\n", err)
+		return 1
+	}
+	encoded, err := buildArtifact(src, vm.BuildOptions{Params: params})
+	if err != nil {
+		fmt.Fprintf(stderr, "debug: %v\n", err)
+		return 1
+	}
+	// Decode the artifact the way EXEC does, so values have the same types.
+	var artifact compiler.ContractArtifact
+	if err := json.Unmarshal(encoded, &artifact); err != nil {
+		fmt.Fprintf(stderr, "debug: %v\n", err)
+		return 1
+	}
+	meta, ok := artifact.Functions[function]
+	if !ok {
+		fmt.Fprintf(stderr, "debug: function '%s' not found in contract\n", function)
+		return 1
+	}
+	ordered := make([]interface{}, 0, len(meta.ArgMeta))
+	for _, arg := range meta.ArgMeta {
+		val, ok := callArgs[arg.Name]
+		if !ok {
+			fmt.Fprintf(stderr, "debug: missing argument '%s' for function '%s'\n", arg.Name, function)
+			return 1
+		}
+		ordered = append(ordered, val)
+	}
+
+	at := time.Now()
+	if *timestamp != 0 {
+		at = time.Unix(*timestamp, 0)
+	}
+	machine := vm.NewFromArtifact(&artifact).UseNatives(vm.NewNatives())
+	if err := machine.ActivatePolicies(at); err != nil {
+		fmt.Fprintf(stderr, "debug: %v\n", err)
+		return 1
+	}
+	d, err := machine.Debug(function, ordered...)
+	if err != nil {
+		fmt.Fprintf(stderr, "debug: %v\n", err)
+		return 1
+	}
+
+	session := &debugSession{d: d, source: strings.Split(string(src), "\n"), out: stdout}
+	session.run(os.Stdin)
+	return 0
+}
+
+// readCallArgs reads a call's named arguments from a JSON file; an empty
+// path means no arguments.
+func readCallArgs(path string) (map[string]interface{}, error) {
+	callArgs := map[string]interface{}{}
+	if path == "" {
+		return callArgs, nil
+	}
+	raw, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &callArgs); err != nil {
+		return nil, fmt.Errorf("invalid arguments in %s: %v", path, err)
+	}
+	return callArgs, nil
+}
+
+type debugSession struct {
+	d      *vm.Debugger
+	source []string
+	out    io.Writer
+}
+
+func (s *debugSession) run(in io.Reader) {
+	s.where()
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(s.out, "(synx) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if quit := s.command(fields[0], fields[1:]); quit {
+			return
+		}
+	}
+}
+
+// command runs one debugger command and reports whether to quit.
+func (s *debugSession) command(name string, args []string) bool {
+	switch name {
+	case "s", "step":
+		s.resume(s.d.StepInto)
+	case "n", "next":
+		s.resume(s.d.StepOver)
+	case "o", "out":
+		s.resume(s.d.StepOut)
+	case "si", "stepi":
+		s.resume(s.d.StepInstruction)
+	case "c", "continue":
+		s.resume(s.d.Continue)
+	case "b", "break":
+		s.setBreakpoint(args)
+	case "clear":
+		if pc, err := singleInt(args); err != nil {
+			fmt.Fprintln(s.out, err)
+		} else {
+			s.d.Clear(pc)
+		}
+	case "bt", "where":
+		for _, frame := range s.d.CallStack() {
+			fmt.Fprintf(s.out, "  %s  line %d  pc %04d\n", frame.Function, frame.Line, frame.PC)
+		}
+	case "stack":
+		stack := s.d.Stack()
+		if len(stack) == 0 {
+			fmt.Fprintln(s.out, "  (empty)")
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			fmt.Fprintf(s.out, "  [%d] %s\n", i, formatValue(stack[i]))
+		}
+	case "p", "print":
+		if len(args) != 1 {
+			fmt.Fprintln(s.out, "usage: print NAME")
+			break
+		}
+		if val, ok := s.d.Lookup(args[0]); ok {
+			fmt.Fprintf(s.out, "  %s = %s\n", args[0], formatValue(val))
+		} else {
+			fmt.Fprintf(s.out, "no variable named %q\n", args[0])
+		}
+	case "vars":
+		for _, sym := range s.d.Symbols() {
+			val, _ := s.d.Lookup(sym)
+			fmt.Fprintf(s.out, "  %s = %s\n", sym, formatValue(val))
+		}
+	case "try":
+		for _, t := range s.d.TryStack() {
+			fmt.Fprintf(s.out, "  handler %04d  error slot %d  call depth %d\n", t.Handler, t.ErrorSlot, t.CallDepth)
+		}
+	case "l", "list":
+		s.list()
+	case "h", "help":
+		fmt.Fprintln(s.out, debugHelp)
+	case "q", "quit":
+		return true
+	default:
+		fmt.Fprintf(s.out, "unknown command %q (try help)\n", name)
+	}
+	return false
+}
+
+func (s *debugSession) resume(step func()) {
+	if s.d.Done() {
+		fmt.Fprintln(s.out, "the call has finished")
+		return
+	}
+	step()
+	if s.d.Done() {
+		result := s.d.Result()
+		out := runOutput{Success: result.Success, Error: result.Error}
+		if result.Success {
+			out.Data = map[string]interface{}{
+				"value":    result.Value,
+				"journal":  result.Journal,
+				"decision": result.Decision,
+			}
+		}
+		encoded, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Fprintf(s.out, "finished:\n%s\n", encoded)
+		return
+	}
+	s.where()
+}
+
+func (s *debugSession) setBreakpoint(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(s.out, "usage: break LINE | break @PC")
+		return
+	}
+	if strings.HasPrefix(args[0], "@") {
+		pc, err := strconv.Atoi(args[0][1:])
+		if err == nil {
+			err = s.d.Break(pc)
+		}
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			return
+		}
+		fmt.Fprintf(s.out, "breakpoint at pc %04d\n", pc)
+		return
+	}
+	line, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(s.out, "invalid line %q\n", args[0])
+		return
+	}
+	pc, err := s.d.BreakLine(line)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	fmt.Fprintf(s.out, "breakpoint at line %d (pc %04d)\n", line, pc)
+}
+
+// where prints the current position and its source line.
+func (s *debugSession) where() {
+	frame := s.d.CallStack()[0]
+	fmt.Fprintf(s.out, "%s  line %d  pc %04d  %s\n", frame.Function, frame.Line, frame.PC, s.d.Instruction())
+	if text, ok := s.sourceLine(frame.Line); ok {
+		fmt.Fprintf(s.out, "  %4d | %s\n", frame.Line, text)
+	}
+}
+
+func (s *debugSession) list() {
+	current := s.d.Line()
+	for line := current - 3; line <= current+3; line++ {
+		text, ok := s.sourceLine(line)
+		if !ok {
+			continue
+		}
+		marker := " "
+		if line == current {
+			marker = ">"
+		}
+		fmt.Fprintf(s.out, "%s %4d | %s\n", marker, line, text)
+	}
+}
+
+func (s *debugSession) sourceLine(line int) (string, bool) {
+	if line < 1 || line > len(s.source) {
+		return "", false
+	}
+	return strings.TrimRight(s.source[line-1], "\r"), true
+}
+
+func singleInt(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected one number")
+	}
+	return strconv.Atoi(strings.TrimPrefix(args[0], "@"))
+}
+
+func formatValue(v interface{}) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/peiblow/vvm/compiler"
+	"github.com/peiblow/vvm/vm"
+)
+
+func runDisasm(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(stderr, "usage: synx disasm <artifact.json | contract.snx>")
+		return 2
+	}
+
+	artifact, err := loadArtifact(positional[0], vm.BuildOptions{})
+	if err != nil {
+		fmt.Fprintf(stderr, "disasm: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprint(stdout, disassemble(artifact))
+	return 0
+}
+
+// loadArtifact reads a compiled artifact, or compiles path with opts first
+// when it is a contract source.
+func loadArtifact(path string, opts vm.BuildOptions) (*compiler.ContractArtifact, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".snx") {
+		raw, err = buildArtifact(raw, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var artifact compiler.ContractArtifact
+	if err := json.Unmarshal(raw, &artifact); err != nil {
+		return nil, fmt.Errorf("%s is not a contract artifact: %v", path, err)
+	}
+	return &artifact, nil
+}
+
+// disassemble lists an artifact's functions, constant pool and bytecode.
+func disassemble(artifact *compiler.ContractArtifact) string {
+	var b strings.Builder
+
+	names := make([]string, 0, len(artifact.Functions))
+	for name := range artifact.Functions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return artifact.Functions[names[i]].Addr < artifact.Functions[names[j]].Addr
+	})
+
+	b.WriteString("functions:\n")
+	for _, name := range names {
+		meta := artifact.Functions[name]
+		argNames := make([]string, len(meta.ArgMeta))
+		for i, arg := range meta.ArgMeta {
+			argNames[i] = arg.Name + ": " + arg.TypeName
+		}
+		fmt.Fprintf(&b, "  %04d %s(%s)", meta.Addr, name, strings.Join(argNames, ", "))
+		if meta.ReturnType != "" {
+			fmt.Fprintf(&b, ": %s", meta.ReturnType)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\nconst pool:\n")
+	for i, val := range artifact.ConstPool {
+		encoded, _ := json.Marshal(val)
+		fmt.Fprintf(&b, "  [%d] %s\n", i, encoded)
+	}
+
+	b.WriteString("\ncode:\n")
+	c := &compiler.Compiler{
+		Code:         artifact.Bytecode,
+		ConstPool:    artifact.ConstPool,
+		FunctionName: artifact.FunctionName,
+		Symbols:      artifact.Symbols,
+	}
+	b.WriteString(c.Disassemble())
+	return b.String()
+}
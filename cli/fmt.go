@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/peiblow/vvm/format"
+)
+
+func runFmt(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the source files instead of stdout")
+	check := flags.Bool("check", false, "list files whose formatting differs and exit 1 if there are any")
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return 2
+	}
+	if *write && *check {
+		fmt.Fprintln(stderr, "usage: synx fmt [-w | --check] [<contract.snx | dir> ...]")
+		return 2
+	}
+
+	if len(paths) == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "fmt: %v\n", err)
+			return 1
+		}
+		out, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(stderr, "<stdin>: %v\n", err)
+			return 1
+		}
+		if *check {
+			if !bytes.Equal(src, out) {
+				fmt.Fprintln(stdout, "<stdin>")
+				return 1
+			}
+			return 0
+		}
+		stdout.Write(out)
+		return 0
+	}
+
+	files, err := findSources(paths)
+	if err != nil {
+		fmt.Fprintf(stderr, "fmt: %v\n", err)
+		return 1
+	}
+
+	code := 0
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "fmt: %v\n", err)
+			code = 1
+			continue
+		}
+		out, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			code = 1
+			continue
+		}
+
+		switch {
+		case *check:
+			if !bytes.Equal(src, out) {
+				fmt.Fprintln(stdout, path)
+				code = 1
+			}
+		case *write:
+			if bytes.Equal(src, out) {
+				continue
+			}
+			if err := os.WriteFile(path, out, 0o644); err != nil {
+				fmt.Fprintf(stderr, "fmt: %v\n", err)
+				code = 1
+			}
+		default:
+			stdout.Write(out)
+		}
+	}
+	return code
+}
+
+// findSources resolves paths to .snx files, walking directories
+// recursively.
+func findSources(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(p, ".snx") {
+				files = append(files, p)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/peiblow/vvm/lsp"
+	"github.com/peiblow/vvm/parser"
+)
+
+func runLSP(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 0 {
+		fmt.Fprintln(stderr, "usage: synx lsp")
+		return 2
+	}
+
+	if err := lsp.Serve(os.Stdin, stdout, parser.Options{}); err != nil {
+		fmt.Fprintf(stderr, "lsp: %v\n", err)
+		return 1
+	}
+	return 0
+}
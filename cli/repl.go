@@ -0,0 +1,277 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peiblow/vvm/compiler"
+	"github.com/peiblow/vvm/vm"
+)
+
+const replHelp = `Type Synx statements or expressions; an expression's value is printed.
+Input continues over several lines until its brackets are closed.
+
+commands:
+  :call FN [JSON]  call a contract function with arguments keyed by name
+  :funcs           list the contract's functions
+  :vars            show every named variable
+  :time [UNIX]     show or set the time policies are activated at
+  :reset           discard the session and start from the initial storage
+  :help            show this help
+  :quit            leave the REPL`
+
+// emptyContract is what the REPL evaluates against when given no file.
+const emptyContract = "contract Repl {}"
+
+func runREPL(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	timestamp := fs.Int64("timestamp", 0, "activate policies at this Unix time (default: now)")
+	strict := fs.Bool("strict", false, "forbid non-deterministic natives")
+	params := paramFlags{}
+	fs.Var(params, "param", "override a param policy rule, as Policy.rule=value (repeatable)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) > 1 {
+		fmt.Fprintln(stderr, "usage: synx repl [--timestamp unix] [--strict] [--param Policy.rule=value ...] [contract.snx | artifact.json]")
+		return 2
+	}
+
+	opts := vm.BuildOptions{Strict: *strict, Params: params}
+	var artifact *compiler.ContractArtifact
+	if len(positional) == 1 {
+		artifact, err = loadArtifact(positional[0], opts)
+	} else {
+		artifact, err = emptyArtifact(opts)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "repl: %v\n", err)
+		return 1
+	}
+
+	session, err := vm.NewSession(artifact, vm.NewNatives())
+	if err == nil && *timestamp != 0 {
+		err = session.SetTime(time.Unix(*timestamp, 0))
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "repl: %v\n", err)
+		return 1
+	}
+
+	r := &repl{session: session, artifact: artifact, out: stdout}
+	r.run(os.Stdin)
+	return 0
+}
+
+func emptyArtifact(opts vm.BuildOptions) (*compiler.ContractArtifact, error) {
+	encoded, err := buildArtifact([]byte(emptyContract), opts)
+	if err != nil {
+		return nil, err
+	}
+	var artifact compiler.ContractArtifact
+	if err := json.Unmarshal(encoded, &artifact); err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+type repl struct {
+	session  *vm.Session
+	artifact *compiler.ContractArtifact
+	out      io.Writer
+}
+
+func (r *repl) run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	var input strings.Builder
+	for {
+		if input.Len() == 0 {
+			fmt.Fprint(r.out, "synx> ")
+		} else {
+			fmt.Fprint(r.out, "  ... ")
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return
+		}
+		line := scanner.Text()
+
+		if input.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := r.command(strings.TrimSpace(line)); quit {
+				return
+			}
+			continue
+		}
+
+		input.WriteString(line)
+		input.WriteString("\n")
+		if unclosed(input.String()) {
+			continue
+		}
+		r.eval(input.String())
+		input.Reset()
+	}
+}
+
+// unclosed reports whether src opens more brackets than it closes, outside
+// strings and comments.
+func unclosed(src string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(src); i++ {
+		ch := src[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case ch == '{' || ch == '(' || ch == '[':
+			depth++
+		case ch == '}' || ch == ')' || ch == ']':
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+func (r *repl) eval(src string) {
+	result, value, err := r.session.Eval(src)
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	r.printEvents(result.Journal)
+	switch {
+	case !result.Success:
+		fmt.Fprintf(r.out, "error: %s\n", formatValue(result.Error))
+	case value:
+		fmt.Fprintln(r.out, formatValue(result.Value))
+	}
+}
+
+func (r *repl) printEvents(journal []vm.JournalEvent) {
+	for _, event := range journal {
+		fmt.Fprintf(r.out, "emit %s %s\n", event.Type, formatValue(event.Payload))
+	}
+}
+
+// command runs one REPL command and reports whether to quit.
+func (r *repl) command(line string) bool {
+	name, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch name {
+	case ":call":
+		r.call(rest)
+	case ":funcs":
+		r.funcs()
+	case ":vars":
+		vars := r.session.Variables()
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(r.out, "  %s = %s\n", name, formatValue(vars[name]))
+		}
+	case ":time":
+		if rest == "" {
+			fmt.Fprintf(r.out, "  %d (%s)\n", r.session.Time().Unix(), r.session.Time().UTC().Format(time.RFC3339))
+			break
+		}
+		ts, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			fmt.Fprintln(r.out, "usage: :time UNIX")
+			break
+		}
+		if err := r.session.SetTime(time.Unix(ts, 0)); err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+		}
+	case ":reset":
+		if err := r.session.Reset(r.session.Time()); err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+		}
+	case ":help":
+		fmt.Fprintln(r.out, replHelp)
+	case ":quit", ":q":
+		return true
+	default:
+		fmt.Fprintf(r.out, "unknown command %q (try :help)\n", name)
+	}
+	return false
+}
+
+// call runs `:call FN [JSON]` and prints the result the way `synx run`
+// does.
+func (r *repl) call(args string) {
+	function, rawArgs, _ := strings.Cut(args, " ")
+	if function == "" {
+		fmt.Fprintln(r.out, "usage: :call FN [JSON]")
+		return
+	}
+	callArgs := map[string]interface{}{}
+	if rawArgs = strings.TrimSpace(rawArgs); rawArgs != "" {
+		if err := json.Unmarshal([]byte(rawArgs), &callArgs); err != nil {
+			fmt.Fprintf(r.out, "error: invalid arguments: %v\n", err)
+			return
+		}
+	}
+
+	result, err := r.session.Call(function, callArgs)
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	out := runOutput{Success: result.Success, Error: result.Error}
+	if result.Success || result.Decision != nil {
+		out.Data = map[string]interface{}{
+			"journal":  result.Journal,
+			"value":    result.Value,
+			"decision": result.Decision,
+		}
+	}
+	encoded, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintln(r.out, string(encoded))
+}
+
+func (r *repl) funcs() {
+	names := make([]string, 0, len(r.artifact.Functions))
+	for name := range r.artifact.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		meta := r.artifact.Functions[name]
+		params := make([]string, len(meta.ArgMeta))
+		for i, arg := range meta.ArgMeta {
+			params[i] = arg.Name + ": " + arg.TypeName
+		}
+		sig := name + "(" + strings.Join(params, ", ") + ")"
+		if meta.ReturnType != "" {
+			sig += ": " + meta.ReturnType
+		}
+		fmt.Fprintf(r.out, "  %s\n", sig)
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/peiblow/vvm/compiler"
+	"github.com/peiblow/vvm/vm"
+)
+
+// runOutput is what `synx run` prints: the EXEC response without its wire
+// envelope.
+type runOutput struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   interface{} `json:"error,omitempty"`
+}
+
+func runRun(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	argsPath := fs.String("args", "", "JSON file with the call's arguments, keyed by name (- reads stdin)")
+	timestamp := fs.Int64("timestamp", 0, "evaluate the call at this Unix time (default: now)")
+	explain := fs.Bool("explain", false, "include the evaluation trace in the output")
+	strict := fs.Bool("strict", false, "forbid non-deterministic natives")
+	params := paramFlags{}
+	fs.Var(params, "param", "override a param policy rule, as Policy.rule=value (repeatable)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fmt.Fprintln(stderr, "usage: synx run [--args args.json] [--timestamp unix] [--explain] [--strict] [--param Policy.rule=value ...] <contract.snx> <function>")
+		return 2
+	}
+	srcPath, function := positional[0], positional[1]
+
+	callArgs, err := readCallArgs(*argsPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "run: %v\n", err)
+		return 1
+	}
+
+	src, err := os.ReadFile(srcPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "run: %v\n", err)
+		return 1
+	}
+	encoded, err := buildArtifact(src, vm.BuildOptions{Strict: *strict, Params: params})
+	if err != nil {
+		fmt.Fprintf(stderr, "run: %v\n", err)
+		return 1
+	}
+
+	resp := vm.NewRuntime().Exec("run", vm.ExecRequest{
+		ArtifactHash:     compiler.DigestBytes(encoded),
+		ContractArtifact: encoded,
+		Function:         function,
+		Args:             callArgs,
+		Timestamp:        *timestamp,
+		Explain:          *explain,
+	})
+
+	out, err := json.MarshalIndent(runOutput{Success: resp.Success, Data: resp.Data, Error: resp.Error}, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "run: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, string(out))
+	if !resp.Success {
+		return 1
+	}
+	return 0
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/peiblow/vvm/vm"
+)
+
+// DefaultAddr is the address the wire protocol server listens on.
+const DefaultAddr = ":8332"
+
+func runServe(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", DefaultAddr, "TCP address to listen on")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 0 {
+		fmt.Fprintln(stderr, "usage: synx serve [--addr host:port]")
+		return 2
+	}
+
+	if err := vm.NewRuntime().ListenAndServe(*addr); err != nil {
+		fmt.Fprintf(stderr, "serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
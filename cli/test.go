@@ -0,0 +1,346 @@
+package cli
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peiblow/vvm/vm"
+)
+
+const testFileSuffix = "_test.snx"
+
+// testSuite is the outcome of testing one contract: either its results or
+// the error that kept it from building.
+type testSuite struct {
+	Path    string
+	Results []vm.TestResult
+	Err     error
+}
+
+func (s testSuite) failures() int {
+	n := 0
+	for _, r := range s.Results {
+		if !r.Passed {
+			n++
+		}
+	}
+	return n
+}
+
+func runTest(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "text", "report format: text, tap or junit")
+	out := flags.String("o", "", "write the report to this path instead of stdout")
+	strict := flags.Bool("strict", false, "forbid non-deterministic natives")
+	params := paramFlags{}
+	flags.Var(params, "param", "override a param policy rule, as Policy.rule=value (repeatable)")
+	paths, err := parseArgs(flags, args)
+	if err != nil {
+		return 2
+	}
+	report, ok := reporters[*format]
+	if !ok {
+		fmt.Fprintf(stderr, "test: unknown format %q (want text, tap or junit)\n", *format)
+		return 2
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	contracts, err := findTestContracts(paths)
+	if err != nil {
+		fmt.Fprintf(stderr, "test: %v\n", err)
+		return 1
+	}
+	if len(contracts) == 0 {
+		fmt.Fprintln(stderr, "test: no contracts with tests found")
+		return 1
+	}
+
+	suites := make([]testSuite, 0, len(contracts))
+	for _, path := range contracts {
+		suites = append(suites, runTestSuite(path, vm.BuildOptions{Strict: *strict, Params: params}))
+	}
+
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(stderr, "test: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := report(w, suites); err != nil {
+		fmt.Fprintf(stderr, "test: %v\n", err)
+		return 1
+	}
+
+	for _, s := range suites {
+		if s.Err != nil || s.failures() > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// findTestContracts resolves paths to contract sources. A directory
+// contributes every contract in it, recursively, that declares tests or has
+// a *_test.snx file; a *_test.snx path stands for the contract it tests.
+func findTestContracts(paths []string) ([]string, error) {
+	var contracts []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			contracts = append(contracts, path)
+		}
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(contractFor(path))
+			continue
+		}
+
+		var found []string
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(p, ".snx") || strings.HasSuffix(p, testFileSuffix) {
+				return err
+			}
+			if hasTests(p) {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		for _, p := range found {
+			add(p)
+		}
+	}
+	return contracts, nil
+}
+
+// contractFor maps a *_test.snx path to the contract it tests.
+func contractFor(path string) string {
+	if strings.HasSuffix(path, testFileSuffix) {
+		return strings.TrimSuffix(path, testFileSuffix) + ".snx"
+	}
+	return path
+}
+
+// hasTests reports whether a contract has a test file or, by a cheap
+// textual check, declares test blocks itself.
+func hasTests(path string) bool {
+	if _, err := os.Stat(testFileFor(path)); err == nil {
+		return true
+	}
+	src, err := os.ReadFile(path)
+	return err == nil && strings.Contains(string(src), "test \"")
+}
+
+func testFileFor(contract string) string {
+	return strings.TrimSuffix(contract, ".snx") + testFileSuffix
+}
+
+func runTestSuite(path string, opts vm.BuildOptions) (suite testSuite) {
+	suite.Path = path
+	defer func() {
+		if r := recover(); r != nil {
+			suite.Err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		suite.Err = err
+		return suite
+	}
+	testSrc, err := os.ReadFile(testFileFor(path))
+	switch {
+	case err == nil:
+		opts.TestSource = testSrc
+	case !errors.Is(err, fs.ErrNotExist):
+		suite.Err = err
+		return suite
+	}
+
+	suite.Results, suite.Err = vm.NewRuntime().RunTests(src, opts)
+	if suite.Err == nil && len(suite.Results) == 0 {
+		suite.Err = fmt.Errorf("no tests declared")
+	}
+	return suite
+}
+
+var reporters = map[string]func(io.Writer, []testSuite) error{
+	"text":  reportText,
+	"tap":   reportTAP,
+	"junit": reportJUnit,
+}
+
+func failureMessage(err map[string]interface{}) string {
+	if err == nil {
+		return "test failed"
+	}
+	return fmt.Sprintf("%v: %v", err["code"], err["message"])
+}
+
+func reportText(w io.Writer, suites []testSuite) error {
+	passed, failed := 0, 0
+	for _, s := range suites {
+		fmt.Fprintf(w, "=== %s\n", s.Path)
+		if s.Err != nil {
+			fmt.Fprintf(w, "ERROR %v\n", s.Err)
+			failed++
+			continue
+		}
+		for _, r := range s.Results {
+			if r.Passed {
+				passed++
+				fmt.Fprintf(w, "ok    %s (%s)\n", r.Name, r.Duration.Round(time.Microsecond))
+			} else {
+				failed++
+				fmt.Fprintf(w, "FAIL  %s: %s\n", r.Name, failureMessage(r.Error))
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "--- %d passed, %d failed\n", passed, failed)
+	return err
+}
+
+// reportTAP writes TAP version 13, with a YAML block for each failure.
+func reportTAP(w io.Writer, suites []testSuite) error {
+	total := 0
+	for _, s := range suites {
+		if s.Err != nil {
+			total++
+		}
+		total += len(s.Results)
+	}
+
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%d\n", total)
+	n := 0
+	for _, s := range suites {
+		if s.Err != nil {
+			n++
+			fmt.Fprintf(w, "not ok %d - %s\n", n, s.Path)
+			fmt.Fprintf(w, "  ---\n  message: %q\n  ...\n", s.Err.Error())
+			continue
+		}
+		for _, r := range s.Results {
+			n++
+			if r.Passed {
+				fmt.Fprintf(w, "ok %d - %s: %s\n", n, s.Path, r.Name)
+				continue
+			}
+			fmt.Fprintf(w, "not ok %d - %s: %s\n", n, s.Path, r.Name)
+			fmt.Fprintf(w, "  ---\n  code: %q\n  message: %q\n  ...\n",
+				fmt.Sprint(r.Error["code"]), fmt.Sprint(r.Error["message"]))
+		}
+	}
+	return nil
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.6f", d.Seconds())
+}
+
+// reportJUnit writes JUnit XML, one testsuite per contract. A contract that
+// fails to build is reported as a single errored test case.
+func reportJUnit(w io.Writer, suites []testSuite) error {
+	doc := junitSuites{}
+	for _, s := range suites {
+		suite := junitSuite{Name: s.Path}
+		var elapsed time.Duration
+		if s.Err != nil {
+			suite.Tests, suite.Errors = 1, 1
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      "build",
+				ClassName: s.Path,
+				Time:      seconds(0),
+				Error:     &junitFailure{Message: s.Err.Error()},
+			})
+		}
+		for _, r := range s.Results {
+			elapsed += r.Duration
+			c := junitCase{Name: r.Name, ClassName: s.Path, Time: seconds(r.Duration)}
+			if !r.Passed {
+				suite.Failures++
+				c.Failure = &junitFailure{
+					Message: failureMessage(r.Error),
+					Type:    fmt.Sprint(r.Error["code"]),
+					Text:    fmt.Sprint(r.Error["message"]),
+				}
+			}
+			suite.Tests++
+			suite.Cases = append(suite.Cases, c)
+		}
+		suite.Time = seconds(elapsed)
+
+		doc.Tests += suite.Tests
+		doc.Failures += suite.Failures
+		doc.Errors += suite.Errors
+		doc.Suites = append(doc.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,13 @@
+// Command synx checks, builds, runs and disassembles Synx contracts, and
+// serves the VVM wire protocol.
+package main
+
+import (
+	"os"
+
+	"github.com/peiblow/vvm/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:]))
+}
@@ -0,0 +1,505 @@
+package compiler
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/peiblow/vvm/ast"
+)
+
+// SchemaDialect is the JSON Schema version ABI schemas are written in.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// EventMeta describes an event a function emits. Fields maps each payload
+// field to its type, "" when it cannot be told from the source; it is nil
+// when the payload is not an object literal or a value of a declared type.
+type EventMeta struct {
+	Name   string            `json:"name"`
+	Fields map[string]string `json:"fields"`
+}
+
+// Schema is a JSON Schema document.
+type Schema map[string]interface{}
+
+// ABI describes how to call a contract: each function's arguments with a
+// JSON Schema per argument, its return type, the events it may emit and the
+// error codes it may fail with. Events and Errors give the payload shape of
+// every event and the details of every declared error, and CommonErrors the
+// codes any call may fail with on top of its function's own.
+type ABI struct {
+	Functions    map[string]FunctionABI `json:"functions"`
+	Events       map[string]EventABI    `json:"events"`
+	Errors       map[string]ErrorABI    `json:"errors"`
+	CommonErrors []string               `json:"common_errors"`
+}
+
+// CommonErrors are the codes the VM may fail any call with: a call to a
+// function the contract lacks or with the wrong number of arguments, and
+// malformed bytecode or an internal fault while it runs.
+var CommonErrors = []string{"ARG_COUNT_MISMATCH", "FUNCTION_NOT_FOUND", "INVALID_BYTECODE", "RUNTIME_PANIC", "UNKNOWN_OPCODE"}
+
+// opcodeErrors are the codes the VM raises while executing an opcode.
+var opcodeErrors = map[byte][]string{
+	OP_ADD:         {"ARITHMETIC_OVERFLOW"},
+	OP_SUB:         {"ARITHMETIC_OVERFLOW"},
+	OP_MUL:         {"ARITHMETIC_OVERFLOW"},
+	OP_DIV:         {"ARITHMETIC_OVERFLOW", "DIVISION_BY_ZERO"},
+	OP_MOD:         {"ARITHMETIC_OVERFLOW", "DIVISION_BY_ZERO"},
+	OP_BUILTIN:     {"BUILTIN_ERROR", "INVALID_ARGUMENT"},
+	OP_CALL_NATIVE: {"NATIVE_ERROR", "NATIVE_NOT_FOUND", "NONDETERMINISTIC_NATIVE"},
+}
+
+// builtinErrors are the codes a builtin raises beyond those of OP_BUILTIN.
+var builtinErrors = map[string][]string{
+	"sum": {"ARITHMETIC_OVERFLOW"},
+}
+
+type FunctionABI struct {
+	Doc     string     `json:"doc,omitempty"`
+	Args    []ArgABI   `json:"args"`
+	Input   Schema     `json:"input"` // the EXEC request's args object
+	Returns *ReturnABI `json:"returns,omitempty"`
+	Events  []string   `json:"events"`
+	Errors  []string   `json:"errors"`
+}
+
+type ArgABI struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Schema Schema `json:"schema"`
+}
+
+type ReturnABI struct {
+	Type   string `json:"type"`
+	Schema Schema `json:"schema"`
+}
+
+// EventABI describes an event's payload, which the journal records under
+// "data".
+type EventABI struct {
+	Payload Schema `json:"payload"`
+}
+
+// ErrorABI describes the details object of a declared error.
+type ErrorABI struct {
+	Details Schema `json:"details"`
+}
+
+// ABI derives the contract's ABI from the artifact. Test blocks are left
+// out.
+func (a *ContractArtifact) ABI() ABI {
+	abi := ABI{
+		Functions:    make(map[string]FunctionABI),
+		Events:       make(map[string]EventABI),
+		Errors:       make(map[string]ErrorABI),
+		CommonErrors: CommonErrors,
+	}
+
+	versioned := false
+	for _, policy := range a.Policies {
+		versioned = versioned || len(policy.Versions) > 0
+	}
+
+	events := make(map[string]EventMeta)
+	for name, meta := range a.Functions {
+		if strings.HasPrefix(name, TestFunction("")) {
+			continue
+		}
+
+		fn := FunctionABI{
+			Doc:    meta.Doc,
+			Args:   make([]ArgABI, len(meta.ArgMeta)),
+			Events: make([]string, len(meta.Events)),
+			Errors: append([]string{}, meta.Errors...),
+		}
+		properties := Schema{}
+		required := make([]string, len(meta.ArgMeta))
+		for i, arg := range meta.ArgMeta {
+			schema := a.TypeSchema(arg.TypeName)
+			fn.Args[i] = ArgABI{Name: arg.Name, Type: arg.TypeName, Schema: schema}
+			properties[arg.Name] = schema
+			required[i] = arg.Name
+		}
+		fn.Input = Schema{
+			"$schema":    SchemaDialect,
+			"type":       "object",
+			"properties": properties,
+		}
+		if len(required) > 0 {
+			fn.Input["required"] = required
+		}
+		if meta.ReturnType != "" {
+			fn.Returns = &ReturnABI{Type: meta.ReturnType, Schema: a.TypeSchema(meta.ReturnType)}
+			// Only the called function's own return value is checked.
+			if meta.ReturnType != "Void" {
+				fn.Errors = append(fn.Errors, "RETURN_TYPE_MISMATCH")
+			}
+		}
+		if versioned {
+			fn.Errors = append(fn.Errors, "NO_ACTIVE_POLICY")
+		}
+		sort.Strings(fn.Errors)
+		for i, event := range meta.Events {
+			fn.Events[i] = event.Name
+			if seen, ok := events[event.Name]; ok {
+				event = mergeEvents(seen, event)
+			}
+			events[event.Name] = event
+		}
+		abi.Functions[name] = fn
+	}
+
+	for name, event := range events {
+		abi.Events[name] = EventABI{Payload: a.fieldsSchema(event.Fields)}
+	}
+	for name, meta := range a.Errors {
+		fields := make(map[string]string, len(meta.Fields))
+		for _, field := range meta.Fields {
+			fields[field.Name] = field.Type
+		}
+		details := a.fieldsSchema(fields)
+		details["required"] = sortedKeys(fields)
+		abi.Errors[name] = ErrorABI{Details: details}
+	}
+	return abi
+}
+
+// TypeSchema returns the JSON Schema for values of a declared type: a
+// builtin, a `type` declared by the contract, or an array of either. Types
+// it does not know, including "", accept any value.
+func (a *ContractArtifact) TypeSchema(typeName string) Schema {
+	return a.typeSchema(typeName, map[string]bool{})
+}
+
+// typeSchema builds the schema, inlining declared types. A type that refers
+// back to itself is described as a plain object from the second level on.
+func (a *ContractArtifact) typeSchema(typeName string, visiting map[string]bool) Schema {
+	if strings.HasPrefix(typeName, "[]") {
+		return Schema{"type": "array", "items": a.typeSchema(typeName[2:], visiting)}
+	}
+	switch typeName {
+	case "UInt":
+		return Schema{"type": "integer", "minimum": 0}
+	case "Int":
+		return Schema{"type": "integer"}
+	case "Float", "Number":
+		return Schema{"type": "number"}
+	case "String", "Address", "Proof":
+		return Schema{"type": "string"}
+	case "Bool", "bool":
+		return Schema{"type": "boolean"}
+	case "Void":
+		return Schema{"type": "null"}
+	}
+
+	meta, declared := a.Types[typeName]
+	if !declared {
+		return Schema{}
+	}
+	if visiting[typeName] {
+		return Schema{"type": "object"}
+	}
+	visiting[typeName] = true
+	defer delete(visiting, typeName)
+
+	properties := Schema{}
+	for field, fieldType := range meta.Fields {
+		properties[field] = a.typeSchema(fieldType, visiting)
+	}
+	schema := Schema{
+		"title":      typeName,
+		"type":       "object",
+		"properties": properties,
+		"required":   sortedKeys(meta.Fields),
+	}
+	if meta.Doc != "" {
+		schema["description"] = meta.Doc
+	}
+	return schema
+}
+
+// fieldsSchema describes an object with the given fields; nil fields
+// describe any value.
+func (a *ContractArtifact) fieldsSchema(fields map[string]string) Schema {
+	if fields == nil {
+		return Schema{}
+	}
+	properties := Schema{}
+	for field, fieldType := range fields {
+		properties[field] = a.TypeSchema(fieldType)
+	}
+	return Schema{"type": "object", "properties": properties}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// functionUse records what a function's body emits, fails with and calls,
+// until Artifact folds in the functions it calls.
+type functionUse struct {
+	args   map[string]string // argument name -> declared type
+	events []EventMeta
+	*errorScope
+}
+
+// errorScope records the codes a function body, or a try block in it,
+// fails with and the functions it calls. Codes raised in a try block leave
+// the function unless one of the block's catch clauses handles them.
+type errorScope struct {
+	errors    map[string]bool
+	calls     map[string]bool
+	tries     []*errorScope
+	caught    map[string]bool // codes the try block's typed clauses catch
+	caughtAll bool            // the try block has a clause without a type
+}
+
+func newErrorScope() *errorScope {
+	return &errorScope{
+		errors: make(map[string]bool),
+		calls:  make(map[string]bool),
+		caught: make(map[string]bool),
+	}
+}
+
+// escaping returns the codes that leave the scope, given the codes each
+// function is known to fail with.
+func (s *errorScope) escaping(known map[string]map[string]bool) map[string]bool {
+	codes := make(map[string]bool, len(s.errors))
+	for code := range s.errors {
+		codes[code] = true
+	}
+	for callee := range s.calls {
+		for code := range known[callee] {
+			codes[code] = true
+		}
+	}
+	for _, try := range s.tries {
+		if try.caughtAll {
+			continue
+		}
+		for code := range try.escaping(known) {
+			if !try.caught[code] {
+				codes[code] = true
+			}
+		}
+	}
+	return codes
+}
+
+func (c *Compiler) noteEvent(s ast.EmitStmt) {
+	// Only literal names are known before the call runs.
+	name, ok := s.EventName.(ast.StringExpr)
+	if c.function == nil || !ok {
+		return
+	}
+	c.function.events = append(c.function.events, EventMeta{Name: name.Value, Fields: c.payloadFields(s.Arguments)})
+}
+
+// noteError records the code an error value raised by the current function
+// carries: a literal code, or the name of a declared error.
+func (c *Compiler) noteError(value ast.Expr) {
+	if c.scope == nil {
+		return
+	}
+	switch e := value.(type) {
+	case ast.StringExpr:
+		c.scope.errors[e.Value] = true
+	case ast.ErrorExpr:
+		c.noteError(e.Code)
+	case ast.CallExpr:
+		if callee, ok := e.Calle.(ast.SymbolExpr); ok {
+			c.scope.errors[callee.Value] = true
+		}
+	}
+}
+
+// noteOpcode records the codes the VM may raise executing an instruction of
+// the current function.
+func (c *Compiler) noteOpcode(instruction []byte) {
+	if c.scope == nil {
+		return
+	}
+	for _, code := range opcodeErrors[instruction[0]] {
+		c.scope.errors[code] = true
+	}
+	if instruction[0] == OP_BUILTIN {
+		name, _ := c.ConstPool[instruction[1]].(string)
+		for _, code := range builtinErrors[name] {
+			c.scope.errors[code] = true
+		}
+	}
+}
+
+func (c *Compiler) noteCall(name string) {
+	if c.scope != nil {
+		c.scope.calls[name] = true
+	}
+}
+
+// resolveUses fills each function's Events and Errors with what its body
+// and every function it calls, directly or not, may emit and fail with.
+// Codes a function catches itself are left out of its Errors.
+func (c *Compiler) resolveUses() {
+	// A function fails with what its callees fail with, so the codes are
+	// propagated until no set grows; calls may be recursive.
+	errors := make(map[string]map[string]bool, len(c.uses))
+	for changed := true; changed; {
+		changed = false
+		for name, use := range c.uses {
+			for code := range use.escaping(errors) {
+				if errors[name] == nil {
+					errors[name] = make(map[string]bool)
+				}
+				if !errors[name][code] {
+					errors[name][code] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	for name, meta := range c.Functions {
+		if c.uses[name] == nil {
+			continue
+		}
+		events := make(map[string]EventMeta)
+		c.collectEvents(name, map[string]bool{}, events)
+
+		meta.Events = make([]EventMeta, 0, len(events))
+		for _, event := range events {
+			meta.Events = append(meta.Events, event)
+		}
+		sort.Slice(meta.Events, func(i, j int) bool { return meta.Events[i].Name < meta.Events[j].Name })
+		meta.Errors = make([]string, 0, len(errors[name]))
+		for code := range errors[name] {
+			meta.Errors = append(meta.Errors, code)
+		}
+		sort.Strings(meta.Errors)
+		c.Functions[name] = meta
+	}
+}
+
+func (c *Compiler) collectEvents(name string, visited map[string]bool, events map[string]EventMeta) {
+	use := c.uses[name]
+	if use == nil || visited[name] {
+		return
+	}
+	visited[name] = true
+	for _, event := range use.events {
+		if seen, ok := events[event.Name]; ok {
+			event = mergeEvents(seen, event)
+		}
+		events[event.Name] = event
+	}
+	for callee := range use.allCalls() {
+		c.collectEvents(callee, visited, events)
+	}
+}
+
+// allCalls returns the functions the scope calls, in or out of its try
+// blocks.
+func (s *errorScope) allCalls() map[string]bool {
+	if len(s.tries) == 0 {
+		return s.calls
+	}
+	calls := make(map[string]bool, len(s.calls))
+	for name := range s.calls {
+		calls[name] = true
+	}
+	for _, try := range s.tries {
+		for name := range try.allCalls() {
+			calls[name] = true
+		}
+	}
+	return calls
+}
+
+// mergeEvents combines two emits of the same event: the payload has the
+// fields of both, and a field emitted with different types has type "".
+func mergeEvents(a, b EventMeta) EventMeta {
+	if a.Fields == nil || b.Fields == nil {
+		return EventMeta{Name: a.Name}
+	}
+	fields := make(map[string]string, len(a.Fields))
+	for field, fieldType := range a.Fields {
+		fields[field] = fieldType
+	}
+	for field, fieldType := range b.Fields {
+		if seen, ok := fields[field]; ok && seen != fieldType {
+			fieldType = ""
+		}
+		fields[field] = fieldType
+	}
+	return EventMeta{Name: a.Name, Fields: fields}
+}
+
+// payloadFields describes an emitted payload: the keys of an object
+// literal, or the fields of a declared type.
+func (c *Compiler) payloadFields(payload ast.Expr) map[string]string {
+	if payload == nil {
+		return map[string]string{}
+	}
+	if obj, ok := payload.(ast.ObjectAssignmentExpr); ok && obj.Name == nil {
+		fields := make(map[string]string, len(obj.Fields))
+		for _, field := range obj.Fields {
+			if key, ok := field.Key.(ast.SymbolExpr); ok {
+				fields[key.Value] = c.staticType(field.Value)
+			}
+		}
+		return fields
+	}
+	meta, declared := c.Types[c.staticType(payload)]
+	if !declared {
+		return nil
+	}
+	fields := make(map[string]string, len(meta.Fields))
+	for field, fieldType := range meta.Fields {
+		fields[field] = fieldType
+	}
+	return fields
+}
+
+// staticType returns the type an expression in the current function
+// evaluates to, when the source alone tells: literals, arguments, fields of
+// declared types and calls to typed functions. It returns "" otherwise.
+func (c *Compiler) staticType(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case ast.NumberExpr:
+		if e.Literal != "" {
+			return "Address"
+		}
+		if e.Value >= 0 && e.Value == float64(int64(e.Value)) {
+			return "UInt"
+		}
+	case ast.StringExpr:
+		return "String"
+	case ast.BooleanLiteralExpr:
+		return "Bool"
+	case ast.SymbolExpr:
+		return c.function.args[e.Value]
+	case ast.MemberExpr:
+		if property, ok := e.Property.(ast.SymbolExpr); ok {
+			return c.Types[c.staticType(e.Object)].Fields[property.Value]
+		}
+	case ast.ObjectAssignmentExpr:
+		if name, ok := e.Name.(ast.SymbolExpr); ok {
+			return name.Value
+		}
+	case ast.CallExpr:
+		if callee, ok := e.Calle.(ast.SymbolExpr); ok {
+			return c.Functions[callee.Value].ReturnType
+		}
+	case ast.BinaryExpr:
+		switch e.Operator.Literal {
+		case "==", "!=", "<", ">", "<=", ">=", "&&", "||":
+			return "Bool"
+		}
+	}
+	return ""
+}
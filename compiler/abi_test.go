@@ -0,0 +1,112 @@
+package compiler_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/peiblow/vvm/vm"
+)
+
+const errorsContract = `contract Errs {
+  error LimitExceeded { limit: UInt, requested: UInt }
+  error Frozen { account: String }
+  error Empty { amount: UInt }
+
+  fn withdraw(amount: UInt): UInt {
+    require(amount > 0; "INVALID_AMOUNT", "amount must be positive")
+    require(amount <= 100; LimitExceeded(100, amount))
+    return amount
+  }
+
+  fn typed(amount: UInt): String {
+    try {
+      require(amount > 0; "ZERO", "zero amount")
+      require(amount <= 100; LimitExceeded(100, amount))
+    } catch (e: LimitExceeded) {
+      return "caught"
+    }
+    return "done"
+  }
+
+  fn catchAll(amount: UInt, freeze: Bool): String {
+    try {
+      require(freeze == false; Frozen("acc-1"))
+      withdraw(amount)
+    } catch (e: LimitExceeded) {
+      return "limit"
+    } catch (e) {
+      return "other"
+    }
+    return "ok"
+  }
+
+  fn callsCaught(amount: UInt): UInt {
+    try {
+      return withdraw(amount)
+    } catch (e: LimitExceeded) {
+      return 0
+    }
+  }
+
+  fn rethrows(amount: UInt): String {
+    try {
+      withdraw(amount)
+    } catch (e) {
+      require(false; "WRAPPED", "withdraw failed")
+    }
+    return "ok"
+  }
+
+  fn nested(amount: UInt): String {
+    try {
+      try {
+        require(amount > 0; Empty(amount))
+        require(amount <= 100; LimitExceeded(100, amount))
+      } catch (e: Empty) {
+        return "zero"
+      }
+    } catch (e: LimitExceeded) {
+      return "limit"
+    }
+    return "ok"
+  }
+
+  fn countdown(n: UInt): UInt {
+    require(n < 10; "TOO_HIGH", "n is too high")
+    if (n == 0) {
+      return 0
+    }
+    return countdown(n - 1)
+  }
+}`
+
+func TestFunctionErrors(t *testing.T) {
+	artifact, err := vm.NewRuntime().Build([]byte(errorsContract), vm.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"withdraw", []string{"INVALID_AMOUNT", "LimitExceeded"}},
+		{"typed", []string{"ZERO"}},
+		{"catchAll", []string{}},
+		{"callsCaught", []string{"INVALID_AMOUNT"}},
+		{"rethrows", []string{"WRAPPED"}},
+		{"nested", []string{}},
+		{"countdown", []string{"ARITHMETIC_OVERFLOW", "TOO_HIGH"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			meta, ok := artifact.Functions[tt.function]
+			if !ok {
+				t.Fatalf("function %s not found", tt.function)
+			}
+			if !reflect.DeepEqual(meta.Errors, tt.want) {
+				t.Fatalf("Errors = %v, want %v", meta.Errors, tt.want)
+			}
+		})
+	}
+}
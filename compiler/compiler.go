@@ -1,8 +1,12 @@
 package compiler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 
 	"github.com/peiblow/vvm/ast"
 )
@@ -14,13 +18,21 @@ type ArgMeta struct {
 }
 
 type FunctionMeta struct {
-	Addr    int       `json:"addr"`
-	Args    []int     `json:"args"`
-	ArgMeta []ArgMeta `json:"arg_meta"`
+	Addr       int       `json:"addr"`
+	Args       []int     `json:"args"`
+	ArgMeta    []ArgMeta `json:"arg_meta"`
+	ReturnType string    `json:"return_type,omitempty"`
+	Doc        string    `json:"doc,omitempty"`
+	// Events and Errors list the events the function may emit and the
+	// error codes it may fail with, including through the functions it
+	// calls.
+	Events []EventMeta `json:"events,omitempty"`
+	Errors []string    `json:"errors,omitempty"`
 }
 
 type TypeMeta struct {
 	Fields map[string]string `json:"fields"`
+	Doc    string            `json:"doc,omitempty"`
 }
 
 type Compiler struct {
@@ -30,8 +42,31 @@ type Compiler struct {
 	Functions    map[string]FunctionMeta
 	FunctionName map[int]string
 	Types        map[string]TypeMeta
+	Agents       map[string]int // agent name -> storage slot
+	Registries   map[string]int // registry entry name -> storage slot
+	Policies     map[string]PolicyMeta
+	TracePoints  map[int]TracePoint // OP_JMP_IF address -> condition it tests
+	Errors       map[string]ErrorMeta
+	Tests        []string    // test names in declaration order
+	Lines        []LineEntry // source line of each statement's first instruction
 	NextSlot     int
+	Natives      map[string]bool        // host functions callable via OP_CALL_NATIVE
+	Strict       bool                   // forbid non-deterministic natives
+	Params       map[string]interface{} // deploy-time overrides of param rules
+	CompileTests bool                   // compile test blocks for the test runner
+	ParamValues  map[string]ParamValue  // effective value of every param rule
+	usedNatives  map[string]bool
+	freeSlots    []int
+	forwardCalls map[string][]int // operand positions of calls to functions not compiled yet
+	usedParams   map[string]bool
+	paramErrors  []string
 	isInFunction bool
+	function     *functionUse // the function being compiled, nil outside one
+	scope        *errorScope  // the body or try block of the function being compiled
+	uses         map[string]*functionUse
+	loops        []*loopContext
+	tryDepth     int
+	funcTryDepth int // tryDepth where the function being compiled starts
 }
 
 func New() *Compiler {
@@ -42,20 +77,39 @@ func New() *Compiler {
 		Functions:    make(map[string]FunctionMeta),
 		FunctionName: make(map[int]string),
 		Types:        make(map[string]TypeMeta),
+		Agents:       make(map[string]int),
+		Registries:   make(map[string]int),
+		Policies:     make(map[string]PolicyMeta),
+		TracePoints:  make(map[int]TracePoint),
+		Errors:       make(map[string]ErrorMeta),
+		ParamValues:  make(map[string]ParamValue),
+		usedParams:   make(map[string]bool),
 		NextSlot:     0,
 	}
 }
 
 type ContractArtifact struct {
-	Bytecode     []byte                 `json:"bytecode"`
-	ConstPool    []interface{}          `json:"const_pool"`
+	Bytecode     []byte                  `json:"bytecode"`
+	ConstPool    []interface{}           `json:"const_pool"`
 	Functions    map[string]FunctionMeta `json:"functions"`
-	FunctionName map[int]string         `json:"function_name"`
-	Types        map[string]TypeMeta    `json:"types"`
-	InitStorage  map[int]interface{}    `json:"init_storage"`
+	FunctionName map[int]string          `json:"function_name"`
+	Types        map[string]TypeMeta     `json:"types"`
+	InitStorage  map[int]interface{}     `json:"init_storage"`
+	Agents       map[string]int          `json:"agents"`
+	Registries   map[string]int          `json:"registries"`
+	Policies     map[string]PolicyMeta   `json:"policies"`
+	Params       map[string]ParamValue   `json:"params,omitempty"`
+	TracePoints  map[int]TracePoint      `json:"trace_points,omitempty"`
+	Errors       map[string]ErrorMeta    `json:"errors,omitempty"`
+	Tests        []string                `json:"tests,omitempty"`
+	Symbols      map[string]int          `json:"symbols,omitempty"`
+	Lines        []LineEntry             `json:"lines,omitempty"`
+	Natives      []string                `json:"natives,omitempty"`
+	Strict       bool                    `json:"strict,omitempty"`
 }
 
 func (c *Compiler) Artifact() *ContractArtifact {
+	c.resolveUses()
 	return &ContractArtifact{
 		Bytecode:     c.Code,
 		ConstPool:    c.ConstPool,
@@ -63,9 +117,57 @@ func (c *Compiler) Artifact() *ContractArtifact {
 		FunctionName: c.FunctionName,
 		Types:        c.Types,
 		InitStorage:  make(map[int]interface{}),
+		Agents:       c.Agents,
+		Registries:   c.Registries,
+		Policies:     c.Policies,
+		Params:       c.ParamValues,
+		TracePoints:  c.TracePoints,
+		Errors:       c.Errors,
+		Tests:        c.Tests,
+		Symbols:      c.Symbols,
+		Lines:        c.Lines,
+		Natives:      c.nativesUsed(),
+		Strict:       c.Strict,
 	}
 }
 
+// Digest returns the hex SHA-256 of the artifact's JSON encoding. Map keys
+// are encoded in sorted order, so equal artifacts always share a digest.
+func (a *ContractArtifact) Digest() (string, error) {
+	encoded, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	return DigestBytes(encoded), nil
+}
+
+// DigestBytes returns the hex SHA-256 of an encoded artifact without its
+// line table. The line table only maps bytecode back to source lines for
+// the debugger, so reformatting the source, which moves lines, keeps the
+// digest. Bytes that are not a JSON object are hashed as they are.
+func DigestBytes(encoded []byte) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err == nil {
+		delete(fields, "lines")
+		// Keys are re-encoded in sorted order.
+		if canonical, err := json.Marshal(fields); err == nil {
+			encoded = canonical
+		}
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// nativesUsed lists, in sorted order, the host functions the bytecode calls.
+func (c *Compiler) nativesUsed() []string {
+	names := make([]string, 0, len(c.usedNatives))
+	for name := range c.usedNatives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (c *Compiler) GetExpectedArgType(funcName string, argIndex int) string {
 	if meta, ok := c.Functions[funcName]; ok {
 		if argIndex < len(meta.ArgMeta) {
@@ -78,6 +180,9 @@ func (c *Compiler) GetExpectedArgType(funcName string, argIndex int) string {
 func (c *Compiler) GetActualType(expr ast.Expr) string {
 	switch e := expr.(type) {
 	case ast.NumberExpr:
+		if e.Literal != "" {
+			return "String"
+		}
 		if e.Value == float64(int(e.Value)) {
 			return "Int"
 		}
@@ -207,8 +312,13 @@ func (c *Compiler) ValidateFunctionCall(funcName string, args []ast.Expr) error
 	return nil
 }
 
-func (c *Compiler) emit(opcodes ...byte) {
-	c.Code = append(c.Code, opcodes...)
+// emit appends one instruction, checked against its descriptor.
+func (c *Compiler) emit(instruction ...byte) {
+	if info := &OpcodeTable[instruction[0]]; info.Name == "" || info.Width() != len(instruction) {
+		panic(fmt.Sprintf("internal compiler error: malformed %s instruction (%d bytes)", OpcodeName(instruction[0]), len(instruction)))
+	}
+	c.noteOpcode(instruction)
+	c.Code = append(c.Code, instruction...)
 }
 
 func (c *Compiler) addConst(val interface{}) byte {
@@ -245,13 +355,30 @@ func (c *Compiler) findConst(val interface{}) byte {
 	return byte(255)
 }
 
+// allocSlot gives name a storage slot, reusing one handed back with
+// ReuseSlot before taking a new one.
 func (c *Compiler) allocSlot(name string) int {
+	if n := len(c.freeSlots); n > 0 {
+		slot := c.freeSlots[n-1]
+		c.freeSlots = c.freeSlots[:n-1]
+		c.Symbols[name] = slot
+		return slot
+	}
 	slot := c.NextSlot
+	if slot > 255 {
+		panic(fmt.Sprintf("storage overflow: %d slots — OP_LOAD/OP_STORE operands are 1 byte (max 256). Reduce the number of variables.", slot+1))
+	}
 	c.Symbols[name] = slot
 	c.NextSlot++
 	return slot
 }
 
+// ReuseSlot hands back a slot nothing refers to any more, for allocSlot to
+// give out again.
+func (c *Compiler) ReuseSlot(slot int) {
+	c.freeSlots = append(c.freeSlots, slot)
+}
+
 func (c *Compiler) getSlot(name string) int {
 	slot, ok := c.Symbols[name]
 	if !ok {
@@ -269,9 +396,84 @@ func (c *Compiler) CompileBlock(block ast.BlockStmt) {
 	for _, stmt := range block.Body {
 		c.compileStmt(stmt)
 	}
+	c.checkForwardCalls()
 	c.emit(OP_HALT)
 }
 
+// checkForwardCalls fails on calls to a function that was never declared,
+// whose address compileFunc could not patch.
+func (c *Compiler) checkForwardCalls() {
+	if len(c.forwardCalls) == 0 {
+		return
+	}
+	names := make([]string, 0, len(c.forwardCalls))
+	for name := range c.forwardCalls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c.forwardCalls = nil
+	panic(fmt.Sprintf("call to undefined function '%s'", names[0]))
+}
+
+// CompileSnippet appends statements to already compiled code, as top-level
+// code ending in OP_HALT, and returns the address they start at. When the
+// last statement is an expression with a value, the value is left on the
+// stack and value is true. Snippets add no line table entries. On error
+// the code, constant pool and symbol table are left as they were.
+func (c *Compiler) CompileSnippet(stmts []ast.Stmt) (addr int, value bool, err error) {
+	if c.Symbols == nil {
+		c.Symbols = make(map[string]int)
+	}
+	addr = c.currentPos()
+	consts, lines, nextSlot := len(c.ConstPool), c.Lines, c.NextSlot
+	freeSlots := append([]int(nil), c.freeSlots...)
+	symbols := make(map[string]int, len(c.Symbols))
+	for name, slot := range c.Symbols {
+		symbols[name] = slot
+	}
+	defer func() {
+		c.Lines = lines
+		if r := recover(); r != nil {
+			c.Code = c.Code[:addr]
+			c.ConstPool = c.ConstPool[:consts]
+			c.Symbols, c.NextSlot, c.freeSlots = symbols, nextSlot, freeSlots
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	if c.TracePoints == nil {
+		c.TracePoints = make(map[int]TracePoint)
+	}
+	for i, stmt := range stmts {
+		if i == len(stmts)-1 && c.hasValue(stmt) {
+			c.compileExpr(stmt.(ast.ExpressionStmt).Expression)
+			value = true
+			break
+		}
+		c.compileStmt(stmt)
+	}
+	c.checkForwardCalls()
+	c.emit(OP_HALT)
+	return addr, value, nil
+}
+
+// hasValue reports whether stmt is an expression that leaves a value
+// behind: not an assignment, a call that pushes nothing, or an error
+// raised as a statement.
+func (c *Compiler) hasValue(stmt ast.Stmt) bool {
+	s, ok := stmt.(ast.ExpressionStmt)
+	if !ok || c.isErrorValue(s.Expression) {
+		return false
+	}
+	switch e := s.Expression.(type) {
+	case ast.AssignmentExpr, ast.IncDecExpr:
+		return false
+	case ast.CallExpr:
+		return callPushesValue(e)
+	}
+	return true
+}
+
 func (c *Compiler) compileBlock(block ast.BlockStmt) {
 	for _, stmt := range block.Body {
 		c.compileStmt(stmt)
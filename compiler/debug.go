@@ -1,25 +1,122 @@
 package compiler
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
-// Disassemble retorna uma representação legível do bytecode
-func (c *Compiler) Disassemble() string {
-	var output string
-	for i := 0; i < len(c.Code); i++ {
-		op := c.Code[i]
-		name, ok := OpcodeNames[op]
-		if !ok {
-			name = fmt.Sprintf("UNKNOWN_%02X", op)
+// Instruction é uma instrução decodificada do bytecode
+type Instruction struct {
+	Addr     int
+	Op       byte
+	Info     OpcodeInfo
+	Operands []int // um valor por operando; endereços já combinados
+}
+
+// Decode decodifica a instrução no endereço addr
+func Decode(code []byte, addr int) (Instruction, error) {
+	op := code[addr]
+	info := &OpcodeTable[op]
+	if info.Name == "" {
+		return Instruction{}, fmt.Errorf("unknown opcode 0x%02X at %04d", op, addr)
+	}
+	var operands [MaxOperands]int
+	if _, ok := info.ReadOperands(code, addr, &operands); !ok {
+		return Instruction{}, fmt.Errorf("truncated %s instruction at %04d", info.Name, addr)
+	}
+	return Instruction{Addr: addr, Op: op, Info: *info, Operands: append([]int(nil), operands[:len(info.Operands)]...)}, nil
+}
+
+// Next retorna o endereço da instrução seguinte
+func (inst Instruction) Next() int {
+	return inst.Addr + inst.Info.width
+}
+
+// Format retorna a instrução com os operandos anotados: constantes, destinos
+// de salto, funções chamadas e nomes de símbolos
+func (c *Compiler) Format(inst Instruction) string {
+	args := make([]string, 0, len(inst.Operands))
+	notes := make([]string, 0, len(inst.Operands))
+	slots := c.slotNames()
+	for i, kind := range inst.Info.Operands {
+		val := inst.Operands[i]
+		switch kind {
+		case OperandAddr:
+			args = append(args, fmt.Sprintf("%04d", val))
+			if name, ok := c.FunctionName[val]; ok && inst.Op == OP_CALL {
+				notes = append(notes, name)
+			} else {
+				notes = append(notes, fmt.Sprintf("-> %04d", val))
+			}
+		case OperandConst:
+			args = append(args, strconv.Itoa(val))
+			if val < len(c.ConstPool) {
+				notes = append(notes, formatConst(c.ConstPool[val]))
+			}
+		case OperandSlot:
+			args = append(args, strconv.Itoa(val))
+			if name, ok := slots[val]; ok {
+				notes = append(notes, name)
+			}
+		case OperandReserved:
+			// ignorado pela VM
+		default:
+			args = append(args, strconv.Itoa(val))
+		}
+	}
+
+	text := inst.Info.Name
+	if len(args) > 0 {
+		text += " " + strings.Join(args, " ")
+	}
+	if len(notes) > 0 {
+		text = fmt.Sprintf("%-22s ; %s", text, strings.Join(notes, ", "))
+	}
+	return text
+}
+
+// slotNames inverte a tabela de símbolos (slot -> nome)
+func (c *Compiler) slotNames() map[int]string {
+	names := make(map[int]string, len(c.Symbols))
+	for name, slot := range c.Symbols {
+		if prev, ok := names[slot]; !ok || name < prev {
+			names[slot] = name
 		}
+	}
+	return names
+}
 
-		if HasOperand(op) && i+1 < len(c.Code) {
-			i++
-			output += fmt.Sprintf("%04d: %s %d\n", i-1, name, c.Code[i])
-		} else {
-			output += fmt.Sprintf("%04d: %s\n", i, name)
+func formatConst(val interface{}) string {
+	if s, ok := val.(string); ok {
+		return strconv.Quote(s)
+	}
+	encoded, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%v", val)
+	}
+	return string(encoded)
+}
+
+// Disassemble retorna uma representação legível do bytecode, com um rótulo
+// no início de cada função
+func (c *Compiler) Disassemble() string {
+	var b strings.Builder
+	for addr := 0; addr < len(c.Code); {
+		if name, ok := c.FunctionName[addr]; ok {
+			fmt.Fprintf(&b, "%s:\n", name)
+		}
+		inst, err := Decode(c.Code, addr)
+		if err != nil {
+			fmt.Fprintf(&b, "%04d: %s ; %v\n", addr, OpcodeName(c.Code[addr]), err)
+			addr++
+			continue
 		}
+		fmt.Fprintf(&b, "%04d: %s\n", addr, c.Format(inst))
+		addr = inst.Next()
 	}
-	return output
+	return b.String()
 }
 
 // PrintBytecode imprime o bytecode de forma legível
@@ -62,5 +159,6 @@ func (c *Compiler) Debug() {
 	fmt.Println()
 	fmt.Println("=== Bytecode ===")
 	c.PrintBytecode()
-	fmt.Println("=====================================\n")
+	fmt.Println("=====================================")
+	fmt.Println()
 }
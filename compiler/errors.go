@@ -0,0 +1,86 @@
+package compiler
+
+import "github.com/peiblow/vvm/ast"
+
+// ErrorMeta describes a declared error type. Raising it produces an error
+// object whose code is the error's name and whose details hold one entry
+// per field.
+type ErrorMeta struct {
+	Fields []ErrorField `json:"fields"`
+}
+
+type ErrorField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (c *Compiler) registerErrorDecl(s ast.ErrorDeclStmt) {
+	meta := ErrorMeta{Fields: make([]ErrorField, 0, len(s.Fields))}
+	for _, field := range s.Fields {
+		typeName := ""
+		if sym, ok := field.Type.(ast.SymbolExpr); ok {
+			typeName = sym.Value
+		}
+		meta.Fields = append(meta.Fields, ErrorField{Name: field.Name, Type: typeName})
+	}
+	c.Errors[s.Name] = meta
+}
+
+// compileErrorValue builds the error object for a call to a declared
+// error: {code: Name, message, details: {field: arg, ...}}. An argument
+// past the last field is the message, which otherwise defaults to the
+// error's name.
+func (c *Compiler) compileErrorValue(name string, meta ErrorMeta, args []ast.Expr) {
+	message := ast.Expr(ast.StringExpr{Value: name})
+	if len(args) > len(meta.Fields) {
+		message = args[len(meta.Fields)]
+	}
+	c.compileErrorExpr(ast.ErrorExpr{Code: ast.StringExpr{Value: name}, Message: message})
+
+	c.emit(OP_CONST, c.addConst("details"))
+	c.emit(OP_PUSH_OBJECT)
+	for i, field := range meta.Fields {
+		if i >= len(args) {
+			break
+		}
+		c.emit(OP_CONST, c.addConst(field.Name))
+		c.compileExpr(args[i])
+		c.emit(OP_SET_PROPERTY)
+	}
+	c.emit(OP_SET_PROPERTY)
+}
+
+// compileFailure builds the error object raised by a failed require or
+// check. The message may itself be an error value — Error(code, message)
+// or a declared error — which is used as is; otherwise the object gets
+// code (defaultCode if none was given), message and optional details.
+func (c *Compiler) compileFailure(defaultCode string, code, message, details ast.Expr) {
+	if code == nil && c.isErrorValue(message) {
+		c.noteError(message)
+		c.compileExpr(message)
+		return
+	}
+	if code == nil {
+		code = ast.StringExpr{Value: defaultCode}
+	}
+	c.noteError(code)
+	c.compileErrorExpr(ast.ErrorExpr{Code: code, Message: message})
+	if details != nil {
+		c.emit(OP_CONST, c.addConst("details"))
+		c.compileExpr(details)
+		c.emit(OP_SET_PROPERTY)
+	}
+}
+
+func (c *Compiler) isErrorValue(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case ast.ErrorExpr:
+		return true
+	case ast.CallExpr:
+		if callee, ok := e.Calle.(ast.SymbolExpr); ok {
+			_, declared := c.Errors[callee.Value]
+			return declared
+		}
+	}
+	return false
+}
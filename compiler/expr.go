@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/stdlib"
 )
 
 func (c *Compiler) compileExpr(expr ast.Expr) {
@@ -51,8 +52,23 @@ func (c *Compiler) compileExpr(expr ast.Expr) {
 	}
 }
 
+// numberValue is the value a number literal evaluates to: its source text
+// for a hex literal, which denotes an address, and its number otherwise.
+func numberValue(e ast.NumberExpr) interface{} {
+	if e.Literal != "" {
+		return e.Literal
+	}
+	return e.Value
+}
+
 func (c *Compiler) compileNumber(e ast.NumberExpr) {
-	if e.Value <= 256 {
+	if e.Literal != "" {
+		c.emit(OP_CONST, c.addConst(e.Literal))
+		return
+	}
+	// OP_PUSH carries a single unsigned byte, so only small integral literals
+	// fit; everything else (fractions, negatives, >255) goes through the pool.
+	if e.Value >= 0 && e.Value <= 255 && e.Value == float64(int(e.Value)) {
 		c.emit(OP_PUSH, byte(e.Value))
 	} else {
 		idx := c.addConst(e.Value)
@@ -89,7 +105,7 @@ func (c *Compiler) convertArrayItems(items []ast.Expr) []interface{} {
 	for i, item := range items {
 		switch it := item.(type) {
 		case ast.NumberExpr:
-			result[i] = it.Value
+			result[i] = numberValue(it)
 		case ast.StringExpr:
 			result[i] = it.Value
 		case ast.ArrayLiteralExpr:
@@ -119,7 +135,7 @@ func (c *Compiler) convertObjectToMap(obj ast.ObjectAssignmentExpr) map[string]i
 		// Extract value
 		switch v := field.Value.(type) {
 		case ast.NumberExpr:
-			result[key] = v.Value
+			result[key] = numberValue(v)
 		case ast.StringExpr:
 			result[key] = v.Value
 		case ast.ArrayLiteralExpr:
@@ -164,7 +180,7 @@ func (c *Compiler) compileSymbolAssignment(name string, right ast.Expr) {
 	slot := c.getSlot(name)
 
 	if objExpr, ok := right.(ast.ObjectAssignmentExpr); ok {
-		c.compileObjectAssignment(objExpr, slot)
+		c.compileObjectAssignment(objExpr)
 	} else {
 		c.compileExpr(right)
 	}
@@ -184,9 +200,11 @@ func (c *Compiler) compileMemberAssignment(member ast.MemberExpr, right ast.Expr
 
 	c.compileExpr(right)
 	c.emit(OP_SET_PROPERTY)
+	// SET_PROPERTY updates the stored object in place and pushes it back.
+	c.emit(OP_POP)
 }
 
-func (c *Compiler) compileObjectAssignment(obj ast.ObjectAssignmentExpr, slot int) {
+func (c *Compiler) compileObjectAssignment(obj ast.ObjectAssignmentExpr) {
 	c.emit(OP_PUSH_OBJECT)
 
 	for _, prop := range obj.Fields {
@@ -196,8 +214,6 @@ func (c *Compiler) compileObjectAssignment(obj ast.ObjectAssignmentExpr, slot in
 		c.compileExpr(prop.Value)
 		c.emit(OP_SET_PROPERTY)
 	}
-
-	c.emit(OP_STORE, byte(slot))
 }
 
 func (c *Compiler) compileObjectLiteral(obj ast.ObjectAssignmentExpr) {
@@ -226,6 +242,8 @@ func (c *Compiler) compileBinary(e ast.BinaryExpr) {
 		c.emit(OP_MUL)
 	case "/":
 		c.emit(OP_DIV)
+	case "%":
+		c.emit(OP_MOD)
 	case ">":
 		c.emit(OP_GT)
 	case "<":
@@ -248,6 +266,13 @@ func (c *Compiler) compileBinary(e ast.BinaryExpr) {
 }
 
 func (c *Compiler) compileCall(e ast.CallExpr) {
+	if callee, ok := e.Calle.(ast.SymbolExpr); ok {
+		if meta, isError := c.Errors[callee.Value]; isError {
+			c.compileErrorValue(callee.Value, meta, e.Arguments)
+			return
+		}
+	}
+
 	if callee, ok := e.Calle.(ast.SymbolExpr); ok {
 		if err := c.ValidateFunctionCall(callee.Value, e.Arguments); err != nil {
 			panic(fmt.Sprintf("Type error: %s", err.Error()))
@@ -259,11 +284,11 @@ func (c *Compiler) compileCall(e ast.CallExpr) {
 	}
 
 	if callee, ok := e.Calle.(ast.SymbolExpr); ok {
-		c.compileBuiltinOrUserCall(callee.Value)
+		c.compileBuiltinOrUserCall(callee.Value, len(e.Arguments))
 	}
 }
 
-func (c *Compiler) compileBuiltinOrUserCall(name string) {
+func (c *Compiler) compileBuiltinOrUserCall(name string, argc int) {
 	switch name {
 	case "print":
 		c.emit(OP_PRINT)
@@ -272,7 +297,27 @@ func (c *Compiler) compileBuiltinOrUserCall(name string) {
 	case "require":
 		c.emit(OP_REQUIRE)
 	default:
-		addr := c.Functions[name]
+		addr, isUserFn := c.Functions[name]
+		if _, isBuiltin := stdlib.Lookup(name); isBuiltin && !isUserFn {
+			c.emit(OP_BUILTIN, c.addConst(name), byte(argc))
+			return
+		}
+		if c.Natives[name] && !isUserFn {
+			if c.usedNatives == nil {
+				c.usedNatives = make(map[string]bool)
+			}
+			c.usedNatives[name] = true
+			c.emit(OP_CALL_NATIVE, c.addConst(name), byte(argc))
+			return
+		}
+		c.noteCall(name)
+		if !isUserFn {
+			// Declared further down: compileFunc patches the address.
+			if c.forwardCalls == nil {
+				c.forwardCalls = make(map[string][]int)
+			}
+			c.forwardCalls[name] = append(c.forwardCalls[name], c.currentPos()+1)
+		}
 		c.emit(OP_CALL, byte(addr.Addr>>8), byte(addr.Addr&0xFF))
 	}
 }
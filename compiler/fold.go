@@ -0,0 +1,219 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/peiblow/vvm/ast"
+)
+
+// foldConstant evaluates an expression built only from literals and
+// operators, following the VM's arithmetic rules: whole numbers use checked
+// 64-bit integer math and anything fractional uses float64.
+func foldConstant(expr ast.Expr) (interface{}, error) {
+	switch e := expr.(type) {
+	case ast.NumberExpr:
+		return numberValue(e), nil
+	case ast.StringExpr:
+		return e.Value, nil
+	case ast.BooleanLiteralExpr:
+		return e.Value, nil
+	case ast.NullExpr:
+		return nil, nil
+	case ast.ExpressionStmt:
+		return foldConstant(e.Expression)
+	case ast.ArrayLiteralExpr:
+		items := make([]interface{}, len(e.Items))
+		for i, item := range e.Items {
+			v, err := foldConstant(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+	case ast.ObjectAssignmentExpr:
+		obj := make(map[string]interface{}, len(e.Fields))
+		for _, field := range e.Fields {
+			var key string
+			switch k := field.Key.(type) {
+			case ast.SymbolExpr:
+				key = k.Value
+			case ast.StringExpr:
+				key = k.Value
+			default:
+				return nil, fmt.Errorf("object key must be a name or string, got %T", field.Key)
+			}
+			v, err := foldConstant(field.Value)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = v
+		}
+		return obj, nil
+	case ast.PrefixExpr:
+		v, err := foldConstant(e.RightExpr)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Operator.Literal {
+		case "-":
+			if n, ok := v.(float64); ok {
+				return -n, nil
+			}
+		case "!":
+			if b, ok := v.(bool); ok {
+				return !b, nil
+			}
+		}
+		return nil, fmt.Errorf("operator '%s' cannot be applied to %v", e.Operator.Literal, v)
+	case ast.BinaryExpr:
+		l, err := foldConstant(e.Left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := foldConstant(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		return foldBinary(e.Operator.Literal, l, r)
+	}
+	return nil, fmt.Errorf("%T is not a constant expression", expr)
+}
+
+func foldBinary(op string, l, r interface{}) (interface{}, error) {
+	if !isComparableConst(l) || !isComparableConst(r) {
+		return nil, fmt.Errorf("operator '%s' cannot be applied to arrays or objects", op)
+	}
+
+	switch op {
+	case "==":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	case "&&", "||":
+		lb, lok := l.(bool)
+		rb, rok := r.(bool)
+		if !lok || !rok {
+			return nil, fmt.Errorf("operator '%s' needs booleans", op)
+		}
+		if op == "&&" {
+			return lb && rb, nil
+		}
+		return lb || rb, nil
+	}
+
+	if ls, ok := l.(string); ok && op == "+" {
+		if rs, ok := r.(string); ok {
+			return ls + rs, nil
+		}
+	}
+
+	ln, lok := l.(float64)
+	rn, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator '%s' cannot be applied to %v and %v", op, l, r)
+	}
+
+	switch op {
+	case ">":
+		return ln > rn, nil
+	case ">=":
+		return ln >= rn, nil
+	case "<":
+		return ln < rn, nil
+	case "<=":
+		return ln <= rn, nil
+	}
+
+	li, lWhole, lOverflow := IntegerOperand(ln)
+	ri, rWhole, rOverflow := IntegerOperand(rn)
+	if lWhole && rWhole {
+		if lOverflow || rOverflow {
+			return nil, fmt.Errorf("integer overflow in %v %s %v", ln, op, rn)
+		}
+		return foldIntArith(op, li, ri)
+	}
+	return foldFloatArith(op, ln, rn)
+}
+
+// IntegerOperand reports how checked arithmetic treats n: whole is set for
+// whole numbers, which use int64 math, and overflow for whole numbers
+// outside the int64 range, which cannot. The VM and constant folding both
+// follow it, so neither rounds an out-of-range sum through float64.
+func IntegerOperand(n float64) (value int64, whole, overflow bool) {
+	if n != math.Trunc(n) {
+		return 0, false, false
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, the first value out of range.
+	if n < math.MinInt64 || n >= math.MaxInt64 {
+		return 0, true, true
+	}
+	return int64(n), true, false
+}
+
+func foldIntArith(op string, a, b int64) (interface{}, error) {
+	var result int64
+	switch op {
+	case "+":
+		result = a + b
+		if (b > 0 && result < a) || (b < 0 && result > a) {
+			return nil, fmt.Errorf("integer overflow in %d + %d", a, b)
+		}
+	case "-":
+		result = a - b
+		if (b < 0 && result < a) || (b > 0 && result > a) {
+			return nil, fmt.Errorf("integer overflow in %d - %d", a, b)
+		}
+	case "*":
+		if a != 0 && b != 0 {
+			result = a * b
+			if result/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+				return nil, fmt.Errorf("integer overflow in %d * %d", a, b)
+			}
+		}
+	case "/", "%":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if a == math.MinInt64 && b == -1 {
+			return nil, fmt.Errorf("integer overflow in %d %s %d", a, op, b)
+		}
+		if op == "/" {
+			result = a / b
+		} else {
+			result = a % b
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operator '%s'", op)
+	}
+	return float64(result), nil
+}
+
+func foldFloatArith(op string, a, b float64) (interface{}, error) {
+	var result float64
+	switch op {
+	case "+":
+		result = a + b
+	case "-":
+		result = a - b
+	case "*":
+		result = a * b
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result = a / b
+	case "%":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result = math.Mod(a, b)
+	default:
+		return nil, fmt.Errorf("unsupported operator '%s'", op)
+	}
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return nil, fmt.Errorf("arithmetic overflow in %v %s %v", a, op, b)
+	}
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package compiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/lexer"
+	"github.com/peiblow/vvm/parser"
+)
+
+func TestFoldConstant(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    interface{}
+		wantErr string // "" when the expression folds
+	}{
+		{src: "1 + 2", want: 3.0},
+		{src: "2 * 3 + 1", want: 7.0},
+		{src: "7 / 2", want: 3.0},
+		{src: "7.5 / 2", want: 3.75},
+		{src: "7 % 3", want: 1.0},
+		{src: "-7", want: -7.0},
+		{src: `"a" + "b"`, want: "ab"},
+		{src: "1 < 2", want: true},
+		{src: "true && false", want: false},
+		{src: "[1, 2 * 2]", want: []interface{}{1.0, 4.0}},
+		{src: "{ a: 1 + 1 }", want: map[string]interface{}{"a": 2.0}},
+		{src: "9223372036854775807 + 1", wantErr: "integer overflow"},
+		{src: "10000000000000000000 * 2", wantErr: "integer overflow"},
+		{src: "4611686018427387904 * 2", wantErr: "integer overflow in 4611686018427387904 * 2"},
+		{src: "1 / 0", wantErr: "division by zero"},
+		{src: "1.5 % 0", wantErr: "division by zero"},
+		{src: "[1] + 1", wantErr: "cannot be applied to arrays or objects"},
+		{src: "x + 1", wantErr: "is not a constant expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			program := parser.Parse(lexer.Tokenize(tt.src).Tokens)
+			got, err := foldConstant(program.Body[0].(ast.ExpressionStmt).Expression)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("foldConstant(%s) = %v, %v, want an error containing %q", tt.src, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("foldConstant(%s) = %v", tt.src, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("foldConstant(%s) = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
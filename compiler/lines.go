@@ -0,0 +1,63 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/peiblow/vvm/ast"
+)
+
+// LineEntry maps the first instruction of a statement to its source line.
+// Entries are in ascending PC order; an instruction belongs to the last
+// entry at or before it.
+type LineEntry struct {
+	PC   int `json:"pc"`
+	Line int `json:"line"`
+}
+
+// markLine records that the code emitted next belongs to stmt's line.
+func (c *Compiler) markLine(stmt ast.Stmt) {
+	positioned, ok := stmt.(ast.Positioned)
+	if !ok || positioned.Position().Line == 0 {
+		return
+	}
+	entry := LineEntry{PC: c.currentPos(), Line: positioned.Position().Line}
+
+	if n := len(c.Lines); n > 0 {
+		last := &c.Lines[n-1]
+		if last.PC == entry.PC {
+			last.Line = entry.Line
+			return
+		}
+		if last.Line == entry.Line {
+			return
+		}
+	}
+	c.Lines = append(c.Lines, entry)
+}
+
+// LineAt returns the source line of the instruction at pc, or 0 if the line
+// table does not cover it.
+func (c *Compiler) LineAt(pc int) int {
+	i := sort.Search(len(c.Lines), func(i int) bool { return c.Lines[i].PC > pc })
+	if i == 0 {
+		return 0
+	}
+	return c.Lines[i-1].Line
+}
+
+// IsStatementStart reports whether pc is the first instruction of a line
+// table entry.
+func (c *Compiler) IsStatementStart(pc int) bool {
+	i := sort.Search(len(c.Lines), func(i int) bool { return c.Lines[i].PC >= pc })
+	return i < len(c.Lines) && c.Lines[i].PC == pc
+}
+
+// LinePC returns the first instruction compiled for line.
+func (c *Compiler) LinePC(line int) (int, bool) {
+	for _, entry := range c.Lines {
+		if entry.Line == line {
+			return entry.PC, true
+		}
+	}
+	return 0, false
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "fmt"
+
 // Opcodes da VM
 const (
 	// Fim do programa
@@ -19,7 +21,8 @@ const (
 	OP_ADD = 0x03 // soma valores do topo da stack
 	OP_SUB = 0x04 // subtração
 	OP_MUL = 0x05 // multiplicação
-	OP_DIV = 0x06 // divisão
+	OP_DIV = 0x06 // divisão (inteira se ambos operandos forem inteiros)
+	OP_MOD = 0x23 // resto da divisão
 
 	// Operações de comparação
 	OP_GT      = 0x07 // maior que
@@ -43,14 +46,18 @@ const (
 	OP_NOP     = 0x12 // instrução nula
 
 	// Controle de fluxo
-	OP_JMP    = 0x13 // salto incondicional
-	OP_JMP_IF = 0x14 // salto condicional (se falso)
-	OP_CALL   = 0x15 // chamada de função
-	OP_RET    = 0x16 // retorno de função
+	OP_JMP         = 0x13 // salto incondicional
+	OP_JMP_IF      = 0x14 // salto condicional (se falso)
+	OP_CALL        = 0x15 // chamada de função
+	OP_RET         = 0x16 // retorno de função
+	OP_BUILTIN     = 0x26 // chama função da stdlib (nome, nº de argumentos)
+	OP_CALL_NATIVE = 0x27 // chama função nativa registrada pelo host (nome, nº de argumentos)
 
 	// Operações de array
-	OP_ACCESS = 0x17 // acessa item específico do array
-	OP_LENGTH = 0x19 // retorna tamanho de um array
+	OP_ACCESS     = 0x17 // acessa item específico do array
+	OP_LENGTH     = 0x19 // retorna tamanho de um array
+	OP_ITER_KEYS  = 0x24 // índices do array ou chaves ordenadas do objeto
+	OP_ITER_ITEMS = 0x25 // elementos do array ou chaves ordenadas do objeto
 
 	// Valores especiais
 	OP_NULL = 0x18 // valor nulo
@@ -61,9 +68,10 @@ const (
 	OP_DELETE = 0x1E // remove valor da storage
 
 	// Registry (persistente)
-	OP_AGENT_DECLARE  = 0x1C // armazena valor na memória
-	OP_AGENT_GET      = 0x1D // carrega valor da memória
-	OP_AGENT_VALIDATE = 0x1F // validates agent against registry
+	OP_AGENT_DECLARE    = 0x1C // cria o registro do agente a partir dos campos declarados
+	OP_REGISTRY_GET     = 0x1D // carrega entrada do registry pelo nome
+	OP_AGENT_VALIDATE   = 0x1F // valida o agente contra a entrada do registry
+	OP_REGISTRY_DECLARE = 0x28 // cria entrada do registry (Model, Dataset, Tool)
 
 	OP_POLICY_DECLARE = 0x4F // declara política
 	OP_TYPE_DECLARE   = 0x5F // declara tipo
@@ -74,6 +82,10 @@ const (
 	OP_ERR     = 0x53 // lança erro/exceção
 	OP_TRY     = 0x54 // inicia bloco try
 	OP_END_TRY = 0x55 // finaliza bloco try-catch
+	OP_CHECK   = 0x56 // registra falha de check e continua a execução
+
+	// Testes
+	OP_EXPECT_EMIT = 0x57 // falha o teste se o evento esperado não foi emitido
 
 	// Objetos
 	OP_PUSH_OBJECT  = 0x60 // cria objeto vazio na pilha
@@ -81,61 +93,165 @@ const (
 	OP_GET_PROPERTY = 0x62 // obtém propriedade de objeto
 )
 
-// OpcodeNames mapeia opcodes para seus nomes (útil para debug)
-var OpcodeNames = map[byte]string{
-	OP_HALT:          "HALT",
-	OP_CONST:         "CONST",
-	OP_PUSH:          "PUSH",
-	OP_POP:           "POP",
-	OP_DUP:           "DUP",
-	OP_SWAP:          "SWAP",
-	OP_ADD:           "ADD",
-	OP_SUB:           "SUB",
-	OP_MUL:           "MUL",
-	OP_DIV:           "DIV",
-	OP_GT:            "GT",
-	OP_GT_EQ:         "GT_EQ",
-	OP_LT:            "LT",
-	OP_LT_EQ:         "LT_EQ",
-	OP_EQ:            "EQ",
-	OP_DIFF:          "DIFF",
-	OP_PLUS_EQ:       "PLUS_EQ",
-	OP_AND:           "AND",
-	OP_OR:            "OR",
-	OP_NOT:           "NOT",
-	OP_PRINT:         "PRINT",
-	OP_NOP:           "NOP",
-	OP_JMP:           "JMP",
-	OP_JMP_IF:        "JMP_IF",
-	OP_CALL:          "CALL",
-	OP_RET:           "RET",
-	OP_ACCESS:        "ACCESS",
-	OP_LENGTH:        "LENGTH",
-	OP_NULL:          "NULL",
-	OP_STORE:         "STORE",
-	OP_SLOAD:         "SLOAD",
-	OP_DELETE:        "DELETE",
-	OP_EMIT:          "EMIT",
-	OP_GET_ENV:       "GET_ENV",
-	OP_HASH:          "HASH",
-	OP_NONCE:         "NONCE",
-	OP_REQUIRE:       "REQUIRE",
-	OP_AGENT_DECLARE: "REGISTRY_DECLARE",
-	OP_AGENT_GET:     "REGISTRY_GET",
-	OP_ERR:           "ERR",
-	OP_TRY:           "TRY",
-	OP_END_TRY:       "END_TRY",
-	OP_PUSH_OBJECT:   "PUSH_OBJECT",
-	OP_SET_PROPERTY:  "SET_PROPERTY",
-	OP_GET_PROPERTY:  "GET_PROPERTY",
+// OperandKind descreve o significado de um operando no bytecode
+type OperandKind int
+
+const (
+	OperandImm      OperandKind = iota // valor imediato de 1 byte
+	OperandConst                       // índice no pool de constantes
+	OperandSlot                        // slot da storage
+	OperandCount                       // número de valores consumidos da pilha
+	OperandAddr                        // endereço de 2 bytes (big-endian)
+	OperandReserved                    // byte reservado, ignorado pela VM
+)
+
+// Size retorna quantos bytes o operando ocupa
+func (k OperandKind) Size() int {
+	if k == OperandAddr {
+		return 2
+	}
+	return 1
+}
+
+// StackVaries marca efeitos de pilha que dependem dos operandos ou da função chamada
+const StackVaries = -1
+
+// OpcodeInfo descreve um opcode: nome, layout dos operandos e efeito na pilha
+type OpcodeInfo struct {
+	Name     string
+	Operands []OperandKind
+	Pops     int // valores consumidos (StackVaries se depende dos operandos)
+	Pushes   int // valores empilhados
+	width    int // tamanho em bytes, calculado por describe
 }
 
-// HasOperand retorna true se o opcode requer um operando
-func HasOperand(op byte) bool {
-	switch op {
-	case OP_PUSH, OP_CONST, OP_STORE, OP_SLOAD,
-		OP_CALL, OP_JMP, OP_JMP_IF:
-		return true
+// Width retorna o tamanho da instrução em bytes, incluindo o opcode
+func (info *OpcodeInfo) Width() int {
+	return info.width
+}
+
+// MaxOperands é o maior número de operandos de uma instrução
+const MaxOperands = 2
+
+// ReadOperands lê os operandos da instrução em addr, sem alocar, e retorna o
+// endereço da instrução seguinte. ok é falso se a instrução está truncada.
+func (info *OpcodeInfo) ReadOperands(code []byte, addr int, operands *[MaxOperands]int) (next int, ok bool) {
+	next = addr + info.width
+	if next > len(code) {
+		return addr, false
+	}
+	pos := addr + 1
+	for i, kind := range info.Operands {
+		if kind == OperandAddr {
+			operands[i] = int(code[pos])<<8 | int(code[pos+1])
+		} else {
+			operands[i] = int(code[pos])
+		}
+		pos += kind.Size()
+	}
+	return next, true
+}
+
+func describe(name string, pops, pushes int, operands ...OperandKind) OpcodeInfo {
+	if len(operands) > MaxOperands {
+		panic(fmt.Sprintf("opcode %s has %d operands (max %d)", name, len(operands), MaxOperands))
+	}
+	width := 1
+	for _, k := range operands {
+		width += k.Size()
+	}
+	return OpcodeInfo{Name: name, Operands: operands, Pops: pops, Pushes: pushes, width: width}
+}
+
+// Opcodes é a tabela de descritores usada pelo compilador, pela VM e pelo disassembler
+var Opcodes = map[byte]OpcodeInfo{
+	OP_HALT:  describe("HALT", 0, 0),
+	OP_TRUE:  describe("TRUE", 0, 1),
+	OP_FALSE: describe("FALSE", 0, 1),
+
+	OP_CONST: describe("CONST", 0, 1, OperandConst),
+	OP_PUSH:  describe("PUSH", 0, 1, OperandImm),
+	OP_POP:   describe("POP", 1, 0),
+	OP_DUP:   describe("DUP", 1, 2),
+	OP_SWAP:  describe("SWAP", 2, 2),
+
+	OP_ADD: describe("ADD", 2, 1),
+	OP_SUB: describe("SUB", 2, 1),
+	OP_MUL: describe("MUL", 2, 1),
+	OP_DIV: describe("DIV", 2, 1),
+	OP_MOD: describe("MOD", 2, 1),
+
+	OP_GT:      describe("GT", 2, 1),
+	OP_GT_EQ:   describe("GT_EQ", 2, 1),
+	OP_LT:      describe("LT", 2, 1),
+	OP_LT_EQ:   describe("LT_EQ", 2, 1),
+	OP_EQ:      describe("EQ", 2, 1),
+	OP_DIFF:    describe("DIFF", 2, 1),
+	OP_PLUS_EQ: describe("PLUS_EQ", 2, 1),
+
+	OP_AND: describe("AND", 2, 1),
+	OP_OR:  describe("OR", 2, 1),
+	OP_NOT: describe("NOT", 1, 1),
+
+	OP_PRINT:   describe("PRINT", 1, 0),
+	OP_GET_ENV: describe("GET_ENV", 1, 1, OperandConst),
+	OP_HASH:    describe("HASH", StackVaries, 1, OperandCount),
+	OP_NONCE:   describe("NONCE", 1, 1),
+	OP_NOP:     describe("NOP", 0, 0),
+
+	OP_JMP:         describe("JMP", 0, 0, OperandAddr),
+	OP_JMP_IF:      describe("JMP_IF", 1, 0, OperandAddr),
+	OP_CALL:        describe("CALL", StackVaries, 0, OperandAddr),
+	OP_RET:         describe("RET", 0, 0),
+	OP_BUILTIN:     describe("BUILTIN", StackVaries, 1, OperandConst, OperandCount),
+	OP_CALL_NATIVE: describe("CALL_NATIVE", StackVaries, 1, OperandConst, OperandCount),
+
+	OP_ACCESS:     describe("ACCESS", 2, 1),
+	OP_LENGTH:     describe("LENGTH", 1, 1),
+	OP_ITER_KEYS:  describe("ITER_KEYS", 1, 1),
+	OP_ITER_ITEMS: describe("ITER_ITEMS", 1, 1),
+
+	OP_NULL: describe("NULL", 0, 1),
+
+	OP_STORE:  describe("STORE", 1, 0, OperandSlot),
+	OP_SLOAD:  describe("SLOAD", 0, 1, OperandSlot),
+	OP_DELETE: describe("DELETE", 0, 0, OperandSlot),
+
+	OP_AGENT_DECLARE:    describe("AGENT_DECLARE", 1, 1, OperandConst),
+	OP_REGISTRY_GET:     describe("REGISTRY_GET", 0, 1, OperandConst),
+	OP_AGENT_VALIDATE:   describe("AGENT_VALIDATE", 2, 1),
+	OP_REGISTRY_DECLARE: describe("REGISTRY_DECLARE", 1, 1, OperandConst, OperandConst),
+
+	OP_POLICY_DECLARE: describe("POLICY_DECLARE", 2, 1, OperandConst),
+	OP_TYPE_DECLARE:   describe("TYPE_DECLARE", 2, 1, OperandConst),
+
+	OP_EMIT:    describe("EMIT", 2, 0, OperandReserved),
+	OP_REQUIRE: describe("REQUIRE", 2, 0),
+	OP_ERR:     describe("ERR", 1, 0),
+	OP_TRY:     describe("TRY", 0, 0, OperandAddr, OperandSlot),
+	OP_END_TRY: describe("END_TRY", 0, 0),
+	OP_CHECK:   describe("CHECK", 1, 0),
+
+	OP_EXPECT_EMIT: describe("EXPECT_EMIT", 2, 0),
+
+	OP_PUSH_OBJECT:  describe("PUSH_OBJECT", 0, 1),
+	OP_SET_PROPERTY: describe("SET_PROPERTY", 3, 1),
+	OP_GET_PROPERTY: describe("GET_PROPERTY", 2, 1),
+}
+
+// OpcodeTable indexa os descritores pelo byte do opcode, para a VM despachar
+// cada instrução sem consultar o mapa. Opcodes desconhecidos têm Name vazio.
+var OpcodeTable = func() (table [256]OpcodeInfo) {
+	for op, info := range Opcodes {
+		table[op] = info
+	}
+	return table
+}()
+
+// OpcodeName retorna o nome do opcode (UNKNOWN_XX se não estiver na tabela)
+func OpcodeName(op byte) string {
+	if info, ok := Opcodes[op]; ok {
+		return info.Name
 	}
-	return false
+	return fmt.Sprintf("UNKNOWN_%02X", op)
 }
@@ -0,0 +1,203 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/stdlib"
+)
+
+// Policy metadata keys. They are kept in the policy object like any rule,
+// but also describe which version of the policy applies when.
+const (
+	PolicyVersionKey        = "version"
+	PolicyEffectiveFromKey  = "effective_from"
+	PolicyEffectiveUntilKey = "effective_until"
+)
+
+// PolicyMeta records where a policy lives in storage. Unversioned policies
+// are stored directly in Slot. Versioned policies keep each version in its
+// own slot, and the VM copies the one in force at execution time into Slot.
+type PolicyMeta struct {
+	Slot     int                 `json:"slot"`
+	Versions []PolicyVersionMeta `json:"versions,omitempty"`
+	Doc      string              `json:"doc,omitempty"` // unversioned policies only
+}
+
+// PolicyVersionMeta describes one version of a policy. The window is
+// [EffectiveFrom, EffectiveUntil) in Unix seconds; 0 leaves that side open.
+type PolicyVersionMeta struct {
+	Version        string `json:"version"`
+	EffectiveFrom  int64  `json:"effective_from,omitempty"`
+	EffectiveUntil int64  `json:"effective_until,omitempty"`
+	Slot           int    `json:"slot"`
+	Doc            string `json:"doc,omitempty"`
+}
+
+// ActiveAt reports whether the version is in force at the given Unix time.
+func (v PolicyVersionMeta) ActiveAt(ts int64) bool {
+	if v.EffectiveFrom != 0 && ts < v.EffectiveFrom {
+		return false
+	}
+	if v.EffectiveUntil != 0 && ts >= v.EffectiveUntil {
+		return false
+	}
+	return true
+}
+
+// ParsePolicyTime parses an effective date written as YYYY-MM-DD (midnight
+// UTC) or as an RFC 3339 timestamp.
+func ParsePolicyTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// policyVersion extracts the version metadata of a policy declaration. ok
+// is false for policies that declare none of the metadata keys.
+func policyVersion(s ast.PolicyStmt) (meta PolicyVersionMeta, ok bool) {
+	for _, rule := range s.Rules {
+		str, isString := rule.Value.(ast.StringExpr)
+		switch rule.Key {
+		case PolicyVersionKey:
+			meta.Version = symbolValue(rule.Value)
+			ok = true
+		case PolicyEffectiveFromKey, PolicyEffectiveUntilKey:
+			if !isString {
+				panic(fmt.Sprintf("policy '%s': %s must be a date string", symbolValue(s.Identifier), rule.Key))
+			}
+			t, err := ParsePolicyTime(str.Value)
+			if err != nil {
+				panic(fmt.Sprintf("policy '%s': invalid %s %q", symbolValue(s.Identifier), rule.Key, str.Value))
+			}
+			if rule.Key == PolicyEffectiveFromKey {
+				meta.EffectiveFrom = t.Unix()
+			} else {
+				meta.EffectiveUntil = t.Unix()
+			}
+			ok = true
+		}
+	}
+	return meta, ok
+}
+
+func symbolValue(expr ast.Expr) string {
+	switch v := expr.(type) {
+	case ast.SymbolExpr:
+		return v.Value
+	case ast.StringExpr:
+		return v.Value
+	case ast.NumberExpr:
+		if v.Literal != "" {
+			return v.Literal
+		}
+		return fmt.Sprintf("%v", v.Value)
+	}
+	return fmt.Sprintf("%v", expr)
+}
+
+// Param provenance sources.
+const (
+	ParamSourceDefault = "default"
+	ParamSourceDeploy  = "deploy"
+)
+
+// ParamValue records the effective value of a `param` policy rule and
+// where it came from.
+type ParamValue struct {
+	Value   interface{} `json:"value"`
+	Default interface{} `json:"default"`
+	Source  string      `json:"source"`
+}
+
+// resolveParam returns the effective value of a param rule. Overrides are
+// keyed "Policy.rule", or "Policy@version.rule" to target a single version
+// of a versioned policy. An override must have the same kind as the value
+// written in source, unless that value is null, and a number must also be
+// whole, or not negative, when that value is.
+func (c *Compiler) resolveParam(policy, version, rule string, def interface{}) interface{} {
+	key := policy + "." + rule
+	if version != "" {
+		key = policy + "@" + version + "." + rule
+	}
+
+	param := ParamValue{Value: def, Default: def, Source: ParamSourceDefault}
+	for _, name := range []string{key, policy + "." + rule} {
+		override, ok := c.Params[name]
+		if !ok {
+			continue
+		}
+		c.usedParams[name] = true
+		if problem := paramMismatch(def, override); problem != "" {
+			c.paramErrors = append(c.paramErrors, fmt.Sprintf("param '%s' %s", name, problem))
+			break
+		}
+		param.Value = override
+		param.Source = ParamSourceDeploy
+		break
+	}
+
+	c.ParamValues[key] = param
+	return param.Value
+}
+
+// paramMismatch explains why override cannot replace the default value
+// def, or returns "" when it can.
+func paramMismatch(def, override interface{}) string {
+	want, got := stdlib.KindOf(def), stdlib.KindOf(override)
+	if want == stdlib.Null {
+		return ""
+	}
+	if got != want {
+		return fmt.Sprintf("must be %s, got %s", want, got)
+	}
+	d, dok := paramNumber(def)
+	o, ook := paramNumber(override)
+	if !dok || !ook {
+		return ""
+	}
+	if d == math.Trunc(d) && o != math.Trunc(o) {
+		return fmt.Sprintf("must be a whole number like its default %v, got %v", d, o)
+	}
+	if d >= 0 && o < 0 {
+		return fmt.Sprintf("must not be negative like its default %v, got %v", d, o)
+	}
+	return ""
+}
+
+func paramNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// CheckParams reports deploy-time overrides that were rejected or that do
+// not name a `param` rule of the contract.
+func (c *Compiler) CheckParams() error {
+	problems := append([]string(nil), c.paramErrors...)
+	var unknown []string
+	for name := range c.Params {
+		if !c.usedParams[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("param '%s' does not match any policy rule declared with param", name))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid params: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -2,16 +2,31 @@ package compiler
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/peiblow/vvm/ast"
 )
 
 func (c *Compiler) compileStmt(stmt ast.Stmt) {
+	// Functions mark their own entry; a contract only groups statements.
+	switch stmt.(type) {
+	case ast.FuncStmt, ast.ContractStmt:
+	default:
+		c.markLine(stmt)
+	}
+
 	switch s := stmt.(type) {
 	case ast.ContractStmt:
 		c.compileContract(s)
 	case ast.ExpressionStmt:
 		c.compileExpr(s.Expression)
+		if c.isErrorValue(s.Expression) {
+			// A declared error called as a statement raises it.
+			c.noteError(s.Expression)
+			c.emit(OP_ERR)
+		} else if call, ok := s.Expression.(ast.CallExpr); ok && callPushesValue(call) {
+			c.emit(OP_POP)
+		}
 	case ast.VarDeclStmt:
 		c.compileVarDecl(s)
 	case ast.ReturnStmt:
@@ -24,10 +39,16 @@ func (c *Compiler) compileStmt(stmt ast.Stmt) {
 		c.compileFor(s)
 	case ast.WhileStmt:
 		c.compileWhile(s)
+	case ast.ForEachStmt:
+		c.compileForEach(s)
 	case ast.RequireStmt:
 		c.compileRequire(s)
+	case ast.CheckStmt:
+		c.compileCheck(s)
 	case ast.AgentStmt:
 		c.compileAgentStmt(s)
+	case ast.RegistryStmt:
+		c.compileRegistryStmt(s)
 	case ast.PolicyStmt:
 		c.compilePolicyStmt(s)
 	case ast.TypeDeclareStmt:
@@ -36,14 +57,49 @@ func (c *Compiler) compileStmt(stmt ast.Stmt) {
 		c.compileEmitStmt(s)
 	case ast.TryCatchStmt:
 		c.compileTryCatchStmt(s)
+	case ast.ErrorDeclStmt:
+		// Registered up front by compileContract; emits no code.
+	case ast.ExpectStmt:
+		c.compileExpect(s)
+	case ast.ExpectRevertStmt:
+		c.compileExpectRevert(s)
+	case ast.ExpectEmitStmt:
+		c.compileExpectEmit(s)
+	case ast.BreakStmt:
+		c.compileBreak()
+	case ast.ContinueStmt:
+		c.compileContinue()
 	default:
 		fmt.Printf("Unrecognized statement type: %T\n", s)
 	}
 }
 
 func (c *Compiler) compileContract(s ast.ContractStmt) {
+	// Registry entries are declared first so agents can be validated
+	// against them wherever they appear in the source, and error types so
+	// functions can raise them before their declaration.
 	for _, stmt := range s.Body {
-		c.compileStmt(stmt)
+		switch decl := stmt.(type) {
+		case ast.RegistryStmt:
+			c.compileRegistryStmt(decl)
+		case ast.ErrorDeclStmt:
+			c.registerErrorDecl(decl)
+		}
+	}
+	for _, stmt := range s.Body {
+		switch stmt.(type) {
+		case ast.RegistryStmt, ast.TestStmt:
+		default:
+			c.compileStmt(stmt)
+		}
+	}
+	// Tests come last so they can call every function of the contract.
+	if c.CompileTests {
+		for _, stmt := range s.Body {
+			if test, ok := stmt.(ast.TestStmt); ok {
+				c.compileTest(test)
+			}
+		}
 	}
 }
 
@@ -76,8 +132,11 @@ func (c *Compiler) compileVarDecl(s ast.VarDeclStmt) {
 func (c *Compiler) compileReturn(s ast.ReturnStmt) {
 	if s.Value != nil {
 		c.compileExpr(s.Value)
+	} else if c.isInFunction {
+		c.emit(OP_NULL)
 	}
 	if c.isInFunction {
+		c.closeTryFrames(c.funcTryDepth)
 		c.emit(OP_RET)
 	} else {
 		c.emit(OP_PRINT)
@@ -89,22 +148,44 @@ func (c *Compiler) compileFunc(s ast.FuncStmt) {
 
 	prevInFunction := c.isInFunction
 	c.isInFunction = true
+	prevFuncTryDepth := c.funcTryDepth
+	c.funcTryDepth = c.tryDepth
+	prevFunction, prevScope := c.function, c.scope
+	c.function = &functionUse{
+		args:       make(map[string]string),
+		errorScope: newErrorScope(),
+	}
+	c.scope = c.function.errorScope
+	if c.uses == nil {
+		c.uses = make(map[string]*functionUse)
+	}
+	c.uses[funcName] = c.function
 
 	skipFuncPos := c.currentPos()
 	c.emit(OP_JMP, 0, 0)
+	c.markLine(s)
 
 	funcMeta := FunctionMeta{
-		Addr:    c.currentPos(),
-		Args:    []int{},
-		ArgMeta: []ArgMeta{},
+		Addr:       c.currentPos(),
+		Args:       []int{},
+		ArgMeta:    []ArgMeta{},
+		ReturnType: TypeName(s.ReturnType),
+		Doc:        s.Doc,
 	}
 
 	slots, argMeta := c.compileFuncArgs(s.Arguments)
 	funcMeta.Args = slots
 	funcMeta.ArgMeta = argMeta
+	for _, arg := range argMeta {
+		c.function.args[arg.Name] = arg.TypeName
+	}
 
 	c.Functions[funcName] = funcMeta
 	c.FunctionName[c.currentPos()] = funcName
+	for _, pos := range c.forwardCalls[funcName] {
+		c.patchJump(pos, funcMeta.Addr)
+	}
+	delete(c.forwardCalls, funcName)
 
 	c.compileFuncBody(s.Body)
 
@@ -112,6 +193,8 @@ func (c *Compiler) compileFunc(s ast.FuncStmt) {
 
 	c.patchJump(skipFuncPos+1, c.currentPos())
 	c.isInFunction = prevInFunction
+	c.funcTryDepth = prevFuncTryDepth
+	c.function, c.scope = prevFunction, prevScope
 }
 
 func (c *Compiler) extractFuncName(name ast.Expr) string {
@@ -164,14 +247,42 @@ func (c *Compiler) compileFuncBody(body ast.Stmt) {
 	}
 }
 
+// emitFuncReturn ends a function body. Falling off the end returns null, so
+// every call leaves exactly one value on the stack.
 func (c *Compiler) emitFuncReturn(returnType ast.Type) {
+	c.emit(OP_NULL)
 	c.emit(OP_RET)
 }
 
+// callPushesValue reports whether a call leaves a result on the stack.
+// print and require consume their arguments and push nothing.
+func callPushesValue(call ast.CallExpr) bool {
+	if callee, ok := call.Calle.(ast.SymbolExpr); ok {
+		switch callee.Value {
+		case "print", "require":
+			return false
+		}
+	}
+	return true
+}
+
+// TypeName renders a declared type the way it is written in source, e.g.
+// "UInt" or "[]Decision".
+func TypeName(t ast.Type) string {
+	switch v := t.(type) {
+	case ast.SymbolType:
+		return v.Name
+	case ast.ArrayType:
+		return "[]" + TypeName(v.Underlying)
+	}
+	return ""
+}
+
 func (c *Compiler) compileIf(s ast.IfStmt) {
 	c.compileExpr(s.Condition)
 
 	jmpIfPos := c.currentPos()
+	c.addTracePoint(jmpIfPos, TraceBranch, s.Condition, nil)
 	c.emit(OP_JMP_IF, 0, 0)
 
 	c.compileIfBlock(s.Then)
@@ -208,15 +319,18 @@ func (c *Compiler) compileFor(s ast.ForStmt) {
 	c.emit(OP_JMP_IF, 0, 0)
 	jmpExitPos := c.currentPos()
 
+	c.pushLoop()
 	for _, stmt := range s.Body {
 		c.compileStmt(stmt)
 	}
 
+	continuePos := c.currentPos()
 	c.compileStmt(s.Post)
 
 	c.emit(OP_JMP, byte(condPos>>8), byte(condPos&0xFF))
 
 	c.patchJump(jmpExitPos-2, c.currentPos())
+	c.popLoop(continuePos, c.currentPos())
 }
 
 func (c *Compiler) compileWhile(s ast.WhileStmt) {
@@ -225,26 +339,142 @@ func (c *Compiler) compileWhile(s ast.WhileStmt) {
 	c.emit(OP_JMP_IF, 0, 0)
 	jmpExitPos := c.currentPos()
 
+	c.pushLoop()
+	for _, stmt := range s.Body {
+		c.compileStmt(stmt)
+	}
+
+	c.emit(OP_JMP, byte(condPos>>8), byte(condPos&0xFF))
+
+	c.patchJump(jmpExitPos-2, c.currentPos())
+	c.popLoop(condPos, c.currentPos())
+}
+
+// compileForEach desugars `for (k, v in coll)` into an index loop over a
+// list built by the iterator opcodes. OP_ITER_KEYS yields array indexes or
+// the object's keys in sorted order, so iteration is deterministic; the
+// single-variable form walks OP_ITER_ITEMS instead (array elements, or
+// object keys).
+func (c *Compiler) compileForEach(s ast.ForEachStmt) {
+	collSlot := c.allocSlot(fmt.Sprintf("__foreach_coll_%d__", c.NextSlot))
+	listSlot := c.allocSlot(fmt.Sprintf("__foreach_list_%d__", c.NextSlot))
+	idxSlot := c.allocSlot(fmt.Sprintf("__foreach_idx_%d__", c.NextSlot))
+
+	c.compileExpr(s.Iterable)
+	c.emit(OP_STORE, byte(collSlot))
+	c.emit(OP_SLOAD, byte(collSlot))
+	if s.Key != "" {
+		c.emit(OP_ITER_KEYS)
+	} else {
+		c.emit(OP_ITER_ITEMS)
+	}
+	c.emit(OP_STORE, byte(listSlot))
+	c.emit(OP_PUSH, 0)
+	c.emit(OP_STORE, byte(idxSlot))
+
+	condPos := c.currentPos()
+	c.emit(OP_SLOAD, byte(idxSlot))
+	c.emit(OP_SLOAD, byte(listSlot))
+	c.emit(OP_LENGTH)
+	c.emit(OP_LT)
+	c.emit(OP_JMP_IF, 0, 0)
+	jmpExitPos := c.currentPos()
+
+	c.emit(OP_SLOAD, byte(listSlot))
+	c.emit(OP_SLOAD, byte(idxSlot))
+	c.emit(OP_ACCESS)
+	if s.Key != "" {
+		keySlot := c.getSlot(s.Key)
+		c.emit(OP_STORE, byte(keySlot))
+		c.emit(OP_SLOAD, byte(collSlot))
+		c.emit(OP_SLOAD, byte(keySlot))
+		c.emit(OP_ACCESS)
+	}
+	c.emit(OP_STORE, byte(c.getSlot(s.Value)))
+
+	c.pushLoop()
 	for _, stmt := range s.Body {
 		c.compileStmt(stmt)
 	}
 
+	continuePos := c.currentPos()
+	c.emit(OP_SLOAD, byte(idxSlot))
+	c.emit(OP_PUSH, 1)
+	c.emit(OP_ADD)
+	c.emit(OP_STORE, byte(idxSlot))
 	c.emit(OP_JMP, byte(condPos>>8), byte(condPos&0xFF))
 
 	c.patchJump(jmpExitPos-2, c.currentPos())
+	c.popLoop(continuePos, c.currentPos())
+}
+
+// loopContext collects the break/continue jumps of the loop being compiled.
+// Their targets are only known once the whole loop has been emitted, so the
+// jumps are recorded here and patched by popLoop.
+type loopContext struct {
+	breaks    []int
+	continues []int
+	tryDepth  int
+}
+
+func (c *Compiler) pushLoop() {
+	c.loops = append(c.loops, &loopContext{tryDepth: c.tryDepth})
+}
+
+func (c *Compiler) popLoop(continueTarget int, breakTarget int) {
+	loop := c.loops[len(c.loops)-1]
+	c.loops = c.loops[:len(c.loops)-1]
+
+	for _, pos := range loop.breaks {
+		c.patchJump(pos+1, breakTarget)
+	}
+	for _, pos := range loop.continues {
+		c.patchJump(pos+1, continueTarget)
+	}
+}
+
+func (c *Compiler) compileBreak() {
+	loop := c.innermostLoop("break")
+	c.closeTryFrames(loop.tryDepth)
+	loop.breaks = append(loop.breaks, c.currentPos())
+	c.emit(OP_JMP, 0, 0)
+}
+
+func (c *Compiler) compileContinue() {
+	loop := c.innermostLoop("continue")
+	c.closeTryFrames(loop.tryDepth)
+	loop.continues = append(loop.continues, c.currentPos())
+	c.emit(OP_JMP, 0, 0)
+}
+
+func (c *Compiler) innermostLoop(keyword string) *loopContext {
+	if len(c.loops) == 0 {
+		panic(fmt.Sprintf("'%s' used outside of a loop", keyword))
+	}
+	return c.loops[len(c.loops)-1]
+}
+
+// closeTryFrames pops the try frames opened since depth — inside the loop
+// body for break and continue, inside the function for return — since
+// jumping out of a try block would otherwise leave its handler installed.
+func (c *Compiler) closeTryFrames(depth int) {
+	for i := depth; i < c.tryDepth; i++ {
+		c.emit(OP_END_TRY)
+	}
 }
 
 func (c *Compiler) compileRequire(s ast.RequireStmt) {
 	c.compileExpr(s.Condition)
 
 	jmpToErrorPos := c.currentPos()
+	c.addTracePoint(jmpToErrorPos, TraceRequire, s.Condition, s.Message)
 	c.emit(OP_JMP_IF, 0, 0)
 
 	jmpPastErrorPos := c.currentPos()
 	c.emit(OP_JMP, 0, 0)
 
 	errorBlockPos := c.currentPos()
-	c.compileExpr(s.Message)
+	c.compileFailure("REQUIRE_FAILED", s.Code, s.Message, s.Details)
 	c.emit(OP_ERR)
 
 	endPos := c.currentPos()
@@ -253,52 +483,122 @@ func (c *Compiler) compileRequire(s ast.RequireStmt) {
 	c.patchJump(jmpPastErrorPos+1, endPos)
 }
 
-func (c *Compiler) compileRegistryAgentDeclare(s ast.AgentStmt) {
-	nameIdx := c.addConst(s.Identifier)
-	c.emit(OP_CONST, nameIdx)
-	versionIdx := c.addConst(s.Version)
-	c.emit(OP_CONST, versionIdx)
-	ownerIdx := c.addConst(s.Owner)
-	c.emit(OP_CONST, ownerIdx)
-	purposeIdx := c.addConst(s.Purpose)
-	c.emit(OP_CONST, purposeIdx)
+// compileCheck is compileRequire with OP_CHECK in place of OP_ERR: the
+// failure is recorded and execution carries on after the statement.
+func (c *Compiler) compileCheck(s ast.CheckStmt) {
+	c.compileExpr(s.Condition)
+
+	jmpToFailurePos := c.currentPos()
+	c.addTracePoint(jmpToFailurePos, TraceCheck, s.Condition, s.Message)
+	c.emit(OP_JMP_IF, 0, 0)
+
+	jmpPastFailurePos := c.currentPos()
+	c.emit(OP_JMP, 0, 0)
+
+	failurePos := c.currentPos()
+	c.noteError(ast.StringExpr{Value: "CHECK_FAILED"})
+	c.compileFailure("CHECK_FAILED", s.Code, s.Message, s.Details)
+	c.emit(OP_CHECK)
+
+	endPos := c.currentPos()
+
+	c.patchJump(jmpToFailurePos+1, failurePos)
+	c.patchJump(jmpPastFailurePos+1, endPos)
+}
+
+// compileRegistryStmt stores a registry entry under a hidden slot, keyed by
+// name in c.Registries.
+func (c *Compiler) compileRegistryStmt(s ast.RegistryStmt) {
+	name := s.Identifier.(ast.SymbolExpr).Value
+	slot := c.allocSlot("registry:" + name)
+	c.Registries[name] = slot
 
-	c.emit(
-		OP_AGENT_DECLARE,
-		byte(nameIdx),
-		byte(versionIdx),
-		byte(ownerIdx),
-		byte(purposeIdx),
-	)
+	c.emit(OP_PUSH_OBJECT)
+	for _, field := range byKey(s.Fields, func(f ast.MetadataField) string { return f.Key }) {
+		c.emit(OP_CONST, c.addConst(field.Key))
+		c.compileExpr(field.Value)
+		c.emit(OP_SET_PROPERTY)
+	}
+
+	c.emit(OP_REGISTRY_DECLARE, c.addConst(name), c.addConst(s.Kind))
+	c.emit(OP_STORE, byte(slot))
 }
 
+// compileAgentStmt builds the agent's declared fields into an object and
+// lets OP_AGENT_DECLARE turn it into the stored agent record. Agents naming
+// a registry entry — explicitly, or implicitly by sharing its name — are
+// validated against it before being stored.
 func (c *Compiler) compileAgentStmt(s ast.AgentStmt) {
-	c.compileRegistryAgentDeclare(s)
-
 	agentName := s.Identifier.(ast.SymbolExpr).Value
-	c.allocSlot(agentName)
+	slot := c.allocSlot(agentName)
+	c.Agents[agentName] = slot
 
-	identifierIdx := c.findConst(s.Identifier)
-	if identifierIdx == 255 {
-		identifierIdx = c.addConst(s.Identifier)
+	registry := ""
+	if _, ok := c.Registries[agentName]; ok {
+		registry = agentName
 	}
 
-	c.emit(OP_CONST, identifierIdx)
-	c.emit(OP_AGENT_GET, byte(identifierIdx))
-
-	versionIdx := c.addConst(s.Version)
-	ownerIdx := c.addConst(s.Owner)
+	c.emit(OP_PUSH_OBJECT)
+	for _, field := range byKey(s.Fields, func(f ast.MetadataField) string { return f.Key }) {
+		c.emit(OP_CONST, c.addConst(field.Key))
+		if field.Key == "registry" {
+			registry = registryRefName(field.Value)
+			c.emit(OP_CONST, c.addConst(registry))
+		} else {
+			c.compileExpr(field.Value)
+		}
+		c.emit(OP_SET_PROPERTY)
+	}
 
-	c.emit(OP_CONST, versionIdx)
-	c.emit(OP_CONST, ownerIdx)
+	c.emit(OP_AGENT_DECLARE, c.addConst(agentName))
+	if registry != "" {
+		c.emit(OP_REGISTRY_GET, c.addConst(registry))
+		c.emit(OP_AGENT_VALIDATE)
+	}
+	c.emit(OP_STORE, byte(slot))
+}
 
-	c.emit(OP_AGENT_VALIDATE)
+// byKey returns the fields of an agent, registry, policy or type block
+// sorted by key. They are compiled in that order rather than as written, so
+// the artifact does not change when `synx fmt` reorders them.
+func byKey[F any](fields []F, key func(F) string) []F {
+	sorted := append([]F(nil), fields...)
+	sort.SliceStable(sorted, func(i, j int) bool { return key(sorted[i]) < key(sorted[j]) })
+	return sorted
+}
 
-	c.emit(OP_STORE, byte(c.Symbols[agentName]))
+func registryRefName(expr ast.Expr) string {
+	switch v := expr.(type) {
+	case ast.SymbolExpr:
+		return v.Value
+	case ast.StringExpr:
+		return v.Value
+	}
+	panic(fmt.Sprintf("agent registry reference must be a name, got %T", expr))
 }
 
+// compilePolicyStmt stores a policy object. A policy without version
+// metadata goes straight into the slot functions read it from; each version
+// of a versioned policy gets a hidden slot, and the VM activates one of them
+// per execution (see PolicyMeta).
 func (c *Compiler) compilePolicyStmt(s ast.PolicyStmt) {
-	c.allocSlot(s.Identifier.(ast.SymbolExpr).Value)
+	name := s.Identifier.(ast.SymbolExpr).Value
+	meta, exists := c.Policies[name]
+	if !exists {
+		meta = PolicyMeta{Slot: c.allocSlot(name)}
+	}
+
+	slot := meta.Slot
+	version, versioned := policyVersion(s)
+	if versioned {
+		version.Slot = c.allocSlot(fmt.Sprintf("policy:%s@%s", name, version.Version))
+		version.Doc = s.Doc
+		meta.Versions = append(meta.Versions, version)
+		slot = version.Slot
+	} else {
+		meta.Doc = s.Doc
+	}
+	c.Policies[name] = meta
 
 	identifierIdx := c.findConst(s.Identifier)
 	if identifierIdx == 255 {
@@ -307,28 +607,24 @@ func (c *Compiler) compilePolicyStmt(s ast.PolicyStmt) {
 	c.emit(OP_CONST, identifierIdx)
 
 	c.emit(OP_PUSH_OBJECT)
-	for key, value := range s.Rules {
-		keyIdx := c.addConst(key)
+	for _, rule := range byKey(s.Rules, func(r ast.PolicyRule) string { return r.Key }) {
+		keyIdx := c.addConst(rule.Key)
 		c.emit(OP_CONST, keyIdx)
 
-		switch v := value.(type) {
-		case ast.NumberExpr:
-			valIdx := c.addConst(v.Value)
-			c.emit(OP_CONST, valIdx)
-		case ast.StringExpr:
-			valIdx := c.addConst(v.Value)
-			c.emit(OP_CONST, valIdx)
-		case ast.ArrayLiteralExpr:
-			c.compileExpr(v)
-		default:
-			panic(fmt.Sprintf("Unsupported policy rule value type: %T", v))
+		value, err := foldConstant(rule.Value)
+		if err != nil {
+			panic(fmt.Sprintf("policy '%s', rule '%s': %v", name, rule.Key, err))
+		}
+		if rule.Param {
+			value = c.resolveParam(name, version.Version, rule.Key, value)
 		}
+		c.emit(OP_CONST, c.addConst(value))
 
 		c.emit(OP_SET_PROPERTY)
 	}
 
 	c.emit(OP_POLICY_DECLARE, byte(identifierIdx))
-	c.emit(OP_STORE, byte(c.Symbols[s.Identifier.(ast.SymbolExpr).Value]))
+	c.emit(OP_STORE, byte(slot))
 }
 
 func (c *Compiler) compileTypeDeclareStmt(s ast.TypeDeclareStmt) {
@@ -338,10 +634,11 @@ func (c *Compiler) compileTypeDeclareStmt(s ast.TypeDeclareStmt) {
 	// Register the type in the type registry
 	typeMeta := TypeMeta{
 		Fields: make(map[string]string),
+		Doc:    s.Doc,
 	}
-	for key, value := range s.Fields {
-		if sym, ok := value.(ast.SymbolExpr); ok {
-			typeMeta.Fields[key] = sym.Value
+	for _, field := range s.Fields {
+		if sym, ok := field.Type.(ast.SymbolExpr); ok {
+			typeMeta.Fields[field.Name] = sym.Value
 		}
 	}
 	c.Types[typeName] = typeMeta
@@ -354,11 +651,11 @@ func (c *Compiler) compileTypeDeclareStmt(s ast.TypeDeclareStmt) {
 	c.emit(OP_CONST, identifierIdx)
 	c.emit(OP_PUSH_OBJECT)
 
-	for key, value := range s.Fields {
-		keyIdx := c.addConst(key)
+	for _, field := range byKey(s.Fields, func(f ast.TypeField) string { return f.Name }) {
+		keyIdx := c.addConst(field.Name)
 		c.emit(OP_CONST, keyIdx)
 
-		switch v := value.(type) {
+		switch v := field.Type.(type) {
 		case ast.NumberExpr:
 			valIdx := c.addConst(v.Value)
 			c.emit(OP_CONST, valIdx)
@@ -380,6 +677,7 @@ func (c *Compiler) compileTypeDeclareStmt(s ast.TypeDeclareStmt) {
 }
 
 func (c *Compiler) compileEmitStmt(s ast.EmitStmt) {
+	c.noteEvent(s)
 	c.compileExpr(s.EventName)
 
 	if s.Arguments != nil {
@@ -396,30 +694,85 @@ func (c *Compiler) compileTryCatchStmt(s ast.TryCatchStmt) {
 
 	tryPos := c.currentPos()
 	c.emit(OP_TRY, 0, 0, byte(errSlot))
+	c.tryDepth++
+	outer := c.scope
+	if outer != nil {
+		c.scope = newErrorScope()
+		outer.tries = append(outer.tries, c.scope)
+		for _, clause := range s.Catches {
+			if clause.Type == "" {
+				c.scope.caughtAll = true
+			} else {
+				c.scope.caught[clause.Type] = true
+			}
+		}
+	}
 	for _, stmt := range s.TryBlock {
 		c.compileStmt(stmt)
 	}
+	c.scope = outer
+	c.tryDepth--
 	c.emit(OP_END_TRY)
 
 	jmpEndPos := c.currentPos()
 	c.emit(OP_JMP, 0, 0)
 
 	handlerPos := c.currentPos()
-	prevSlot, hadPrev := c.Symbols[s.CatchVar]
-	c.Symbols[s.CatchVar] = errSlot
+	var jmpEnds []int
+	caughtAll := false
+	for _, clause := range s.Catches {
+		// A typed clause compares the caught error's code with its type
+		// and falls through to the next clause when they differ.
+		nextClausePos := -1
+		if clause.Type != "" {
+			c.emit(OP_SLOAD, byte(errSlot))
+			c.emit(OP_CONST, c.addConst("code"))
+			c.emit(OP_GET_PROPERTY)
+			c.emit(OP_CONST, c.addConst(clause.Type))
+			c.emit(OP_EQ)
+			nextClausePos = c.currentPos()
+			c.emit(OP_JMP_IF, 0, 0)
+		} else {
+			caughtAll = true
+		}
 
-	for _, stmt := range s.CatchBlock {
-		c.compileStmt(stmt)
-	}
+		c.compileCatchBody(clause, errSlot)
+		jmpEnds = append(jmpEnds, c.currentPos())
+		c.emit(OP_JMP, 0, 0)
 
-	if hadPrev {
-		c.Symbols[s.CatchVar] = prevSlot
-	} else {
-		delete(c.Symbols, s.CatchVar)
+		if nextClausePos >= 0 {
+			c.patchJump(nextClausePos+1, c.currentPos())
+		}
+		if caughtAll {
+			break
+		}
+	}
+	if !caughtAll {
+		// No clause matched: raise the error again for an outer handler.
+		c.emit(OP_SLOAD, byte(errSlot))
+		c.emit(OP_ERR)
 	}
 
 	endPos := c.currentPos()
 
 	c.patchJump(tryPos+1, handlerPos)
 	c.patchJump(jmpEndPos+1, endPos)
+	for _, pos := range jmpEnds {
+		c.patchJump(pos+1, endPos)
+	}
+}
+
+func (c *Compiler) compileCatchBody(clause ast.CatchClause, errSlot int) {
+	prevSlot, hadPrev := c.Symbols[clause.Var]
+	c.Symbols[clause.Var] = errSlot
+
+	for _, stmt := range clause.Body {
+		c.compileStmt(stmt)
+	}
+
+	if hadPrev {
+		c.Symbols[clause.Var] = prevSlot
+	} else {
+		delete(c.Symbols, clause.Var)
+	}
 }
@@ -0,0 +1,116 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/lexer"
+)
+
+// TestFunction is the name a test block is compiled under.
+func TestFunction(name string) string {
+	return "test:" + name
+}
+
+// compileTest compiles a test block as a function with no arguments.
+// Tests are only compiled when CompileTests is set.
+func (c *Compiler) compileTest(s ast.TestStmt) {
+	c.compileFunc(ast.FuncStmt{
+		Pos:  s.Pos,
+		Name: ast.SymbolExpr{Value: TestFunction(s.Name)},
+		Body: ast.BlockStmt{Body: s.Body},
+	})
+	c.Tests = append(c.Tests, s.Name)
+}
+
+// compileExpect is a require with code EXPECT_FAILED whose message
+// defaults to the condition's source text.
+func (c *Compiler) compileExpect(s ast.ExpectStmt) {
+	message := s.Message
+	if message == nil {
+		message = ast.StringExpr{Value: "expected " + ast.ExprString(s.Condition)}
+	}
+	c.compileRequire(ast.RequireStmt{
+		Condition: s.Condition,
+		Code:      ast.StringExpr{Value: "EXPECT_FAILED"},
+		Message:   message,
+	})
+}
+
+// compileExpectRevert runs the body inside a try frame. Completing the body
+// fails the test; the handler fails it too unless the caught error carries
+// the expected code.
+func (c *Compiler) compileExpectRevert(s ast.ExpectRevertStmt) {
+	errName := fmt.Sprintf("__expect_revert_%d__", c.NextSlot)
+	errSlot := c.allocSlot(errName)
+
+	tryPos := c.currentPos()
+	c.emit(OP_TRY, 0, 0, byte(errSlot))
+	c.tryDepth++
+	for _, stmt := range s.Body {
+		c.compileStmt(stmt)
+	}
+	c.tryDepth--
+	c.emit(OP_END_TRY)
+
+	c.compileErrorExpr(ast.ErrorExpr{
+		Code:    ast.StringExpr{Value: "EXPECT_FAILED"},
+		Message: concat(ast.StringExpr{Value: "expected revert "}, s.Code, ast.StringExpr{Value: ", but the block completed"}),
+	})
+	c.emit(OP_ERR)
+
+	handlerPos := c.currentPos()
+	caughtCode := ast.MemberExpr{Object: ast.SymbolExpr{Value: errName}, Property: ast.SymbolExpr{Value: "code"}}
+	c.compileExpr(caughtCode)
+	c.compileExpr(s.Code)
+	c.emit(OP_EQ)
+	jmpMismatchPos := c.currentPos()
+	c.emit(OP_JMP_IF, 0, 0)
+	jmpEndPos := c.currentPos()
+	c.emit(OP_JMP, 0, 0)
+
+	mismatchPos := c.currentPos()
+	c.compileErrorExpr(ast.ErrorExpr{
+		Code:    ast.StringExpr{Value: "EXPECT_FAILED"},
+		Message: concat(ast.StringExpr{Value: "expected revert "}, s.Code, ast.StringExpr{Value: ", got "}, caughtCode),
+	})
+	c.emit(OP_CONST, c.addConst("details"))
+	c.compileExpr(ast.SymbolExpr{Value: errName})
+	c.emit(OP_SET_PROPERTY)
+	c.emit(OP_ERR)
+
+	endPos := c.currentPos()
+	c.patchJump(tryPos+1, handlerPos)
+	c.patchJump(jmpMismatchPos+1, mismatchPos)
+	c.patchJump(jmpEndPos+1, endPos)
+}
+
+// compileExpectEmit pushes the event name and expected payload (null when
+// omitted) for OP_EXPECT_EMIT. A bare name is the event's name, as in emit.
+func (c *Compiler) compileExpectEmit(s ast.ExpectEmitStmt) {
+	if sym, ok := s.EventName.(ast.SymbolExpr); ok {
+		if _, isVar := c.Symbols[sym.Value]; !isVar {
+			c.emit(OP_CONST, c.addConst(sym.Value))
+		} else {
+			c.compileExpr(sym)
+		}
+	} else {
+		c.compileExpr(s.EventName)
+	}
+
+	if s.Payload != nil {
+		c.compileExpr(s.Payload)
+	} else {
+		c.emit(OP_NULL)
+	}
+	c.emit(OP_EXPECT_EMIT)
+}
+
+// concat joins parts with string addition.
+func concat(parts ...ast.Expr) ast.Expr {
+	expr := parts[0]
+	for _, part := range parts[1:] {
+		expr = ast.BinaryExpr{Left: expr, Operator: lexer.Token{Type: lexer.PLUS, Literal: "+"}, Right: part}
+	}
+	return expr
+}
@@ -0,0 +1,29 @@
+package compiler
+
+import "github.com/peiblow/vvm/ast"
+
+// Trace point kinds.
+const (
+	TraceRequire = "require"
+	TraceCheck   = "check"
+	TraceBranch  = "branch"
+)
+
+// TracePoint describes the condition tested by the OP_JMP_IF at a given
+// address, so a VM in explain mode can report what was evaluated without
+// the source.
+type TracePoint struct {
+	Kind    string `json:"kind"`
+	Expr    string `json:"expr"`
+	Message string `json:"message,omitempty"`
+}
+
+func (c *Compiler) addTracePoint(addr int, kind string, cond ast.Expr, message ast.Expr) {
+	point := TracePoint{Kind: kind, Expr: ast.ExprString(cond)}
+	if str, ok := message.(ast.StringExpr); ok {
+		point.Message = str.Value
+	} else {
+		point.Message = ast.ExprString(message)
+	}
+	c.TracePoints[addr] = point
+}
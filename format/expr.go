@@ -0,0 +1,329 @@
+package format
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/lexer"
+)
+
+// precedence mirrors the parser's binding powers for binary operators.
+var precedence = map[lexer.TokenType]int{
+	lexer.AND:            1,
+	lexer.OR:             1,
+	lexer.DOT_DOT:        1,
+	lexer.LESS:           2,
+	lexer.LESS_EQUALS:    2,
+	lexer.GREATER:        2,
+	lexer.GREATER_EQUALS: 2,
+	lexer.EQUALS:         2,
+	lexer.NOT_EQUALS:     2,
+	lexer.PLUS:           3,
+	lexer.DASH:           3,
+	lexer.STAR:           4,
+	lexer.SLASH:          4,
+	lexer.PERCENT:        4,
+}
+
+// longHex matches hex literals too long to be numbers, which the parser
+// turns into strings. They are printed without quotes, as written.
+var longHex = regexp.MustCompile(`^0[xX][0-9a-fA-F]{17,}$`)
+
+// flat renders an expression on a single line.
+func (p *printer) flat(e ast.Expr) string {
+	return p.expr(e, math.MinInt32)
+}
+
+// expr renders an expression that starts at column col. Object and array
+// literals that would run past lineWidth are split, one entry per line.
+func (p *printer) expr(e ast.Expr, col int) string {
+	switch e := e.(type) {
+	case nil:
+		return ""
+	case ast.NumberExpr:
+		if e.Literal != "" {
+			return e.Literal
+		}
+		return strconv.FormatFloat(e.Value, 'f', -1, 64)
+	case ast.StringExpr:
+		if longHex.MatchString(e.Value) {
+			return e.Value
+		}
+		if text, ok := p.block(e.Value); ok {
+			return text
+		}
+		return quote(e.Value)
+	case ast.SymbolExpr:
+		return e.Value
+	case ast.ThisExpr:
+		return "this"
+	case ast.BooleanLiteralExpr:
+		return strconv.FormatBool(e.Value)
+	case ast.NullExpr:
+		return "null"
+	case ast.BinaryExpr:
+		prec := precedence[e.Operator.Type]
+		left := p.operand(e.Left, prec, false, col)
+		text := left + " " + e.Operator.Literal + " "
+		return text + p.operand(e.Right, prec, true, column(text, col))
+	case ast.PrefixExpr:
+		// The parser binds a prefix operator to the whole expression after
+		// it, so compound operands keep their parentheses.
+		return e.Operator.Literal + p.wrapped(e.RightExpr, col+len(e.Operator.Literal))
+	case ast.IncDecExpr:
+		return p.wrapped(e.Left, col) + e.Operator.Literal
+	case ast.AssignmentExpr:
+		text := p.expr(e.Left, col) + " " + e.Operator.Literal + " "
+		return text + p.expr(e.Right, column(text, col))
+	case ast.ArrayLiteralExpr:
+		return p.list("[", "]", e.Items, nil, span{e.Line, e.End, e.ItemLines}, col)
+	case ast.ObjectAssignmentExpr:
+		if len(e.Fields) == 0 {
+			return "{}"
+		}
+		keys := make([]string, len(e.Fields))
+		values := make([]ast.Expr, len(e.Fields))
+		lines := make([]int, len(e.Fields))
+		for i, f := range e.Fields {
+			keys[i] = p.flat(f.Key) + ": "
+			values[i] = f.Value
+			lines[i] = f.Line
+		}
+		return p.list("{ ", " }", values, keys, span{e.Line, e.End, lines}, col)
+	case ast.ArrayAccessItemExpr:
+		text := p.wrapped(e.Array, col) + "["
+		return text + p.expr(e.Index, column(text, col)) + "]"
+	case ast.CallExpr:
+		return p.call(p.wrapped(e.Calle, col), e.Arguments, col)
+	case ast.MemberExpr:
+		return p.wrapped(e.Object, col) + "." + p.flat(e.Property)
+	case ast.GetEnvExpr:
+		return p.call("getEnv", []ast.Expr{e.VariableName}, col)
+	case ast.NonceExpr:
+		return p.call("nonce", []ast.Expr{e.Size}, col)
+	case ast.HashExpr:
+		return p.call("hash", append([]ast.Expr{e.HashType}, e.Data...), col)
+	case ast.ErrorExpr:
+		return p.call("Error", []ast.Expr{e.Code, e.Message}, col)
+	case ast.ExpressionStmt:
+		return p.expr(e.Expression, col)
+	}
+	return ast.ExprString(e)
+}
+
+// operand renders one side of a binary expression, parenthesized when the
+// parser would otherwise group it differently. Operators of equal
+// precedence associate to the left.
+func (p *printer) operand(e ast.Expr, prec int, right bool, col int) string {
+	switch inner := e.(type) {
+	case ast.BinaryExpr:
+		innerPrec := precedence[inner.Operator.Type]
+		if innerPrec < prec || (right && innerPrec == prec) {
+			return "(" + p.expr(e, col+1) + ")"
+		}
+	case ast.AssignmentExpr, ast.PrefixExpr:
+		return "(" + p.expr(e, col+1) + ")"
+	}
+	return p.expr(e, col)
+}
+
+// wrapped renders the target of a prefix operator, call, member access or
+// index, parenthesized unless it is a single term.
+func (p *printer) wrapped(e ast.Expr, col int) string {
+	switch e.(type) {
+	case ast.BinaryExpr, ast.AssignmentExpr, ast.PrefixExpr:
+		return "(" + p.expr(e, col+1) + ")"
+	}
+	return p.expr(e, col)
+}
+
+// span is where a literal was in the source: the lines of its opening and
+// closing brackets and the line each entry starts on.
+type span struct {
+	line, end int
+	items     []int
+}
+
+// literalSpan returns the lines of e's brackets when e is an object or
+// array literal.
+func literalSpan(e ast.Expr) (line, end int, ok bool) {
+	switch e := e.(type) {
+	case ast.ArrayLiteralExpr:
+		return e.Line, e.End, true
+	case ast.ObjectAssignmentExpr:
+		return e.Line, e.End, true
+	}
+	return 0, 0, false
+}
+
+// list renders an array or object literal, on one line if it fits and
+// otherwise with one entry per line. keys prefixes each object entry. A
+// literal holding comments is always split, and each comment is printed
+// next to the entry it was written next to.
+func (p *printer) list(open, close string, items []ast.Expr, keys []string, pos span, col int) string {
+	comments := p.claim(pos, items)
+	if len(items) == 0 && len(comments) == 0 {
+		return strings.TrimSpace(open) + strings.TrimSpace(close)
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = p.flat(item)
+		if keys != nil {
+			parts[i] = keys[i] + parts[i]
+		}
+	}
+	flat := open + strings.Join(parts, ", ") + close
+	if col+len(flat) <= lineWidth && !strings.Contains(flat, "\n") && len(comments) == 0 {
+		return flat
+	}
+
+	indent := p.depth
+	inner := strings.Repeat(indentUnit, indent+1)
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(open))
+	// writeComments prints the comments that start before line, and those
+	// that open it, ahead of its code: after the code they trail, or on
+	// lines of their own.
+	writeComments := func(line int) {
+		for len(comments) > 0 && (comments[0].Line < line || comments[0].Line == line && !comments[0].Trailing) {
+			if comments[0].Trailing {
+				b.WriteString(" " + comments[0].Text)
+			} else {
+				b.WriteString("\n" + inner + comments[0].Text)
+			}
+			comments = comments[1:]
+		}
+	}
+	for i, item := range items {
+		line := pos.line
+		if i < len(pos.items) {
+			line = pos.items[i]
+		}
+		writeComments(line)
+		b.WriteString("\n" + inner)
+		prefix := ""
+		if keys != nil {
+			prefix = keys[i]
+		}
+		b.WriteString(prefix + p.nested(item, indent+1, len(inner)+len(prefix)))
+		if i < len(items)-1 {
+			b.WriteString(",")
+		}
+		if i+1 >= len(pos.items) || pos.items[i+1] != line {
+			writeComments(line + 1)
+		}
+	}
+	writeComments(pos.end)
+	b.WriteString("\n" + strings.Repeat(indentUnit, indent) + strings.TrimSpace(close))
+	return b.String()
+}
+
+// claim returns the pending comments written inside a literal, before the
+// line of its closing bracket, and marks them as printed. Comments inside
+// an entry that is itself a literal are left for that entry.
+func (p *printer) claim(pos span, items []ast.Expr) []lexer.Comment {
+	if pos.end <= pos.line {
+		return nil
+	}
+	var comments []lexer.Comment
+	for _, c := range p.comments {
+		if c.Line >= pos.end {
+			break
+		}
+		if c.Line < pos.line || inside(c, items) {
+			continue
+		}
+		p.claimed[c] = true
+		comments = append(comments, c)
+	}
+	return comments
+}
+
+// inside reports whether c was written inside one of the literals among
+// items.
+func inside(c lexer.Comment, items []ast.Expr) bool {
+	for _, item := range items {
+		if line, end, ok := literalSpan(item); ok && c.Line >= line && c.Line < end {
+			return true
+		}
+	}
+	return false
+}
+
+// nested renders a list entry one level deeper than the current line.
+func (p *printer) nested(e ast.Expr, indent, col int) string {
+	saved := p.depth
+	p.depth = indent
+	defer func() { p.depth = saved }()
+	return p.expr(e, col)
+}
+
+// column returns the column after text, which starts at col.
+func column(text string, col int) int {
+	if i := strings.LastIndex(text, "\n"); i >= 0 {
+		return len(text) - i - 1
+	}
+	return col + len(text)
+}
+
+// quote renders s as a "..." literal, escaping what the lexer would not
+// read back as itself.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// block renders a string holding line breaks as a """ literal, its lines
+// indented one level deeper than the current line. ok is false when s has
+// no line breaks or would not read back as itself, e.g. because a line is
+// only whitespace.
+func (p *printer) block(s string) (text string, ok bool) {
+	if !strings.Contains(s, "\n") {
+		return "", false
+	}
+	inner := strings.Repeat(indentUnit, p.depth+1)
+	var b strings.Builder
+	b.WriteString(`"""` + "\n")
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			line = strings.ReplaceAll(line, `\`, `\\`)
+			line = strings.ReplaceAll(line, "\r", `\r`)
+			b.WriteString(inner + strings.ReplaceAll(line, `"""`, `\"\"\"`))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(inner + `"""`)
+
+	lexed := lexer.Tokenize(b.String())
+	if lexed.HasErrors() || len(lexed.Tokens) != 2 || lexed.Tokens[0].Literal != s {
+		return "", false
+	}
+	return b.String(), true
+}
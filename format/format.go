@@ -0,0 +1,520 @@
+// Package format prints Synx source in its canonical style: two-space
+// indentation, one statement per line, at most one blank line between
+// statements, and the fields of agent, registry, policy and type blocks in
+// a fixed order. Comments are kept.
+package format
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/compiler"
+	"github.com/peiblow/vvm/lexer"
+	"github.com/peiblow/vvm/parser"
+)
+
+const (
+	indentUnit = "  "
+	lineWidth  = 80 // object and array literals wider than this are split over lines
+)
+
+// Source formats a Synx program. Formatting already formatted source
+// returns it unchanged.
+func Source(src []byte) (out []byte, err error) {
+	lexed := lexer.Tokenize(string(src))
+	if lexed.HasErrors() {
+		return nil, lexed.Errors[0]
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	program := parser.Parse(lexed.Tokens)
+
+	p := &printer{comments: lexed.Comments, claimed: map[lexer.Comment]bool{}}
+	for _, stmt := range program.Body {
+		p.stmt(stmt, 0)
+	}
+	p.flushComments(math.MaxInt, 0)
+	if len(p.lines) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.Join(p.lines, "\n") + "\n"), nil
+}
+
+// printer writes formatted lines. Comments are consumed in source order:
+// each is printed before the first code that follows it, or appended to
+// the code it trails. Comments inside an object or array literal are
+// claimed by the literal and printed among its entries.
+type printer struct {
+	lines    []string
+	comments []lexer.Comment
+	claimed  map[lexer.Comment]bool // printed inside a literal
+	holds    []int                  // end lines of the statements being printed
+	lastLine int                    // source line of the last code or comment printed
+	open     bool                   // the last line printed opens a block
+	depth    int                    // indentation of the line being rendered
+}
+
+func (p *printer) line(indent int, text string) {
+	p.lines = append(p.lines, strings.Repeat(indentUnit, indent)+text)
+	p.open = strings.HasSuffix(text, "{")
+}
+
+// close prints a line starting with "}", joining it to the previous line
+// when that line opened an empty block.
+func (p *printer) close(indent int, text string) {
+	if p.open {
+		p.lines[len(p.lines)-1] += text
+		p.open = strings.HasSuffix(text, "{")
+		return
+	}
+	p.line(indent, text)
+}
+
+// gap keeps one blank line where the source had at least one before line.
+func (p *printer) gap(line int) {
+	if line > p.lastLine+1 && p.lastLine > 0 && len(p.lines) > 0 && !p.open {
+		p.lines = append(p.lines, "")
+	}
+}
+
+// flushComments prints the comments that start before line.
+func (p *printer) flushComments(line, indent int) {
+	for len(p.comments) > 0 && p.comments[0].Line < line {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		if p.claimed[c] {
+			continue
+		}
+		if c.Trailing && len(p.lines) > 0 {
+			p.lines[len(p.lines)-1] += " " + c.Text
+			p.open = false
+		} else {
+			p.gap(c.Line)
+			p.line(indent, c.Text)
+			p.open = false
+		}
+		p.lastLine = max(p.lastLine, c.EndLine())
+	}
+}
+
+// flushTrailing appends the comments that trail code on line. A comment
+// after a statement that ends on line, such as a block written on one
+// line, is left for that statement, so it stays after the closing brace.
+func (p *printer) flushTrailing(line int) {
+	for _, held := range p.holds {
+		if held == line {
+			return
+		}
+	}
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if p.claimed[c] {
+			p.comments = p.comments[1:]
+			continue
+		}
+		if c.Line != line || !c.Trailing {
+			return
+		}
+		p.lines[len(p.lines)-1] += " " + c.Text
+		p.open = false
+		p.comments = p.comments[1:]
+	}
+}
+
+// begin prints what precedes a statement starting on line: its leading
+// comments and, if the source had one, a blank line.
+func (p *printer) begin(line, indent int) {
+	p.flushComments(line, indent)
+	p.gap(line)
+	p.lastLine = line
+}
+
+// body prints a block's statements and the comments before its closing
+// brace, on closeLine.
+func (p *printer) body(stmts []ast.Stmt, indent, closeLine int) {
+	for _, stmt := range stmts {
+		p.stmt(stmt, indent)
+	}
+	p.flushComments(closeLine, indent)
+}
+
+func (p *printer) stmt(stmt ast.Stmt, indent int) {
+	var pos ast.Pos
+	if positioned, ok := stmt.(ast.Positioned); ok {
+		pos = positioned.Position()
+	}
+	p.begin(pos.Line, indent)
+	p.depth = indent
+	col := len(indentUnit) * indent
+	p.holds = append(p.holds, pos.End)
+
+	switch s := stmt.(type) {
+	case ast.ContractStmt:
+		p.line(indent, "contract "+s.Identifier+" {")
+		p.flushTrailing(pos.Line)
+		p.body(s.Body, indent+1, pos.End)
+		p.close(indent, "}")
+	case ast.FuncStmt:
+		p.funcHeader(s, indent)
+		if block, ok := s.Body.(ast.BlockStmt); ok {
+			p.body(block.Body, indent+1, pos.End)
+		}
+		p.close(indent, "}")
+	case ast.IfStmt:
+		p.ifStmt(s, indent, "")
+	case ast.WhileStmt:
+		p.line(indent, "while ("+p.flat(s.Condition)+") {")
+		p.flushTrailing(pos.Line)
+		p.body(s.Body, indent+1, pos.End)
+		p.close(indent, "}")
+	case ast.ForStmt:
+		p.line(indent, "for ("+p.inline(s.Init)+"; "+p.flat(s.Condition)+"; "+p.inline(s.Post)+") {")
+		p.flushTrailing(pos.Line)
+		p.body(s.Body, indent+1, pos.End)
+		p.close(indent, "}")
+	case ast.ForEachStmt:
+		vars := s.Value
+		if s.Key != "" {
+			vars = s.Key + ", " + s.Value
+		}
+		p.line(indent, "for ("+vars+" in "+p.flat(s.Iterable)+") {")
+		p.flushTrailing(pos.Line)
+		p.body(s.Body, indent+1, pos.End)
+		p.close(indent, "}")
+	case ast.TryCatchStmt:
+		p.line(indent, "try {")
+		p.flushTrailing(pos.Line)
+		closeLine := pos.End
+		if len(s.Catches) > 0 {
+			closeLine = s.Catches[0].Line
+		}
+		p.body(s.TryBlock, indent+1, closeLine)
+		for i, clause := range s.Catches {
+			header := "} catch (" + clause.Var
+			if clause.Type != "" {
+				header += ": " + clause.Type
+			}
+			p.close(indent, header+") {")
+			p.flushTrailing(clause.Line)
+			closeLine = clause.End
+			if i+1 < len(s.Catches) {
+				closeLine = s.Catches[i+1].Line
+			}
+			p.body(clause.Body, indent+1, closeLine)
+		}
+		p.close(indent, "}")
+	case ast.TestStmt:
+		p.line(indent, "test "+quote(s.Name)+" {")
+		p.flushTrailing(pos.Line)
+		p.body(s.Body, indent+1, pos.End)
+		p.close(indent, "}")
+	case ast.ExpectRevertStmt:
+		p.line(indent, "expectRevert("+p.flat(s.Code)+") {")
+		p.flushTrailing(pos.Line)
+		p.body(s.Body, indent+1, pos.End)
+		p.close(indent, "}")
+	case ast.AgentStmt:
+		fields := make([]field, len(s.Fields))
+		for i, f := range s.Fields {
+			fields[i] = field{key: f.Key, value: f.Value, line: f.Line}
+		}
+		p.fields(indent, "agent "+p.flat(s.Identifier), pos, fields, parser.AgentFieldOrder())
+	case ast.RegistryStmt:
+		fields := make([]field, len(s.Fields))
+		for i, f := range s.Fields {
+			fields[i] = field{key: f.Key, value: f.Value, line: f.Line}
+		}
+		p.fields(indent, "registry "+s.Kind+" "+p.flat(s.Identifier), pos, fields, parser.RegistryFieldOrder())
+	case ast.PolicyStmt:
+		fields := make([]field, len(s.Rules))
+		for i, r := range s.Rules {
+			fields[i] = field{key: r.Key, value: r.Value, line: r.Line, param: r.Param}
+		}
+		order := []string{compiler.PolicyVersionKey, compiler.PolicyEffectiveFromKey, compiler.PolicyEffectiveUntilKey}
+		p.fields(indent, "policy "+p.flat(s.Identifier), pos, fields, order)
+	case ast.TypeDeclareStmt:
+		fields := make([]field, len(s.Fields))
+		for i, f := range s.Fields {
+			fields[i] = field{key: f.Name, value: f.Type, line: f.Line}
+		}
+		p.fields(indent, "type "+p.flat(s.Name), pos, fields, nil)
+	case ast.ErrorDeclStmt:
+		// Error fields are positional arguments when the error is raised,
+		// so their order is kept.
+		fields := make([]field, len(s.Fields))
+		for i, f := range s.Fields {
+			fields[i] = field{key: f.Name, value: f.Type, line: f.Line}
+		}
+		p.fieldsInOrder(indent, "error "+s.Name, pos, fields)
+	default:
+		p.line(indent, p.simple(stmt, col))
+		p.flushTrailing(pos.Line)
+	}
+
+	p.holds = p.holds[:len(p.holds)-1]
+	if pos.End > p.lastLine {
+		p.lastLine = pos.End
+	}
+	p.flushTrailing(pos.End)
+}
+
+// funcHeader prints a function's signature. A signature spread over lines
+// with comments among its arguments is printed one argument per line, so
+// each comment stays next to the argument it followed.
+func (p *printer) funcHeader(s ast.FuncStmt, indent int) {
+	args := make([]string, len(s.Arguments))
+	headerEnd := s.Line
+	for i, arg := range s.Arguments {
+		args[i] = p.flat(arg.ArgName) + ": " + p.flat(arg.ArgType)
+		headerEnd = max(headerEnd, arg.Line)
+	}
+	returns := ")"
+	if s.ReturnType != nil {
+		returns += ": " + typeString(s.ReturnType)
+	}
+
+	if headerEnd == s.Line || len(p.comments) == 0 || p.comments[0].Line > headerEnd {
+		p.line(indent, "fn "+p.flat(s.Name)+"("+strings.Join(args, ", ")+returns+" {")
+		p.flushTrailing(s.Line)
+		return
+	}
+
+	p.line(indent, "fn "+p.flat(s.Name)+"(")
+	for i, arg := range s.Arguments {
+		p.flushComments(arg.Line, indent+1)
+		if i < len(args)-1 {
+			args[i] += ","
+		}
+		p.line(indent+1, args[i])
+		p.lastLine = arg.Line
+		if i == len(args)-1 || s.Arguments[i+1].Line != arg.Line {
+			p.flushTrailing(arg.Line)
+		}
+	}
+	p.line(indent, returns+" {")
+}
+
+func (p *printer) ifStmt(s ast.IfStmt, indent int, prefix string) {
+	header := prefix + "if (" + p.flat(s.Condition) + ") {"
+	if prefix == "" {
+		p.line(indent, header)
+	} else {
+		p.close(indent, header)
+	}
+	p.flushTrailing(s.Line)
+
+	closeLine := s.End
+	if s.Else != nil {
+		closeLine = s.ElseLine
+	}
+	if then, ok := s.Then.(ast.BlockStmt); ok {
+		p.body(then.Body, indent+1, closeLine)
+	}
+
+	switch e := s.Else.(type) {
+	case ast.IfStmt:
+		p.ifStmt(e, indent, "} else ")
+		return
+	case ast.BlockStmt:
+		p.close(indent, "} else {")
+		p.flushTrailing(s.ElseLine)
+		p.body(e.Body, indent+1, s.End)
+	}
+	p.close(indent, "}")
+}
+
+// simple renders a statement that fits on one line, apart from object and
+// array literals that are split because they are too wide.
+func (p *printer) simple(stmt ast.Stmt, col int) string {
+	switch s := stmt.(type) {
+	case ast.ExpressionStmt:
+		return p.expr(s.Expression, col)
+	case ast.VarDeclStmt:
+		text := "let "
+		if s.Constant {
+			text = "const "
+		}
+		text += s.Identifier
+		if s.ExplicityType != nil {
+			text += ": " + typeString(s.ExplicityType)
+		}
+		return text + " = " + p.expr(s.AssignedValue, col+len(text)+3)
+	case ast.ReturnStmt:
+		if s.Value == nil {
+			return "return"
+		}
+		return "return " + p.expr(s.Value, col+7)
+	case ast.BreakStmt:
+		return "break"
+	case ast.ContinueStmt:
+		return "continue"
+	case ast.RequireStmt:
+		return "require(" + p.assertion(s.Condition, s.Code, s.Message, s.Details, col+8) + ")"
+	case ast.CheckStmt:
+		return "check(" + p.assertion(s.Condition, s.Code, s.Message, s.Details, col+6) + ")"
+	case ast.ExpectStmt:
+		if s.Message == nil {
+			return "expect(" + p.expr(s.Condition, col+7) + ")"
+		}
+		return "expect(" + p.assertion(s.Condition, nil, s.Message, nil, col+7) + ")"
+	case ast.EmitStmt:
+		return p.call("emit", []ast.Expr{s.EventName, s.Arguments}, col)
+	case ast.ExpectEmitStmt:
+		return p.call("expectEmit", []ast.Expr{s.EventName, s.Payload}, col)
+	case ast.ArrayItemAssignmentStmt:
+		return p.flat(s.Name) + "[" + p.flat(s.Index) + "] = " + p.flat(s.Value)
+	case ast.GetEnvStmt:
+		return "getEnv(" + p.flat(s.VariableName) + ")"
+	}
+	panic(fmt.Sprintf("format: unsupported statement %T", stmt))
+}
+
+// inline renders the init and post statements of a for loop.
+func (p *printer) inline(stmt ast.Stmt) string {
+	if stmt == nil {
+		return ""
+	}
+	return p.simple(stmt, math.MinInt32)
+}
+
+// assertion renders `cond; message`, `cond; code, message` or
+// `cond; code, message, details`.
+func (p *printer) assertion(cond, code, message, details ast.Expr, col int) string {
+	text := p.expr(cond, col) + "; "
+	for _, arg := range []ast.Expr{code, message, details} {
+		if arg == nil {
+			continue
+		}
+		if !strings.HasSuffix(text, "; ") {
+			text += ", "
+		}
+		text += p.expr(arg, column(text, col))
+	}
+	return text
+}
+
+// call renders name(args...), dropping trailing nil arguments.
+func (p *printer) call(name string, args []ast.Expr, col int) string {
+	for len(args) > 0 && args[len(args)-1] == nil {
+		args = args[:len(args)-1]
+	}
+	text := name + "("
+	for i, arg := range args {
+		if i > 0 {
+			text += ", "
+		}
+		text += p.expr(arg, column(text, col))
+	}
+	return text + ")"
+}
+
+// field is one `key: value` entry of an agent, registry, policy, type or
+// error block, with the comments that belong to it.
+type field struct {
+	key      string
+	value    ast.Expr
+	line     int
+	param    bool
+	leading  []lexer.Comment
+	trailing []lexer.Comment
+}
+
+// fields prints a declaration block with its fields sorted: the keys in
+// order first, in that order, then every other key alphabetically.
+func (p *printer) fields(indent int, header string, pos ast.Pos, fields []field, order []string) {
+	rank := make(map[string]int, len(order))
+	for i, key := range order {
+		rank[key] = i
+	}
+	rankOf := func(key string) int {
+		if r, ok := rank[key]; ok {
+			return r
+		}
+		return len(order)
+	}
+
+	p.takeFieldComments(fields)
+	sort.SliceStable(fields, func(i, j int) bool {
+		ri, rj := rankOf(fields[i].key), rankOf(fields[j].key)
+		if ri != rj {
+			return ri < rj
+		}
+		if ri < len(order) {
+			return false
+		}
+		return fields[i].key < fields[j].key
+	})
+	p.printFields(indent, header, pos, fields)
+}
+
+func (p *printer) fieldsInOrder(indent int, header string, pos ast.Pos, fields []field) {
+	p.takeFieldComments(fields)
+	p.printFields(indent, header, pos, fields)
+}
+
+// takeFieldComments moves the comments of each field, the ones on lines
+// before it and the one trailing it, out of the pending comments so they
+// follow the field when fields are reordered. Comments inside a value
+// spread over lines stay pending for the value's literal to claim.
+func (p *printer) takeFieldComments(fields []field) {
+	var inside []lexer.Comment
+	for i := range fields {
+		for len(p.comments) > 0 && p.comments[0].Line < fields[i].line {
+			fields[i].leading = append(fields[i].leading, p.comments[0])
+			p.comments = p.comments[1:]
+		}
+		end := fields[i].line
+		if _, valueEnd, ok := literalSpan(fields[i].value); ok {
+			end = max(end, valueEnd)
+		}
+		for len(p.comments) > 0 && p.comments[0].Line < end {
+			inside = append(inside, p.comments[0])
+			p.comments = p.comments[1:]
+		}
+		for len(p.comments) > 0 && p.comments[0].Line == end && p.comments[0].Trailing {
+			fields[i].trailing = append(fields[i].trailing, p.comments[0])
+			p.comments = p.comments[1:]
+		}
+	}
+	p.comments = append(inside, p.comments...)
+}
+
+func (p *printer) printFields(indent int, header string, pos ast.Pos, fields []field) {
+	p.line(indent, header+" {")
+	p.flushTrailing(pos.Line)
+	for _, f := range fields {
+		for _, c := range f.leading {
+			p.line(indent+1, c.Text)
+		}
+		text := f.key + ": "
+		if f.param {
+			text += "param "
+		}
+		p.depth = indent + 1
+		text += p.expr(f.value, len(indentUnit)*(indent+1)+len(text))
+		p.line(indent+1, text)
+		for _, c := range f.trailing {
+			p.lines[len(p.lines)-1] += " " + c.Text
+		}
+		p.open = false
+	}
+	p.flushComments(pos.End, indent+1)
+	p.close(indent, "}")
+}
+
+func typeString(t ast.Type) string {
+	switch t := t.(type) {
+	case ast.SymbolType:
+		return t.Name
+	case ast.ArrayType:
+		return "[]" + typeString(t.Underlying)
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package format_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peiblow/vvm/format"
+	"github.com/peiblow/vvm/vm"
+)
+
+// TestSourceGolden formats each testdata/<name>.snx and compares the
+// output with testdata/<name>.golden, so a comment that moves to another
+// node fails the test. Formatting the output again must not change it.
+func TestSourceGolden(t *testing.T) {
+	for _, name := range []string{"blocks", "comments", "credit"} {
+		t.Run(name, func(t *testing.T) {
+			src := readFile(t, name+".snx")
+			want := readFile(t, name+".golden")
+
+			got, err := format.Source(src)
+			if err != nil {
+				t.Fatalf("Source() = %v", err)
+			}
+			if string(got) != string(want) {
+				t.Fatalf("Source() =\n%s\nwant\n%s", got, want)
+			}
+
+			again, err := format.Source(got)
+			if err != nil {
+				t.Fatalf("Source(formatted) = %v", err)
+			}
+			if string(again) != string(got) {
+				t.Fatalf("formatting is not idempotent, second pass =\n%s", again)
+			}
+		})
+	}
+}
+
+// TestFormatKeepsDigest checks that formatting, which reorders policy and
+// type fields, does not change the artifact built from the source.
+func TestFormatKeepsDigest(t *testing.T) {
+	src := readFile(t, "credit.snx")
+	formatted, err := format.Source(src)
+	if err != nil {
+		t.Fatalf("Source() = %v", err)
+	}
+
+	digest := func(src []byte) string {
+		artifact, err := vm.NewRuntime().Build(src, vm.BuildOptions{})
+		if err != nil {
+			t.Fatalf("Build() = %v", err)
+		}
+		sum, err := artifact.Digest()
+		if err != nil {
+			t.Fatalf("Digest() = %v", err)
+		}
+		return sum
+	}
+	if before, after := digest(src), digest(formatted); before != after {
+		t.Fatalf("digest changed from %s to %s after formatting", before, after)
+	}
+}
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -3,6 +3,9 @@ package lexer
 import (
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -23,10 +26,26 @@ type regexPattern struct {
 type lexer struct {
 	patterns []regexPattern
 	tokens   []Token
+	comments []Comment
 	source   string
 	pos      int
 	line     int
 	errors   []LexerError
+	doc      []string // lines of the /// block being read
+	docLine  int      // line of the block's last comment
+}
+
+// Comment is a comment in the source, with its // or /* */ markers. The
+// parser never sees comments; the formatter puts them back.
+type Comment struct {
+	Line     int
+	Text     string
+	Trailing bool // follows code on the same line
+}
+
+// EndLine is the line the comment ends on.
+func (c Comment) EndLine() int {
+	return c.Line + strings.Count(c.Text, "\n")
 }
 
 type LexerError struct {
@@ -47,6 +66,12 @@ func (lex *lexer) advanceN(n int) {
 }
 
 func (lex *lexer) push(token Token) {
+	if len(lex.doc) > 0 {
+		if lex.docLine == token.Line-1 {
+			token.Doc = strings.Join(lex.doc, "\n")
+		}
+		lex.doc = nil
+	}
 	lex.tokens = append(lex.tokens, token)
 }
 
@@ -62,6 +87,20 @@ func (lex *lexer) at_eof() bool {
 	return lex.pos >= len(lex.source)
 }
 
+// afterCode reports whether a token ends on the current line.
+func (lex *lexer) afterCode() bool {
+	if len(lex.tokens) == 0 {
+		return false
+	}
+	last := lex.tokens[len(lex.tokens)-1]
+	return last.Line == lex.line || last.EndLine == lex.line
+}
+
+func (lex *lexer) addComment(text string) {
+	trailing := lex.afterCode()
+	lex.comments = append(lex.comments, Comment{Line: lex.line, Text: text, Trailing: trailing})
+}
+
 func (lex *lexer) addError(msg string) {
 	lex.errors = append(lex.errors, LexerError{
 		Line:    lex.line,
@@ -93,10 +132,30 @@ func newlineHandler(lex *lexer, regex *regexp.Regexp) {
 func lineCommentHandler(lex *lexer, regex *regexp.Regexp) {
 	match := regex.FindStringIndex(lex.remainder())
 	if match != nil {
+		text := lex.remainder()[match[0]:match[1]]
+		lex.addComment(text)
+		lex.addDoc(text)
 		lex.advanceN(match[1])
 	}
 }
 
+// addDoc collects a /// comment on a line of its own into the doc block
+// for the next token. A line between two comments starts a new block.
+func (lex *lexer) addDoc(text string) {
+	if !strings.HasPrefix(text, "///") || strings.HasPrefix(text, "////") {
+		return
+	}
+	if lex.afterCode() {
+		return
+	}
+	if lex.docLine != lex.line-1 {
+		lex.doc = nil
+	}
+	line := strings.TrimPrefix(text[3:], " ")
+	lex.doc = append(lex.doc, strings.TrimRight(line, " \t\r"))
+	lex.docLine = lex.line
+}
+
 func blockCommentHandler(lex *lexer, regex *regexp.Regexp) {
 	match := regex.FindStringIndex(lex.remainder())
 	if match == nil {
@@ -105,6 +164,7 @@ func blockCommentHandler(lex *lexer, regex *regexp.Regexp) {
 		return
 	}
 	comment := lex.remainder()[match[0]:match[1]]
+	lex.addComment(comment)
 	for _, ch := range comment {
 		if ch == '\n' {
 			lex.line++
@@ -125,23 +185,159 @@ func hexNumberHandler(lex *lexer, regex *regexp.Regexp) {
 	lex.advanceN(len(match))
 }
 
+// stringHandler reads a "..." literal, which ends on the line it starts.
 func stringHandler(lex *lexer, regex *regexp.Regexp) {
-	match := regex.FindStringIndex(lex.remainder())
-	if match == nil {
-		lex.addError("string não fechada")
-		lex.advanceN(1)
+	src := lex.remainder()
+	end := 1
+	for end < len(src) && src[end] != '"' && src[end] != '\n' {
+		if src[end] == '\\' && end+1 < len(src) && src[end+1] != '\n' {
+			end++
+		}
+		end++
+	}
+	if end >= len(src) || src[end] != '"' {
+		lex.addError(fmt.Sprintf("string não fechada: %s", strings.TrimRight(src[:min(end, len(src))], "\r\n")))
+		lex.advanceN(min(end, len(src)))
 		return
 	}
-	raw := lex.remainder()[match[0]:match[1]]
-	literal := raw[1 : len(raw)-1]
-	lex.push(NewToken(STRING, literal, lex.line))
-	lex.advanceN(len(raw))
+
+	value, err := unescape(src[1:end])
+	if err != nil {
+		lex.addError(err.Error())
+	}
+	lex.push(NewToken(STRING, value, lex.line))
+	lex.advanceN(end + 1)
 }
 
-func unclosedStringHandler(lex *lexer, regex *regexp.Regexp) {
-	match := regex.FindString(lex.remainder())
-	lex.addError(fmt.Sprintf("string não fechada: %s", match))
-	lex.advanceN(len(match))
+// tripleStringHandler reads a """...""" literal, which may span lines. Text
+// starting on the line after the opening quotes has its common indentation
+// removed, counting the closing quotes' line when they stand alone, so a
+// message can be indented with the code around it.
+func tripleStringHandler(lex *lexer, regex *regexp.Regexp) {
+	src := lex.remainder()
+	end := 3
+	for end < len(src) && !strings.HasPrefix(src[end:], `"""`) {
+		if src[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(src) {
+		lex.addError(`string de múltiplas linhas """ não fechada`)
+		lex.line += strings.Count(src, "\n")
+		lex.advanceN(len(src))
+		return
+	}
+
+	value, err := unescape(dedent(src[3:end]))
+	if err != nil {
+		lex.addError(err.Error())
+	}
+	token := NewToken(STRING, value, lex.line)
+	if lines := strings.Count(src[:end], "\n"); lines > 0 {
+		token.EndLine = lex.line + lines
+		lex.line += lines
+	}
+	lex.push(token)
+	lex.advanceN(end + 3)
+}
+
+// dedent strips the newline after the opening quotes of a multi-line
+// string, the line holding only the closing quotes, and the indentation
+// common to the remaining lines. Blank lines become empty.
+func dedent(raw string) string {
+	if !strings.HasPrefix(strings.TrimLeft(raw, " \t\r"), "\n") {
+		return raw
+	}
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")[1:]
+
+	indent := -1
+	last := lines[len(lines)-1]
+	if strings.TrimLeft(last, " \t") == "" {
+		indent = len(last)
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if n := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+		} else {
+			lines[i] = line[indent:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unescape decodes the escape sequences of a string literal: \n, \t, \r,
+// \", \\, \uXXXX and \u{X...}.
+func unescape(raw string) (string, error) {
+	if !strings.Contains(raw, `\`) {
+		return raw, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			b.WriteByte(raw[i])
+			continue
+		}
+		i++
+		if i >= len(raw) {
+			return "", fmt.Errorf("sequência de escape incompleta no fim da string")
+		}
+		switch raw[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '"':
+			b.WriteByte('"')
+		case '\\':
+			b.WriteByte('\\')
+		case 'u':
+			r, n, err := unicodeEscape(raw[i+1:])
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+			i += n
+		default:
+			return "", fmt.Errorf("sequência de escape inválida: \\%c", raw[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// unicodeEscape decodes the code point after \u, written as four hex
+// digits or as one to six inside braces, and returns how many bytes it
+// took.
+func unicodeEscape(s string) (rune, int, error) {
+	digits, n := s, 4
+	if strings.HasPrefix(s, "{") {
+		end := strings.IndexByte(s, '}')
+		if end < 2 || end > 7 {
+			return 0, 0, fmt.Errorf("sequência de escape \\u{...} inválida")
+		}
+		digits, n = s[1:end], end+1
+	} else if len(s) < 4 {
+		return 0, 0, fmt.Errorf("sequência de escape \\u precisa de 4 dígitos hexadecimais")
+	} else {
+		digits = s[:4]
+	}
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, 0, fmt.Errorf("sequência de escape \\u inválida: %s", digits)
+	}
+	return rune(code), n, nil
 }
 
 func symbolHandler(lex *lexer, regex *regexp.Regexp) {
@@ -181,8 +377,8 @@ func createLexer(input string) *lexer {
 			{regexp.MustCompile(`[ \t\r]+`), skipHandler},
 			{regexp.MustCompile(`\/\/[^\n]*`), lineCommentHandler},
 			{regexp.MustCompile(`\/\*[\s\S]*?\*\/`), blockCommentHandler},
-			{regexp.MustCompile(`"[^"\n]*"`), stringHandler},
-			{regexp.MustCompile(`"[^"\n]*`), unclosedStringHandler},
+			{regexp.MustCompile(`"""`), tripleStringHandler},
+			{regexp.MustCompile(`"`), stringHandler},
 			{regexp.MustCompile(`0[xX][0-9a-fA-F]+`), hexNumberHandler},
 			{regexp.MustCompile(`[0-9]+(\.[0-9]+)?`), numberHandler},
 			{regexp.MustCompile(`[a-zA-Z_][a-zA-Z0-9_]*`), symbolHandler},
@@ -226,8 +422,9 @@ func createLexer(input string) *lexer {
 // Public API
 // ─────────────────────────────────────────────────────────────────────────────
 type TokenizeResult struct {
-	Tokens []Token
-	Errors []LexerError
+	Tokens   []Token
+	Comments []Comment
+	Errors   []LexerError
 }
 
 func (r TokenizeResult) HasErrors() bool {
@@ -266,7 +463,8 @@ func Tokenize(input string) TokenizeResult {
 	lex.push(NewToken(EOF, "EOF", lex.line))
 
 	return TokenizeResult{
-		Tokens: lex.tokens,
-		Errors: lex.errors,
+		Tokens:   lex.tokens,
+		Comments: lex.comments,
+		Errors:   lex.errors,
 	}
 }
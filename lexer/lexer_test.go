@@ -0,0 +1,81 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string // "" when the literal is valid
+	}{
+		{name: "plain", src: `"abc"`, want: "abc"},
+		{name: "newline, tab and return", src: `"a\nb\tc\rd"`, want: "a\nb\tc\rd"},
+		{name: "quote and backslash", src: `"say \"hi\" \\ bye"`, want: `say "hi" \ bye`},
+		{name: "four-digit unicode", src: `"caf\u00e9"`, want: "café"},
+		{name: "braced unicode", src: `"\u{1F600}"`, want: "😀"},
+		{name: "unknown escape", src: `"\q"`, wantErr: `sequência de escape inválida: \q`},
+		{name: "short unicode", src: `"\u12"`, wantErr: "precisa de 4 dígitos hexadecimais"},
+		{name: "bad braced unicode", src: `"\u{}"`, wantErr: `\u{...} inválida`},
+		{name: "code point out of range", src: `"\u{110000}"`, wantErr: `sequência de escape \u inválida: 110000`},
+		{name: "unterminated", src: "\"abc\nx", wantErr: "string não fechada"},
+		{name: "triple-quoted", src: "\"\"\"\n    first\n      second\n    \"\"\"", want: "first\n  second"},
+		{name: "triple-quoted escape", src: "\"\"\"\n  a\\tb\n  \"\"\"", want: "a\tb"},
+		{name: "unterminated triple-quoted", src: `"""abc`, wantErr: `string de múltiplas linhas """ não fechada`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Tokenize(tt.src)
+			if tt.wantErr != "" {
+				if !result.HasErrors() || !strings.Contains(result.Errors[0].Message, tt.wantErr) {
+					t.Fatalf("Tokenize(%s) errors = %v, want one containing %q", tt.src, result.Errors, tt.wantErr)
+				}
+				return
+			}
+			if result.HasErrors() {
+				t.Fatalf("Tokenize(%s) errors = %v", tt.src, result.Errors)
+			}
+			if tok := result.Tokens[0]; tok.Type != STRING || tok.Literal != tt.want {
+				t.Fatalf("Tokenize(%s) = %s %q, want STRING %q", tt.src, TokenTypeString(tok.Type), tok.Literal, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // doc of the fn token
+	}{
+		{name: "single line", src: "/// Approves a loan.\nfn", want: "Approves a loan."},
+		{name: "several lines", src: "/// Approves a loan.\n///\n/// Needs a score.\nfn", want: "Approves a loan.\n\nNeeds a score."},
+		{name: "plain comment", src: "// not a doc\nfn", want: ""},
+		{name: "four slashes", src: "//// banner\nfn", want: ""},
+		{name: "blank line before the token", src: "/// detached\n\nfn", want: ""},
+		{name: "blank line between comments", src: "/// old\n\n/// new\nfn", want: "new"},
+		{name: "trailing code", src: "x /// after x\nfn", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Tokenize(tt.src)
+			if result.HasErrors() {
+				t.Fatalf("Tokenize() errors = %v", result.Errors)
+			}
+			var doc string
+			for _, tok := range result.Tokens {
+				if tok.Type == FN {
+					doc = tok.Doc
+				}
+			}
+			if doc != tt.want {
+				t.Fatalf("doc = %q, want %q", doc, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package lexer
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type TokenType int
 
@@ -22,6 +25,14 @@ const (
 	HASH
 	GET_ENV
 	NONCE
+	REGISTRY
+	PARAM
+	CHECK
+	ERROR_DECL
+	TEST
+	EXPECT
+	EXPECT_REVERT
+	EXPECT_EMIT
 	// Grouping & Braces
 	OPEN_BRACKET
 	CLOSE_BRACKET
@@ -71,10 +82,13 @@ const (
 	FOREACH
 	WHILE
 	FOR
+	IN
 	TRY
 	ERROR
 	CATCH
 	RETURN
+	BREAK
+	CONTINUE
 	// Misc
 	NUM_TOKENS
 )
@@ -82,7 +96,7 @@ const (
 // IsKeyword returns true if the token type is a reserved keyword
 // (including synx-specific keywords like contract, agent, hash, nonce, etc.).
 func IsKeyword(tp TokenType) bool {
-	return (tp >= CONTRACT && tp <= NONCE) || (tp >= LET && tp <= RETURN) ||
+	return (tp >= CONTRACT && tp <= EXPECT_EMIT) || (tp >= LET && tp <= CONTINUE) ||
 		tp == NULL || tp == TRUE || tp == FALSE
 }
 
@@ -91,16 +105,19 @@ func IsKeyword(tp TokenType) bool {
 // instead of their correct types.
 var reserved_lu map[string]TokenType = map[string]TokenType{
 	// Control flow
-	"fn":      FN,
-	"if":      IF,
-	"else":    ELSE,
-	"foreach": FOREACH,
-	"while":   WHILE,
-	"for":     FOR,
-	"try":     TRY,
-	"catch":   CATCH,
-	"Error":   ERROR,
-	"return":  RETURN,
+	"fn":       FN,
+	"if":       IF,
+	"else":     ELSE,
+	"foreach":  FOREACH,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"try":      TRY,
+	"catch":    CATCH,
+	"Error":    ERROR,
+	"return":   RETURN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 	// Variables
 	"const": CONST,
 	"let":   LET,
@@ -114,16 +131,41 @@ var reserved_lu map[string]TokenType = map[string]TokenType{
 	"nonce":    NONCE,
 	"hash":     HASH,
 	"getEnv":   GET_ENV,
+	"registry": REGISTRY,
+	"param":    PARAM,
+	"check":    CHECK,
+	"error":    ERROR_DECL,
+	// Contract tests
+	"test":         TEST,
+	"expect":       EXPECT,
+	"expectRevert": EXPECT_REVERT,
+	"expectEmit":   EXPECT_EMIT,
 	// Literals — were missing, caused `true`/`false`/`null` to tokenize as IDENTIFIER
 	"true":  TRUE,
 	"false": FALSE,
 	"null":  NULL,
 }
 
+// Keywords returns the reserved words in sorted order.
+func Keywords() []string {
+	words := make([]string, 0, len(reserved_lu))
+	for word := range reserved_lu {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
 	Line    int
+	// EndLine is the last line of a token spanning several, a """ string;
+	// it is 0 for tokens on one line.
+	EndLine int
+	// Doc is the text of the /// comment block on the lines right above
+	// the token, without the slashes.
+	Doc string
 }
 
 func NewToken(t TokenType, value string, line int) Token {
@@ -176,6 +218,22 @@ func TokenTypeString(tp TokenType) string {
 		return "hash"
 	case NONCE:
 		return "nonce"
+	case REGISTRY:
+		return "registry"
+	case PARAM:
+		return "param"
+	case CHECK:
+		return "check"
+	case ERROR_DECL:
+		return "error_decl"
+	case TEST:
+		return "test"
+	case EXPECT:
+		return "expect"
+	case EXPECT_REVERT:
+		return "expect_revert"
+	case EXPECT_EMIT:
+		return "expect_emit"
 	case REQUIRE:
 		return "require"
 	case OPEN_BRACKET:
@@ -254,6 +312,8 @@ func TokenTypeString(tp TokenType) string {
 		return "foreach"
 	case FOR:
 		return "for"
+	case IN:
+		return "in"
 	case TRY:
 		return "try"
 	case ERROR:
@@ -268,6 +328,10 @@ func TokenTypeString(tp TokenType) string {
 		return "const"
 	case RETURN:
 		return "return"
+	case BREAK:
+		return "break"
+	case CONTINUE:
+		return "continue"
 	default:
 		return fmt.Sprintf("unknown(%d)", tp)
 	}
@@ -0,0 +1,183 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/lexer"
+	"github.com/peiblow/vvm/parser"
+)
+
+const testFileSuffix = "_test.snx"
+
+// document is an open source file. Diagnostics always describe the current
+// text; the index is rebuilt only when the text parses, so hover and
+// navigation keep working while an edit is half-typed.
+type document struct {
+	uri         string
+	lines       []string
+	diagnostics []Diagnostic
+	index       *index
+}
+
+func (d *document) load(text string, opts parser.Options) {
+	d.lines = strings.Split(text, "\n")
+	d.diagnostics = []Diagnostic{}
+
+	lexed := lexer.Tokenize(text)
+	if lexed.HasErrors() {
+		for _, e := range lexed.Errors {
+			d.report(e.Line, e.Message)
+		}
+		return
+	}
+
+	program, err := parser.ParseChecked(lexed.Tokens)
+	if err != nil {
+		parseErr := err.(parser.ParseError)
+		d.report(parseErr.Line, parseErr.Message)
+		return
+	}
+	d.index = newIndex(program, d.lines)
+
+	// Test files hold only test blocks; they are analyzed together with
+	// their contract by `synx test`, not on their own.
+	if strings.HasSuffix(d.uri, testFileSuffix) {
+		return
+	}
+	for _, e := range parser.AnalyzeWithOptions(program, opts).Errors {
+		line := e.Line
+		if line == 0 && d.index.contract != nil {
+			line = d.index.contract.Line
+		}
+		d.report(line, e.Message)
+	}
+}
+
+// report adds an error diagnostic spanning the text of a 1-based line.
+func (d *document) report(line int, message string) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range:    d.lineRange(line),
+		Severity: SeverityError,
+		Source:   "synx",
+		Message:  message,
+	})
+}
+
+// line returns the text of a 1-based line, or "" past the end.
+func (d *document) line(n int) string {
+	if n < 1 || n > len(d.lines) {
+		return ""
+	}
+	return strings.TrimSuffix(d.lines[n-1], "\r")
+}
+
+// lineRange spans a 1-based line from its first non-blank character.
+func (d *document) lineRange(n int) Range {
+	if n < 1 {
+		n = 1
+	}
+	text := d.line(n)
+	start := len(text) - len(strings.TrimLeft(text, " \t"))
+	return Range{
+		Start: Position{Line: n - 1, Character: utf16Len(text[:start])},
+		End:   Position{Line: n - 1, Character: utf16Len(text)},
+	}
+}
+
+// nameRange is the range of the first whole-word occurrence of name on a
+// 1-based line, or the line itself if name is not on it.
+func (d *document) nameRange(n int, name string) Range {
+	text := d.line(n)
+	if start := findWord(text, name); start >= 0 {
+		return Range{
+			Start: Position{Line: n - 1, Character: utf16Len(text[:start])},
+			End:   Position{Line: n - 1, Character: utf16Len(text[:start+len(name)])},
+		}
+	}
+	return d.lineRange(n)
+}
+
+// blockRange spans the lines of a statement.
+func (d *document) blockRange(pos ast.Pos) Range {
+	end := pos.End
+	if end < pos.Line {
+		end = pos.Line
+	}
+	return Range{Start: d.lineRange(pos.Line).Start, End: d.lineRange(end).End}
+}
+
+// wordAt returns the identifier under a position and, when it follows a
+// dot, the identifier before the dot.
+func (d *document) wordAt(pos Position) (word, qualifier string) {
+	text := d.line(pos.Line + 1)
+	at := byteOffset(text, pos.Character)
+	start, end := at, at
+	for start > 0 && isIdentByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isIdentByte(text[end]) {
+		end++
+	}
+	return text[start:end], qualifierBefore(text, start)
+}
+
+// qualifierBefore returns the identifier before a dot that ends at offset
+// at, or "".
+func qualifierBefore(text string, at int) string {
+	if at == 0 || text[at-1] != '.' {
+		return ""
+	}
+	end := at - 1
+	start := end
+	for start > 0 && isIdentByte(text[start-1]) {
+		start--
+	}
+	return text[start:end]
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+func findWord(text, word string) int {
+	for from := 0; from <= len(text)-len(word); {
+		i := strings.Index(text[from:], word)
+		if i < 0 {
+			return -1
+		}
+		i += from
+		end := i + len(word)
+		if (i == 0 || !isIdentByte(text[i-1])) && (end == len(text) || !isIdentByte(text[end])) {
+			return i
+		}
+		from = i + 1
+	}
+	return -1
+}
+
+// utf16Len is the length of s in UTF-16 code units, the unit of LSP
+// character offsets.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// byteOffset converts a UTF-16 character offset on a line to a byte offset.
+func byteOffset(text string, character int) int {
+	units := 0
+	for i := 0; i < len(text); {
+		if units >= character {
+			return i
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		units += utf16.RuneLen(r)
+		i += size
+	}
+	return len(text)
+}
@@ -0,0 +1,423 @@
+package lsp
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/compiler"
+	"github.com/peiblow/vvm/format"
+	"github.com/peiblow/vvm/lexer"
+	"github.com/peiblow/vvm/parser"
+	"github.com/peiblow/vvm/stdlib"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Hover
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *Server) hover(raw json.RawMessage) (interface{}, error) {
+	doc, pos, err := s.position(raw)
+	if err != nil || doc.index == nil {
+		return nil, err
+	}
+	word, qualifier := doc.wordAt(pos)
+	if word == "" {
+		return nil, nil
+	}
+
+	text := s.describe(doc.index, word, qualifier, pos.Line+1)
+	if text == "" {
+		return nil, nil
+	}
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: text}}, nil
+}
+
+// describe renders the hover text for word, read on a 1-based line.
+func (s *Server) describe(ix *index, word, qualifier string, line int) string {
+	if qualifier != "" {
+		var rules []string
+		for _, policy := range ix.policies(qualifier) {
+			for _, rule := range policy.Rules {
+				if rule.Key == word {
+					rules = append(rules, codeBlock(ruleString(qualifier, policy, rule)))
+				}
+			}
+		}
+		return strings.Join(rules, "\n\n")
+	}
+
+	var parts []string
+	for _, d := range ix.find(word) {
+		if fn, ok := d.stmt.(ast.FuncStmt); ok {
+			parts = append(parts, codeBlock(signature(fn)))
+		} else {
+			parts = append(parts, codeBlock(ix.source(d.pos)))
+		}
+		if doc := docOf(d.stmt); doc != "" {
+			parts[len(parts)-1] += "\n\n" + doc
+		}
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, "\n\n")
+	}
+
+	if b, ok := stdlib.Lookup(word); ok {
+		return codeBlock(builtinSignature(b)) + "\n\n" + b.Doc
+	}
+	if native, ok := s.opts.Natives[word]; ok {
+		return codeBlock(builtinSignature(native.Builtin)) + "\n\nhost native. " + native.Doc
+	}
+	if arg, fn, ok := parameterAt(ix, word, line); ok {
+		return codeBlock(nameOf(arg.ArgName)+": "+nameOf(arg.ArgType)) + "\n\nparameter of `" + nameOf(fn.Name) + "`"
+	}
+	return ""
+}
+
+// ruleString renders `Policy.rule: value`, marking params and, for a
+// versioned policy, the version the rule belongs to.
+func ruleString(name string, policy ast.PolicyStmt, rule ast.PolicyRule) string {
+	text := name + "." + rule.Key + ": "
+	if rule.Param {
+		text += "param "
+	}
+	text += ast.ExprString(rule.Value)
+	for _, r := range policy.Rules {
+		if r.Key == compiler.PolicyVersionKey {
+			text += " // version " + ast.ExprString(r.Value)
+		}
+	}
+	return text
+}
+
+func builtinSignature(b stdlib.Builtin) string {
+	params := make([]string, len(b.Params))
+	for i, kind := range b.Params {
+		params[i] = string(kind)
+		if i >= len(b.Params)-b.Optional {
+			params[i] += "?"
+		}
+		if b.Variadic && i == len(b.Params)-1 {
+			params[i] = "..." + params[i]
+		}
+	}
+	return b.Name + "(" + strings.Join(params, ", ") + "): " + string(b.Returns)
+}
+
+// parameterAt finds the parameter named word of the function around a
+// 1-based line.
+func parameterAt(ix *index, word string, line int) (ast.ArgsStmt, ast.FuncStmt, bool) {
+	d, ok := ix.enclosing(line)
+	if !ok {
+		return ast.ArgsStmt{}, ast.FuncStmt{}, false
+	}
+	fn, ok := d.stmt.(ast.FuncStmt)
+	if !ok {
+		return ast.ArgsStmt{}, ast.FuncStmt{}, false
+	}
+	for _, arg := range fn.Arguments {
+		if nameOf(arg.ArgName) == word {
+			return arg, fn, true
+		}
+	}
+	return ast.ArgsStmt{}, ast.FuncStmt{}, false
+}
+
+func codeBlock(code string) string {
+	return "```synx\n" + code + "\n```"
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Go to definition
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *Server) definition(raw json.RawMessage) (interface{}, error) {
+	doc, pos, err := s.position(raw)
+	if err != nil || doc.index == nil {
+		return nil, err
+	}
+	word, qualifier := doc.wordAt(pos)
+	if word == "" {
+		return nil, nil
+	}
+
+	var locations []Location
+	at := func(line int, name string) {
+		locations = append(locations, Location{URI: doc.uri, Range: doc.nameRange(line, name)})
+	}
+	if qualifier != "" {
+		for _, policy := range doc.index.policies(qualifier) {
+			for _, rule := range policy.Rules {
+				if rule.Key == word {
+					at(rule.Line, word)
+				}
+			}
+		}
+		return locations, nil
+	}
+
+	for _, d := range doc.index.find(word) {
+		at(d.pos.Line, d.name)
+	}
+	if len(locations) == 0 {
+		if _, fn, ok := parameterAt(doc.index, word, pos.Line+1); ok {
+			at(fn.Line, word)
+		}
+	}
+	return locations, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Completion
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *Server) completion(raw json.RawMessage) (interface{}, error) {
+	doc, pos, err := s.position(raw)
+	if err != nil || doc.index == nil {
+		return []CompletionItem{}, err
+	}
+	ix := doc.index
+	line := pos.Line + 1
+	text := doc.line(line)
+	start := byteOffset(text, pos.Character)
+	for start > 0 && isIdentByte(text[start-1]) {
+		start--
+	}
+
+	// Policy.| completes the policy's rules.
+	if qualifier := qualifierBefore(text, start); qualifier != "" {
+		items := []CompletionItem{}
+		seen := make(map[string]bool)
+		for _, policy := range ix.policies(qualifier) {
+			for _, rule := range policy.Rules {
+				if seen[rule.Key] || policyMetadata(rule.Key) {
+					continue
+				}
+				seen[rule.Key] = true
+				items = append(items, CompletionItem{
+					Label:  rule.Key,
+					Kind:   CompletionProperty,
+					Detail: ruleString(qualifier, policy, rule),
+				})
+			}
+		}
+		return items, nil
+	}
+
+	// A new line inside an agent, registry or policy block completes the
+	// fields it does not have yet.
+	if d, ok := ix.enclosing(line); ok && line > d.pos.Line && line < d.pos.End && strings.TrimSpace(text[:start]) == "" {
+		if keys, present := blockFields(d.stmt); keys != nil {
+			items := []CompletionItem{}
+			for _, key := range keys {
+				if !present[key] {
+					items = append(items, CompletionItem{Label: key, Kind: CompletionField, Detail: d.kind + " field"})
+				}
+			}
+			return items, nil
+		}
+	}
+
+	var items []CompletionItem
+	for _, keyword := range lexer.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+	for _, name := range stdlib.Names() {
+		b, _ := stdlib.Lookup(name)
+		items = append(items, CompletionItem{Label: name, Kind: CompletionFunction, Detail: builtinSignature(b), Documentation: b.Doc})
+	}
+	natives := make([]string, 0, len(s.opts.Natives))
+	for name := range s.opts.Natives {
+		natives = append(natives, name)
+	}
+	sort.Strings(natives)
+	for _, name := range natives {
+		native := s.opts.Natives[name]
+		items = append(items, CompletionItem{Label: name, Kind: CompletionFunction, Detail: builtinSignature(native.Builtin), Documentation: native.Doc})
+	}
+
+	seen := make(map[string]bool)
+	for _, d := range ix.decls {
+		if d.kind == "test" || seen[d.name] {
+			continue
+		}
+		seen[d.name] = true
+		item := CompletionItem{Label: d.name, Detail: d.kind, Documentation: docOf(d.stmt)}
+		switch d.kind {
+		case "fn":
+			item.Kind = CompletionFunction
+			item.Detail = signature(d.stmt.(ast.FuncStmt))
+		case "type":
+			item.Kind = CompletionStruct
+		case "error":
+			item.Kind = CompletionClass
+		case "policy":
+			item.Kind = CompletionModule
+		default:
+			item.Kind = CompletionVariable
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// blockFields returns the field keys a declaration block accepts and the
+// ones it already has, or nil keys for blocks whose fields are free-form.
+func blockFields(stmt ast.Stmt) ([]string, map[string]bool) {
+	present := make(map[string]bool)
+	switch s := stmt.(type) {
+	case ast.AgentStmt:
+		for _, f := range s.Fields {
+			present[f.Key] = true
+		}
+		return parser.AgentFieldOrder(), present
+	case ast.RegistryStmt:
+		for _, f := range s.Fields {
+			present[f.Key] = true
+		}
+		return parser.RegistryFieldOrder(), present
+	case ast.PolicyStmt:
+		for _, r := range s.Rules {
+			present[r.Key] = true
+		}
+		return []string{compiler.PolicyVersionKey, compiler.PolicyEffectiveFromKey, compiler.PolicyEffectiveUntilKey}, present
+	}
+	return nil, nil
+}
+
+func policyMetadata(key string) bool {
+	return key == compiler.PolicyVersionKey || key == compiler.PolicyEffectiveFromKey || key == compiler.PolicyEffectiveUntilKey
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Document symbols
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *Server) documentSymbol(raw json.RawMessage) (interface{}, error) {
+	var params DocumentParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+	doc, err := s.lookup(params.TextDocument.URI)
+	if err != nil || doc.index == nil {
+		return []DocumentSymbol{}, err
+	}
+
+	symbols := []DocumentSymbol{}
+	for _, d := range doc.index.decls {
+		symbols = append(symbols, declSymbol(doc, d))
+	}
+	if contract := doc.index.contract; contract != nil {
+		return []DocumentSymbol{{
+			Name:           contract.Identifier,
+			Detail:         "contract",
+			Kind:           SymbolClass,
+			Range:          doc.blockRange(contract.Pos),
+			SelectionRange: doc.nameRange(contract.Line, contract.Identifier),
+			Children:       symbols,
+		}}, nil
+	}
+	return symbols, nil
+}
+
+func declSymbol(doc *document, d decl) DocumentSymbol {
+	sym := DocumentSymbol{
+		Name:           d.name,
+		Detail:         d.kind,
+		Range:          doc.blockRange(d.pos),
+		SelectionRange: doc.nameRange(d.pos.Line, d.name),
+	}
+	field := func(key, detail string, line, kind int) {
+		sym.Children = append(sym.Children, DocumentSymbol{
+			Name:           key,
+			Detail:         detail,
+			Kind:           kind,
+			Range:          doc.lineRange(line),
+			SelectionRange: doc.nameRange(line, key),
+		})
+	}
+
+	switch s := d.stmt.(type) {
+	case ast.FuncStmt:
+		sym.Kind = SymbolFunction
+		sym.Detail = strings.TrimPrefix(signature(s), "fn "+d.name)
+	case ast.TypeDeclareStmt:
+		sym.Kind = SymbolStruct
+		for _, f := range s.Fields {
+			field(f.Name, nameOf(f.Type), f.Line, SymbolField)
+		}
+	case ast.ErrorDeclStmt:
+		sym.Kind = SymbolEvent
+		for _, f := range s.Fields {
+			field(f.Name, nameOf(f.Type), f.Line, SymbolField)
+		}
+	case ast.PolicyStmt:
+		sym.Kind = SymbolObject
+		for _, r := range s.Rules {
+			if r.Key == compiler.PolicyVersionKey {
+				sym.Detail = "policy " + ast.ExprString(r.Value)
+			}
+			field(r.Key, ast.ExprString(r.Value), r.Line, SymbolProperty)
+		}
+	case ast.AgentStmt:
+		sym.Kind = SymbolObject
+		for _, f := range s.Fields {
+			field(f.Key, ast.ExprString(f.Value), f.Line, SymbolField)
+		}
+	case ast.RegistryStmt:
+		sym.Kind = SymbolObject
+		sym.Detail = "registry " + s.Kind
+		for _, f := range s.Fields {
+			field(f.Key, ast.ExprString(f.Value), f.Line, SymbolField)
+		}
+	case ast.TestStmt:
+		sym.Kind = SymbolMethod
+		sym.SelectionRange = doc.lineRange(d.pos.Line)
+	}
+	return sym
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Formatting
+// ─────────────────────────────────────────────────────────────────────────────
+
+// formatting replaces the whole document with its formatted source. Source
+// that does not parse is left alone; its diagnostics say why.
+func (s *Server) formatting(raw json.RawMessage) (interface{}, error) {
+	var params DocumentParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+	doc, err := s.lookup(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.Join(doc.lines, "\n")
+	out, err := format.Source([]byte(text))
+	if err != nil {
+		return nil, nil
+	}
+	if string(out) == text {
+		return []TextEdit{}, nil
+	}
+	last := len(doc.lines)
+	return []TextEdit{{
+		Range: Range{
+			Start: Position{Line: 0, Character: 0},
+			End:   Position{Line: last - 1, Character: utf16Len(doc.lines[last-1])},
+		},
+		NewText: string(out),
+	}}, nil
+}
+
+// position decodes the document and position of a positional request.
+func (s *Server) position(raw json.RawMessage) (*document, Position, error) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, Position{}, err
+	}
+	doc, err := s.lookup(params.TextDocument.URI)
+	return doc, params.Position, err
+}
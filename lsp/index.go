@@ -0,0 +1,169 @@
+package lsp
+
+import (
+	"strings"
+
+	"github.com/peiblow/vvm/ast"
+)
+
+// decl is a contract-level declaration.
+type decl struct {
+	kind string // "fn", "type", "error", "policy", "agent", "registry" or "test"
+	name string
+	stmt ast.Stmt
+	pos  ast.Pos
+}
+
+// index lists the declarations of a document that parsed, with the source
+// they were parsed from.
+type index struct {
+	contract *ast.ContractStmt
+	decls    []decl
+	lines    []string
+}
+
+func newIndex(program ast.BlockStmt, lines []string) *index {
+	ix := &index{lines: lines}
+	body := program.Body
+	for _, stmt := range program.Body {
+		if contract, ok := stmt.(ast.ContractStmt); ok {
+			ix.contract = &contract
+			body = contract.Body
+			break
+		}
+	}
+
+	for _, stmt := range body {
+		var d decl
+		switch s := stmt.(type) {
+		case ast.FuncStmt:
+			d = decl{kind: "fn", name: nameOf(s.Name), pos: s.Pos}
+		case ast.TypeDeclareStmt:
+			d = decl{kind: "type", name: nameOf(s.Name), pos: s.Pos}
+		case ast.ErrorDeclStmt:
+			d = decl{kind: "error", name: s.Name, pos: s.Pos}
+		case ast.PolicyStmt:
+			d = decl{kind: "policy", name: nameOf(s.Identifier), pos: s.Pos}
+		case ast.AgentStmt:
+			d = decl{kind: "agent", name: nameOf(s.Identifier), pos: s.Pos}
+		case ast.RegistryStmt:
+			d = decl{kind: "registry", name: nameOf(s.Identifier), pos: s.Pos}
+		case ast.TestStmt:
+			d = decl{kind: "test", name: s.Name, pos: s.Pos}
+		default:
+			continue
+		}
+		d.stmt = stmt
+		ix.decls = append(ix.decls, d)
+	}
+	return ix
+}
+
+// find returns the declarations named name. Tests are not referable by
+// name and never match. A policy declared in several versions has one
+// declaration per version.
+func (ix *index) find(name string) []decl {
+	var found []decl
+	for _, d := range ix.decls {
+		if d.name == name && d.kind != "test" {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// policies returns the versions of the policy named name.
+func (ix *index) policies(name string) []ast.PolicyStmt {
+	var found []ast.PolicyStmt
+	for _, d := range ix.find(name) {
+		if policy, ok := d.stmt.(ast.PolicyStmt); ok {
+			found = append(found, policy)
+		}
+	}
+	return found
+}
+
+// enclosing returns the declaration whose lines contain a 1-based line.
+func (ix *index) enclosing(line int) (decl, bool) {
+	for _, d := range ix.decls {
+		if d.pos.Line <= line && line <= d.pos.End {
+			return d, true
+		}
+	}
+	return decl{}, false
+}
+
+// source returns the lines of a declaration with their common indentation
+// removed.
+func (ix *index) source(pos ast.Pos) string {
+	if pos.Line < 1 || pos.End > len(ix.lines) || pos.End < pos.Line {
+		return ""
+	}
+	lines := ix.lines[pos.Line-1 : pos.End]
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if len(line) >= indent {
+			line = line[indent:]
+		}
+		out[i] = line
+	}
+	return strings.Join(out, "\n")
+}
+
+// signature renders a function's header, `fn name(a: T): R`.
+func signature(fn ast.FuncStmt) string {
+	args := make([]string, len(fn.Arguments))
+	for i, arg := range fn.Arguments {
+		args[i] = nameOf(arg.ArgName) + ": " + nameOf(arg.ArgType)
+	}
+	sig := "fn " + nameOf(fn.Name) + "(" + strings.Join(args, ", ") + ")"
+	if fn.ReturnType != nil {
+		sig += ": " + typeString(fn.ReturnType)
+	}
+	return sig
+}
+
+// docOf returns the /// comment of a function, policy or type declaration.
+func docOf(stmt ast.Stmt) string {
+	switch s := stmt.(type) {
+	case ast.FuncStmt:
+		return s.Doc
+	case ast.PolicyStmt:
+		return s.Doc
+	case ast.TypeDeclareStmt:
+		return s.Doc
+	}
+	return ""
+}
+
+func nameOf(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case ast.SymbolExpr:
+		return e.Value
+	case ast.ExpressionStmt:
+		return nameOf(e.Expression)
+	}
+	return ast.ExprString(expr)
+}
+
+func typeString(t ast.Type) string {
+	switch t := t.(type) {
+	case ast.SymbolType:
+		return t.Name
+	case ast.ArrayType:
+		return "[]" + typeString(t.Underlying)
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+// Package lsp implements a Language Server Protocol server for Synx over
+// stdio. It runs the lexer, parser and analyzer on every change and
+// publishes their errors as diagnostics, and answers hover, go-to-definition,
+// completion, document symbol and formatting requests from the last version
+// of each document that parsed.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/peiblow/vvm/parser"
+)
+
+// Server holds the open documents of one client connection.
+type Server struct {
+	out         io.Writer
+	opts        parser.Options
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+// Serve runs a server on in and out until the client sends exit. opts are
+// the natives and strictness the analyzer checks documents with. It returns
+// an error if the connection breaks or the client exits without shutting
+// the server down first.
+func Serve(in io.Reader, out io.Writer, opts parser.Options) error {
+	s := &Server{out: out, opts: opts, docs: make(map[string]*document)}
+	r := bufio.NewReader(in)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("connection closed before exit")
+			}
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+		if err := s.dispatch(req); err != nil {
+			return err
+		}
+	}
+}
+
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var requests = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"shutdown":                    (*Server).shutdownRequest,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/formatting":     (*Server).formatting,
+}
+
+var notifications = map[string]handler{
+	"textDocument/didOpen":   (*Server).didOpen,
+	"textDocument/didChange": (*Server).didChange,
+	"textDocument/didClose":  (*Server).didClose,
+}
+
+// dispatch handles one message. Unknown notifications are ignored, as the
+// protocol requires; only failures to write to the client are returned.
+func (s *Server) dispatch(req request) error {
+	if req.isNotification() {
+		h, ok := notifications[req.Method]
+		if !ok || !s.initialized {
+			return nil
+		}
+		_, err := h(s, req.Params)
+		return err
+	}
+
+	h, ok := requests[req.Method]
+	switch {
+	case !ok:
+		return s.reply(req.ID, nil, &responseError{Code: codeMethodNotFound, Message: "method not supported: " + req.Method})
+	case !s.initialized && req.Method != "initialize":
+		return s.reply(req.ID, nil, &responseError{Code: codeServerNotInitialized, Message: "server not initialized"})
+	case s.shutdown:
+		return s.reply(req.ID, nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"})
+	}
+
+	result, err := h(s, req.Params)
+	if err != nil {
+		var rpcErr *responseError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return s.reply(req.ID, nil, rpcErr)
+	}
+	return s.reply(req.ID, result, nil)
+}
+
+func (s *Server) reply(id json.RawMessage, result interface{}, rpcErr *responseError) error {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	resp := response{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = raw
+	}
+	return writeMessage(s.out, resp)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Lifecycle
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *Server) initialize(json.RawMessage) (interface{}, error) {
+	s.initialized = true
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": map[string]interface{}{
+				"openClose": true,
+				"change":    1, // full document on every change
+			},
+			"hoverProvider":              true,
+			"definitionProvider":         true,
+			"completionProvider":         map[string]interface{}{"triggerCharacters": []string{"."}},
+			"documentSymbolProvider":     true,
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "synx"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Document synchronization
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *Server) didOpen(raw json.RawMessage) (interface{}, error) {
+	var params DidOpenTextDocumentParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, nil
+	}
+	doc := &document{uri: params.TextDocument.URI}
+	s.docs[doc.uri] = doc
+	return nil, s.update(doc, params.TextDocument.Text)
+}
+
+func (s *Server) didChange(raw json.RawMessage) (interface{}, error) {
+	var params DidChangeTextDocumentParams
+	if err := json.Unmarshal(raw, &params); err != nil || len(params.ContentChanges) == 0 {
+		return nil, nil
+	}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return nil, s.update(doc, params.ContentChanges[len(params.ContentChanges)-1].Text)
+}
+
+func (s *Server) didClose(raw json.RawMessage) (interface{}, error) {
+	var params DidCloseTextDocumentParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, nil
+	}
+	delete(s.docs, params.TextDocument.URI)
+	// Clear the closed document's diagnostics.
+	return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         params.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+// update re-analyzes doc with its new text and publishes its diagnostics.
+func (s *Server) update(doc *document, text string) error {
+	doc.load(text, s.opts)
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Diagnostics: doc.diagnostics,
+	})
+}
+
+// lookup returns the open document a request refers to.
+func (s *Server) lookup(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: "document is not open: " + uri}
+	}
+	return doc, nil
+}
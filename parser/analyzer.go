@@ -2,9 +2,14 @@ package parser
 
 import (
 	"fmt"
+	"math"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/stdlib"
 )
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -31,6 +36,7 @@ var builtinFunctions = map[string]bool{
 // ─────────────────────────────────────────────────────────────────────────────
 type SemanticError struct {
 	Message string
+	Line    int // source line of the offending statement or field, 0 if unknown
 }
 
 func (e SemanticError) Error() string {
@@ -64,33 +70,69 @@ func (r AnalysisResult) Format() string {
 // Analyzer
 // ─────────────────────────────────────────────────────────────────────────────
 type Analyzer struct {
-	errors            []SemanticError
-	userTypes         map[string]map[string]string
-	declaredFunctions map[string]int
-	declaredAgents    map[string]bool
-	declaredPolicies  map[string]bool
+	errors             []SemanticError
+	userTypes          map[string]map[string]string
+	declaredFunctions  map[string]int
+	declaredAgents     map[string]bool
+	declaredRegistries map[string]string // name -> kind
+	declaredPolicies   map[string]bool
+	policyVersions     map[string][]policyWindow
+	declaredErrors     map[string][]ast.TypeField
+	declaredTests      map[string]bool
+	loopDepth          int
+	inTest             bool
+	line               int // source line of the node being analyzed
+	natives            map[string]stdlib.Native
+	strict             bool
+}
+
+// Options carries deploy-time context the source alone does not provide.
+type Options struct {
+	// Natives are the host functions registered with the runtime.
+	Natives map[string]stdlib.Native
+	// Strict rejects calls to non-deterministic natives.
+	Strict bool
 }
 
 func newAnalyzer() *Analyzer {
 	return &Analyzer{
-		userTypes:         make(map[string]map[string]string),
-		declaredFunctions: make(map[string]int),
-		declaredAgents:    make(map[string]bool),
-		declaredPolicies:  make(map[string]bool),
+		userTypes:          make(map[string]map[string]string),
+		declaredFunctions:  make(map[string]int),
+		declaredAgents:     make(map[string]bool),
+		declaredRegistries: make(map[string]string),
+		declaredPolicies:   make(map[string]bool),
+		policyVersions:     make(map[string][]policyWindow),
+		declaredErrors:     make(map[string][]ast.TypeField),
+		declaredTests:      make(map[string]bool),
 	}
 }
 
 func (a *Analyzer) addError(format string, args ...interface{}) {
 	a.errors = append(a.errors, SemanticError{
 		Message: fmt.Sprintf(format, args...),
+		Line:    a.line,
 	})
 }
 
+// at makes errors reported from here on point at node's line.
+func (a *Analyzer) at(node ast.Stmt) {
+	if positioned, ok := node.(ast.Positioned); ok && positioned.Position().Line > 0 {
+		a.line = positioned.Position().Line
+	}
+}
+
 // ─────────────────────────────────────────────────────────────────────────────
 // Entry point — receives the ast.BlockStmt from parser.Parse()
 // ─────────────────────────────────────────────────────────────────────────────
 func Analyze(block ast.BlockStmt) AnalysisResult {
+	return AnalyzeWithOptions(block, Options{})
+}
+
+// AnalyzeWithOptions is Analyze with host natives and strict mode applied.
+func AnalyzeWithOptions(block ast.BlockStmt, opts Options) AnalysisResult {
 	a := newAnalyzer()
+	a.natives = opts.Natives
+	a.strict = opts.Strict
 
 	for _, stmt := range block.Body {
 		if contract, ok := stmt.(ast.ContractStmt); ok {
@@ -104,39 +146,117 @@ func Analyze(block ast.BlockStmt) AnalysisResult {
 	return AnalysisResult{Errors: a.errors}
 }
 
+// Scope lists what statements analyzed outside a contract can refer to:
+// the declarations of a contract that has already been compiled.
+type Scope struct {
+	Functions map[string]int             // name -> parameter count
+	Errors    map[string][]ast.TypeField // declared error types
+	Agents    []string
+	Policies  []string
+	Variables []string
+}
+
+// AnalyzeStatements analyzes statements as if they were the body of a
+// function in a contract declaring scope, such as input typed into the
+// REPL. Messages carry no function name.
+func AnalyzeStatements(stmts []ast.Stmt, scope Scope, opts Options) AnalysisResult {
+	a := newAnalyzer()
+	a.natives = opts.Natives
+	a.strict = opts.Strict
+	for name, params := range scope.Functions {
+		a.declaredFunctions[name] = params
+	}
+	for name, fields := range scope.Errors {
+		a.declaredErrors[name] = fields
+	}
+	for _, name := range scope.Agents {
+		a.declaredAgents[name] = true
+	}
+	for _, name := range scope.Policies {
+		a.declaredPolicies[name] = true
+	}
+	vars := make(map[string]bool, len(scope.Variables))
+	for _, name := range scope.Variables {
+		vars[name] = true
+	}
+
+	const fnName = "<input>"
+	for _, stmt := range stmts {
+		a.analyzeStmt(stmt, fnName, vars)
+	}
+
+	prefix := fmt.Sprintf("fn '%s': ", fnName)
+	for i := range a.errors {
+		a.errors[i].Message = strings.TrimPrefix(a.errors[i].Message, prefix)
+	}
+	return AnalysisResult{Errors: a.errors}
+}
+
 // ─────────────────────────────────────────────────────────────────────────────
 // Contract — two-pass analysis
 // ─────────────────────────────────────────────────────────────────────────────
 func (a *Analyzer) analyzeContract(contract ast.ContractStmt) {
+	a.at(contract)
 	if contract.Identifier == "" {
 		a.addError("contract is missing a name")
 	}
 
 	for _, node := range contract.Body {
+		a.at(node)
 		switch s := node.(type) {
 		case ast.TypeDeclareStmt:
 			a.registerType(s)
+		case ast.ErrorDeclStmt:
+			a.registerError(s)
+		case ast.RegistryStmt:
+			a.registerRegistry(s)
 		case ast.AgentStmt:
 			a.declaredAgents[symbolName(s.Identifier)] = true
 		case ast.PolicyStmt:
 			a.declaredPolicies[symbolName(s.Identifier)] = true
 		case ast.FuncStmt:
-			a.declaredFunctions[symbolName(s.Name)] = len(s.Arguments)
+			name := symbolName(s.Name)
+			if _, isBuiltin := stdlib.Lookup(name); isBuiltin {
+				a.addError("fn '%s' shadows the builtin function of the same name", name)
+			}
+			if _, isNative := a.natives[name]; isNative {
+				a.addError("fn '%s' shadows the native function of the same name", name)
+			}
+			if _, isError := a.declaredErrors[name]; isError {
+				a.addError("fn '%s' has the same name as a declared error", name)
+			}
+			a.declaredFunctions[name] = len(s.Arguments)
+		case ast.TestStmt:
+			if s.Name == "" {
+				a.addError("test is missing a name")
+			} else if a.declaredTests[s.Name] {
+				a.addError("test '%s' is declared more than once", s.Name)
+			}
+			a.declaredTests[s.Name] = true
 		}
 	}
 
 	for _, node := range contract.Body {
+		a.at(node)
 		switch s := node.(type) {
 		case ast.TypeDeclareStmt:
 			a.analyzeTypeDecl(s)
+		case ast.ErrorDeclStmt:
+			a.analyzeErrorDecl(s)
+		case ast.RegistryStmt:
+			a.analyzeRegistry(s)
 		case ast.AgentStmt:
 			a.analyzeAgent(s)
 		case ast.PolicyStmt:
 			a.analyzePolicy(s)
 		case ast.FuncStmt:
 			a.analyzeFunc(s)
+		case ast.TestStmt:
+			a.analyzeTest(s)
 		}
 	}
+
+	a.checkPolicyVersions()
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -153,8 +273,8 @@ func (a *Analyzer) registerType(s ast.TypeDeclareStmt) {
 		return
 	}
 	fields := make(map[string]string)
-	for fieldName, fieldTypeExpr := range s.Fields {
-		fields[fieldName] = symbolName(fieldTypeExpr)
+	for _, field := range s.Fields {
+		fields[field.Name] = symbolName(field.Type)
 	}
 	a.userTypes[name] = fields
 }
@@ -167,8 +287,17 @@ func (a *Analyzer) analyzeTypeDecl(s ast.TypeDeclareStmt) {
 		return
 	}
 
-	for fieldName, fieldTypeExpr := range s.Fields {
-		fieldTypeName := symbolName(fieldTypeExpr)
+	seen := make(map[string]bool)
+	for _, field := range s.Fields {
+		a.line = field.Line
+		fieldName := field.Name
+		if seen[fieldName] {
+			a.addError("type '%s': field '%s' is declared more than once", typeName, fieldName)
+			continue
+		}
+		seen[fieldName] = true
+
+		fieldTypeName := symbolName(field.Type)
 		if fieldTypeName == "" {
 			a.addError("type '%s': field '%s' is missing a type annotation", typeName, fieldName)
 			continue
@@ -180,6 +309,101 @@ func (a *Analyzer) analyzeTypeDecl(s ast.TypeDeclareStmt) {
 	}
 }
 
+// ─────────────────────────────────────────────────────────────────────────────
+// Error declarations
+// ─────────────────────────────────────────────────────────────────────────────
+func (a *Analyzer) registerError(s ast.ErrorDeclStmt) {
+	if _, exists := a.declaredErrors[s.Name]; exists {
+		a.addError("error '%s' is declared more than once", s.Name)
+		return
+	}
+	if _, isType := a.userTypes[s.Name]; isType || builtinTypes[s.Name] {
+		a.addError("error '%s' has the same name as a type", s.Name)
+	}
+	a.declaredErrors[s.Name] = s.Fields
+}
+
+func (a *Analyzer) analyzeErrorDecl(s ast.ErrorDeclStmt) {
+	seen := make(map[string]bool)
+	for _, field := range s.Fields {
+		a.line = field.Line
+		if seen[field.Name] {
+			a.addError("error '%s': field '%s' is declared more than once", s.Name, field.Name)
+			continue
+		}
+		seen[field.Name] = true
+
+		fieldTypeName := symbolName(field.Type)
+		if fieldTypeName == "" {
+			a.addError("error '%s': field '%s' is missing a type annotation", s.Name, field.Name)
+			continue
+		}
+		a.validateTypeName(fieldTypeName, fmt.Sprintf("error '%s', field '%s'", s.Name, field.Name))
+	}
+}
+
+// checkErrorCall validates a call that raises a declared error: one
+// argument per field, optionally followed by a message.
+func (a *Analyzer) checkErrorCall(name string, fields []ast.TypeField, args []ast.Expr, fnName string) {
+	if len(args) != len(fields) && len(args) != len(fields)+1 {
+		a.addError("fn '%s': error '%s' expects %d argument(s) (plus an optional message), got %d",
+			fnName, name, len(fields), len(args))
+		return
+	}
+	if len(args) > len(fields) {
+		if kind, ok := literalKind(args[len(fields)]); ok && kind != stdlib.String {
+			a.addError("fn '%s': error '%s': message must be a String, got %s", fnName, name, kind)
+		}
+	}
+}
+
+// isErrorValue reports whether expr builds an error object on its own,
+// either Error(code, message) or a call to a declared error.
+func (a *Analyzer) isErrorValue(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case ast.ErrorExpr:
+		return true
+	case ast.CallExpr:
+		_, declared := a.declaredErrors[symbolName(e.Calle)]
+		return declared
+	}
+	return false
+}
+
+// analyzeAssertion checks the arguments of require and check.
+func (a *Analyzer) analyzeAssertion(keyword string, cond, code, message, details ast.Expr, fnName string, scope map[string]bool) {
+	a.analyzeExpr(cond, fnName, scope)
+	for _, arg := range []ast.Expr{code, message, details} {
+		if arg != nil {
+			a.analyzeExpr(arg, fnName, scope)
+		}
+	}
+
+	if code == nil && a.isErrorValue(message) {
+		return
+	}
+	if code != nil && a.isErrorValue(message) {
+		a.addError("fn '%s': %s() cannot combine a code with an error value", fnName, keyword)
+	}
+	if symbolName(message) == "" {
+		if _, isStr := message.(ast.StringExpr); !isStr {
+			a.addError("fn '%s': %s() is missing an error message", fnName, keyword)
+		}
+	}
+	if code != nil {
+		if kind, ok := literalKind(code); ok {
+			if str, isStr := code.(ast.StringExpr); !isStr || str.Value == "" {
+				a.addError("fn '%s': %s() error code must be a non-empty String, got %s", fnName, keyword, kind)
+			}
+		}
+	}
+	if details != nil {
+		if kind, ok := literalKind(details); ok && kind != stdlib.Object {
+			a.addError("fn '%s': %s() details must be an object, got %s", fnName, keyword, kind)
+		}
+	}
+}
+
 func (a *Analyzer) analyzeParamType(t ast.Type, context string) {
 	if t == nil {
 		a.addError("%s: missing type annotation", context)
@@ -211,20 +435,216 @@ func (a *Analyzer) validateTypeName(typeName string, context string) {
 // ─────────────────────────────────────────────────────────────────────────────
 // Agent declarations
 // ─────────────────────────────────────────────────────────────────────────────
+// metadataField describes one key accepted by an agent or registry block.
+// check returns a description of what is wrong with a value, or "".
+type metadataField struct {
+	key      string
+	required bool
+	check    func(ast.Expr) string
+}
+
+// agentFields lists, in canonical order, the keys an agent block accepts.
+var agentFields = []metadataField{
+	{"hash", true, checkAgentHash},
+	{"version", true, checkScalarLiteral},
+	{"owner", true, checkScalarLiteral},
+	{"registry", false, checkRegistryRef},
+	{"purpose", false, checkScalarLiteral},
+	{"capabilities", false, checkStringList},
+	{"risk_tier", false, checkRiskTier},
+	{"expiry", false, checkExpiry},
+	{"jurisdiction", false, checkStringOrList},
+}
+
+// registryFields lists, in canonical order, the keys a registry block accepts.
+var registryFields = []metadataField{
+	{"version", true, checkScalarLiteral},
+	{"owner", true, checkScalarLiteral},
+	{"hash", false, checkAgentHash},
+	{"purpose", false, checkScalarLiteral},
+}
+
+// AgentFieldOrder returns the keys of an agent block in canonical order.
+func AgentFieldOrder() []string {
+	return fieldKeys(agentFields)
+}
+
+// RegistryFieldOrder returns the keys of a registry block in canonical order.
+func RegistryFieldOrder() []string {
+	return fieldKeys(registryFields)
+}
+
+func fieldKeys(fields []metadataField) []string {
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		keys[i] = f.key
+	}
+	return keys
+}
+
+// registryKinds are the kinds a registry entry may be declared as.
+var registryKinds = []string{"Model", "Dataset", "Tool"}
+
+// riskTiers are the accepted values of an agent's risk_tier field.
+var riskTiers = []string{"low", "medium", "high", "critical"}
+
+var agentHashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+func (a *Analyzer) registerRegistry(s ast.RegistryStmt) {
+	name := symbolName(s.Identifier)
+	if _, exists := a.declaredRegistries[name]; exists {
+		a.addError("registry '%s' is declared more than once", name)
+		return
+	}
+	a.declaredRegistries[name] = s.Kind
+}
+
+func (a *Analyzer) analyzeRegistry(s ast.RegistryStmt) {
+	name := symbolName(s.Identifier)
+	validKind := false
+	for _, kind := range registryKinds {
+		if s.Kind == kind {
+			validKind = true
+		}
+	}
+	if !validKind {
+		a.addError("registry '%s': unknown kind '%s' (expected one of %s)",
+			name, s.Kind, strings.Join(registryKinds, ", "))
+	}
+	a.checkMetadataFields("registry", name, s.Fields, registryFields)
+}
+
 func (a *Analyzer) analyzeAgent(s ast.AgentStmt) {
 	name := symbolName(s.Identifier)
 	if name == "" {
 		a.addError("agent declaration is missing a name")
 	}
-	if symbolName(s.Version) == "" {
-		a.addError("agent '%s': missing 'version' field", name)
+	a.checkMetadataFields("agent", name, s.Fields, agentFields)
+
+	ref := s.Field("registry")
+	if ref == nil {
+		return
+	}
+	regName := symbolName(ref)
+	kind, exists := a.declaredRegistries[regName]
+	switch {
+	case regName == "":
+		// Already reported by checkRegistryRef.
+	case !exists:
+		a.addError("agent '%s': references undeclared registry '%s'", name, regName)
+	case kind != "Model":
+		a.addError("agent '%s': registry '%s' is a %s; agents must reference a Model", name, regName, kind)
+	}
+}
+
+// checkMetadataFields reports duplicate, unknown, malformed and missing
+// fields of an agent or registry block.
+func (a *Analyzer) checkMetadataFields(what, name string, fields []ast.MetadataField, specs []metadataField) {
+	declLine := a.line
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		a.line = field.Line
+		if seen[field.Key] {
+			a.addError("%s '%s': field '%s' is declared more than once", what, name, field.Key)
+			continue
+		}
+		seen[field.Key] = true
+
+		known := false
+		for _, spec := range specs {
+			if spec.key != field.Key {
+				continue
+			}
+			known = true
+			if problem := spec.check(field.Value); problem != "" {
+				a.addError("%s '%s': field '%s' %s", what, name, field.Key, problem)
+			}
+		}
+		if !known {
+			a.addError("%s '%s': unknown field '%s'", what, name, field.Key)
+		}
+	}
+	a.line = declLine
+
+	for _, spec := range specs {
+		if spec.required && !seen[spec.key] {
+			a.addError("%s '%s': missing '%s' field", what, name, spec.key)
+		}
 	}
-	if symbolName(s.Owner) == "" {
-		a.addError("agent '%s': missing 'owner' field", name)
+}
+
+func checkRegistryRef(expr ast.Expr) string {
+	switch expr.(type) {
+	case ast.SymbolExpr, ast.StringExpr:
+		return ""
 	}
-	if symbolName(s.Purpose) == "" {
-		a.addError("agent '%s': missing 'purpose' field", name)
+	return "must name a registry entry"
+}
+
+func checkScalarLiteral(expr ast.Expr) string {
+	switch expr.(type) {
+	case ast.StringExpr, ast.NumberExpr:
+		return ""
+	}
+	return "must be a string or number literal"
+}
+
+func checkAgentHash(expr ast.Expr) string {
+	str, ok := expr.(ast.StringExpr)
+	if !ok || !agentHashPattern.MatchString(str.Value) {
+		return "must be a 0x-prefixed SHA-256 digest (64 hex digits)"
+	}
+	return ""
+}
+
+func checkStringList(expr ast.Expr) string {
+	arr, ok := expr.(ast.ArrayLiteralExpr)
+	if !ok {
+		return "must be an array of strings"
+	}
+	for _, item := range arr.Items {
+		if _, ok := item.(ast.StringExpr); !ok {
+			return "must be an array of strings"
+		}
+	}
+	return ""
+}
+
+func checkStringOrList(expr ast.Expr) string {
+	if _, ok := expr.(ast.StringExpr); ok {
+		return ""
+	}
+	if checkStringList(expr) == "" {
+		return ""
+	}
+	return "must be a string or an array of strings"
+}
+
+func checkRiskTier(expr ast.Expr) string {
+	if str, ok := expr.(ast.StringExpr); ok {
+		for _, tier := range riskTiers {
+			if str.Value == tier {
+				return ""
+			}
+		}
+	}
+	return fmt.Sprintf("must be one of %s", strings.Join(riskTiers, ", "))
+}
+
+func checkExpiry(expr ast.Expr) string {
+	if str, ok := expr.(ast.StringExpr); ok {
+		if _, err := parseDate(str.Value); err == nil {
+			return ""
+		}
 	}
+	return "must be a date (YYYY-MM-DD) or RFC 3339 timestamp string"
+}
+
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -235,9 +655,189 @@ func (a *Analyzer) analyzePolicy(s ast.PolicyStmt) {
 	if name == "" {
 		a.addError("policy declaration is missing a name")
 	}
-	if len(s.Rules) == 0 {
+
+	window := policyWindow{line: s.Line}
+	rules := 0
+	seen := make(map[string]bool)
+	for _, rule := range s.Rules {
+		a.line = rule.Line
+		if seen[rule.Key] {
+			a.addError("policy '%s': rule '%s' is declared more than once", name, rule.Key)
+		}
+		seen[rule.Key] = true
+
+		if policyMetadata[rule.Key] {
+			if rule.Param {
+				a.addError("policy '%s': %s cannot be a param", name, rule.Key)
+			}
+			a.analyzePolicyMetadata(name, rule, &window)
+			continue
+		}
+		rules++
+
+		if problem := nonConstant(rule.Value); problem != "" {
+			a.addError("policy '%s': rule '%s' must be a constant expression — %s", name, rule.Key, problem)
+		}
+	}
+	a.at(s)
+	if rules == 0 {
 		a.addError("policy '%s' has no rules defined", name)
 	}
+	if !window.from.IsZero() && !window.until.IsZero() && !window.from.Before(window.until) {
+		a.addError("policy '%s': effective_from must be before effective_until", name)
+	}
+
+	a.policyVersions[name] = append(a.policyVersions[name], window)
+}
+
+// policyMetadata are the policy keys that describe the policy itself rather
+// than a rule. They select which version is in force at execution time.
+var policyMetadata = map[string]bool{
+	"version":         true,
+	"effective_from":  true,
+	"effective_until": true,
+}
+
+// policyWindow is the version and validity window of one policy block. Zero
+// times leave that side of the window open.
+type policyWindow struct {
+	version     string
+	from, until time.Time
+	line        int
+}
+
+func (w policyWindow) overlaps(o policyWindow) bool {
+	startsBeforeEnd := func(start, end time.Time) bool {
+		return start.IsZero() || end.IsZero() || start.Before(end)
+	}
+	return startsBeforeEnd(w.from, o.until) && startsBeforeEnd(o.from, w.until)
+}
+
+// conflicts reports whether w and o are in force at the same moment with
+// neither superseding the other. A version without effective_until is
+// superseded by any version that takes effect after it.
+func (w policyWindow) conflicts(o policyWindow) bool {
+	if !w.overlaps(o) {
+		return false
+	}
+	earlier, later := w, o
+	if later.from.Before(earlier.from) {
+		earlier, later = later, earlier
+	}
+	return !earlier.until.IsZero() || !later.from.After(earlier.from)
+}
+
+func (a *Analyzer) analyzePolicyMetadata(name string, rule ast.PolicyRule, window *policyWindow) {
+	str, ok := rule.Value.(ast.StringExpr)
+	if rule.Key == "version" {
+		if !ok || str.Value == "" {
+			a.addError("policy '%s': version must be a non-empty string", name)
+			return
+		}
+		window.version = str.Value
+		return
+	}
+
+	if problem := checkExpiry(rule.Value); problem != "" {
+		a.addError("policy '%s': %s %s", name, rule.Key, problem)
+		return
+	}
+	t, _ := parseDate(str.Value)
+	if rule.Key == "effective_from" {
+		window.from = t
+	} else {
+		window.until = t
+	}
+}
+
+// checkPolicyVersions validates policies declared by several blocks. Every
+// block needs a distinct version and a start date, and no two windows may
+// be in force at the same moment, except that an open-ended version gives
+// way to the versions that start after it.
+func (a *Analyzer) checkPolicyVersions() {
+	names := make([]string, 0, len(a.policyVersions))
+	for name := range a.policyVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		windows := a.policyVersions[name]
+		if len(windows) < 2 {
+			continue
+		}
+
+		versions := make(map[string]bool)
+		for _, w := range windows {
+			a.line = w.line
+			switch {
+			case w.version == "":
+				a.addError("policy '%s' is declared more than once; each declaration needs a version", name)
+			case versions[w.version]:
+				a.addError("policy '%s': version '%s' is declared more than once", name, w.version)
+			case w.from.IsZero():
+				a.addError("policy '%s': version '%s' needs an effective_from date", name, w.version)
+			}
+			versions[w.version] = true
+		}
+
+		for i := range windows {
+			for j := i + 1; j < len(windows); j++ {
+				if windows[i].version != "" && windows[j].version != "" && windows[i].conflicts(windows[j]) {
+					a.line = windows[j].line
+					a.addError("policy '%s': versions '%s' and '%s' have overlapping effective windows",
+						name, windows[i].version, windows[j].version)
+				}
+			}
+		}
+	}
+}
+
+// nonConstant explains why expr cannot be evaluated at compile time, or
+// returns "" if it is built only from literals and operators.
+func nonConstant(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case ast.NumberExpr, ast.StringExpr, ast.BooleanLiteralExpr, ast.NullExpr:
+		return ""
+	case ast.ExpressionStmt:
+		return nonConstant(e.Expression)
+	case ast.ArrayLiteralExpr:
+		for _, item := range e.Items {
+			if problem := nonConstant(item); problem != "" {
+				return problem
+			}
+		}
+		return ""
+	case ast.ObjectAssignmentExpr:
+		for _, field := range e.Fields {
+			if problem := nonConstant(field.Value); problem != "" {
+				return problem
+			}
+		}
+		return ""
+	case ast.PrefixExpr:
+		return nonConstant(e.RightExpr)
+	case ast.BinaryExpr:
+		if problem := nonConstant(e.Left); problem != "" {
+			return problem
+		}
+		if problem := nonConstant(e.Right); problem != "" {
+			return problem
+		}
+		if op := e.Operator.Literal; op == "/" || op == "%" {
+			if divisor, ok := constNumber(e.Right); ok && divisor == 0 {
+				return "division by zero"
+			}
+		}
+		return ""
+	case ast.SymbolExpr:
+		return fmt.Sprintf("it references '%s'", e.Value)
+	case ast.CallExpr:
+		return fmt.Sprintf("it calls '%s'", symbolName(e.Calle))
+	case ast.MemberExpr:
+		return "it reads a member at runtime"
+	}
+	return fmt.Sprintf("%T is not allowed", expr)
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -275,6 +875,7 @@ func (a *Analyzer) analyzeFunc(s ast.FuncStmt) {
 	}
 
 	// ── Body ──────────────────────────────────────────────────────────────────
+	a.loopDepth = 0
 	if body, ok := s.Body.(ast.BlockStmt); ok {
 		for _, node := range body.Body {
 			a.analyzeStmt(node, fnName, localScope)
@@ -282,17 +883,76 @@ func (a *Analyzer) analyzeFunc(s ast.FuncStmt) {
 	}
 }
 
+// ─────────────────────────────────────────────────────────────────────────────
+// Tests
+// ─────────────────────────────────────────────────────────────────────────────
+func (a *Analyzer) analyzeTest(s ast.TestStmt) {
+	testName := "test:" + s.Name
+
+	a.loopDepth = 0
+	a.inTest = true
+	scope := make(map[string]bool)
+	for _, node := range s.Body {
+		a.analyzeStmt(node, testName, scope)
+	}
+	a.inTest = false
+}
+
+func (a *Analyzer) requireTest(keyword, fnName string) {
+	if !a.inTest {
+		a.addError("fn '%s': %s() can only be used inside a test block", fnName, keyword)
+	}
+}
+
 // ─────────────────────────────────────────────────────────────────────────────
 // Statements
 // ─────────────────────────────────────────────────────────────────────────────
 func (a *Analyzer) analyzeStmt(node ast.Stmt, fnName string, scope map[string]bool) {
+	line := a.line
+	a.at(node)
+	defer func() { a.line = line }()
+
 	switch s := node.(type) {
 
 	case ast.RequireStmt:
+		a.analyzeAssertion("require", s.Condition, s.Code, s.Message, s.Details, fnName, scope)
+
+	case ast.CheckStmt:
+		a.analyzeAssertion("check", s.Condition, s.Code, s.Message, s.Details, fnName, scope)
+
+	case ast.TestStmt:
+		a.addError("fn '%s': test '%s' must be declared at contract level", fnName, s.Name)
+
+	case ast.ExpectStmt:
+		a.requireTest("expect", fnName)
 		a.analyzeExpr(s.Condition, fnName, scope)
-		if symbolName(s.Message) == "" {
-			if _, isStr := s.Message.(ast.StringExpr); !isStr {
-				a.addError("fn '%s': require() is missing an error message", fnName)
+		if s.Message != nil {
+			a.analyzeExpr(s.Message, fnName, scope)
+		}
+
+	case ast.ExpectRevertStmt:
+		a.requireTest("expectRevert", fnName)
+		a.analyzeExpr(s.Code, fnName, scope)
+		if kind, ok := literalKind(s.Code); ok {
+			if str, isStr := s.Code.(ast.StringExpr); !isStr || str.Value == "" {
+				a.addError("fn '%s': expectRevert() error code must be a non-empty String, got %s", fnName, kind)
+			}
+		}
+		for _, inner := range s.Body {
+			a.analyzeStmt(inner, fnName, copyScope(scope))
+		}
+
+	case ast.ExpectEmitStmt:
+		a.requireTest("expectEmit", fnName)
+		if symbolName(s.EventName) == "" {
+			if _, isStr := s.EventName.(ast.StringExpr); !isStr {
+				a.addError("fn '%s': expectEmit() is missing an event name", fnName)
+			}
+		}
+		if s.Payload != nil {
+			a.analyzeExpr(s.Payload, fnName, scope)
+			if kind, ok := literalKind(s.Payload); ok && kind != stdlib.Object {
+				a.addError("fn '%s': expectEmit() payload must be an object, got %s", fnName, kind)
 			}
 		}
 
@@ -345,15 +1005,71 @@ func (a *Analyzer) analyzeStmt(node ast.Stmt, fnName string, scope map[string]bo
 		if s.Post != nil {
 			a.analyzeStmt(s.Post, fnName, forScope)
 		}
+		a.loopDepth++
 		for _, inner := range s.Body {
 			a.analyzeStmt(inner, fnName, forScope)
 		}
+		a.loopDepth--
+
+	case ast.ForEachStmt:
+		a.analyzeExpr(s.Iterable, fnName, scope)
+		loopScope := copyScope(scope)
+		if s.Key != "" {
+			if s.Key == s.Value {
+				a.addError("fn '%s': foreach key and value variables must differ ('%s')", fnName, s.Key)
+			}
+			loopScope[s.Key] = true
+		}
+		loopScope[s.Value] = true
+		a.loopDepth++
+		for _, inner := range s.Body {
+			a.analyzeStmt(inner, fnName, loopScope)
+		}
+		a.loopDepth--
 
 	case ast.WhileStmt:
 		a.analyzeExpr(s.Condition, fnName, scope)
+		a.loopDepth++
 		for _, inner := range s.Body {
 			a.analyzeStmt(inner, fnName, scope)
 		}
+		a.loopDepth--
+
+	case ast.BreakStmt:
+		if a.loopDepth == 0 {
+			a.addError("fn '%s': 'break' used outside of a loop", fnName)
+		}
+
+	case ast.ContinueStmt:
+		if a.loopDepth == 0 {
+			a.addError("fn '%s': 'continue' used outside of a loop", fnName)
+		}
+
+	case ast.TryCatchStmt:
+		for _, inner := range s.TryBlock {
+			a.analyzeStmt(inner, fnName, copyScope(scope))
+		}
+		caught := make(map[string]bool)
+		for i, clause := range s.Catches {
+			_, declared := a.declaredErrors[clause.Type]
+			switch {
+			case clause.Type == "" && i != len(s.Catches)-1:
+				a.addError("fn '%s': catch without an error type must be the last catch clause", fnName)
+			case clause.Type != "" && !declared:
+				a.addError("fn '%s': catch of undeclared error type '%s'", fnName, clause.Type)
+			case clause.Type != "" && caught[clause.Type]:
+				a.addError("fn '%s': error type '%s' is caught more than once", fnName, clause.Type)
+			}
+			caught[clause.Type] = true
+
+			catchScope := copyScope(scope)
+			if clause.Var != "" {
+				catchScope[clause.Var] = true
+			}
+			for _, inner := range clause.Body {
+				a.analyzeStmt(inner, fnName, catchScope)
+			}
+		}
 
 	case ast.ArrayItemAssignmentStmt:
 		a.analyzeExpr(s.Name, fnName, scope)
@@ -385,6 +1101,11 @@ func (a *Analyzer) analyzeExpr(expr ast.Expr, fnName string, scope map[string]bo
 	case ast.BinaryExpr:
 		a.analyzeExpr(e.Left, fnName, scope)
 		a.analyzeExpr(e.Right, fnName, scope)
+		if op := e.Operator.Literal; op == "/" || op == "%" {
+			if divisor, ok := constNumber(e.Right); ok && divisor == 0 {
+				a.addError("fn '%s': division by zero — right-hand side of '%s' is always 0", fnName, op)
+			}
+		}
 
 	case ast.CallExpr:
 		callee := symbolName(e.Calle)
@@ -392,6 +1113,16 @@ func (a *Analyzer) analyzeExpr(expr ast.Expr, fnName string, scope map[string]bo
 			if builtinFunctions[callee] {
 				// Built-in functions (len, print, require, emit) are always valid —
 				// skip arity check since they have variable signatures in the runtime.
+			} else if builtin, ok := stdlib.Lookup(callee); ok {
+				a.checkBuiltinCall(builtin, e.Arguments, fnName)
+			} else if native, ok := a.natives[callee]; ok {
+				a.checkBuiltinCall(native.Builtin, e.Arguments, fnName)
+				if a.strict && !native.Deterministic {
+					a.addError("fn '%s': native '%s' is non-deterministic and cannot be called in strict mode",
+						fnName, callee)
+				}
+			} else if fields, isError := a.declaredErrors[callee]; isError {
+				a.checkErrorCall(callee, fields, e.Arguments, fnName)
 			} else if paramCount, exists := a.declaredFunctions[callee]; !exists {
 				a.addError("fn '%s': call to undefined function '%s'", fnName, callee)
 			} else if len(e.Arguments) != paramCount {
@@ -456,6 +1187,89 @@ func symbolName(expr ast.Expr) string {
 	return ""
 }
 
+// checkBuiltinCall validates a call to a stdlib builtin: the argument count
+// always, and argument kinds wherever the argument is a literal.
+func (a *Analyzer) checkBuiltinCall(b stdlib.Builtin, args []ast.Expr, fnName string) {
+	if err := b.CheckArity(len(args)); err != nil {
+		a.addError("fn '%s': %s", fnName, err.Error())
+		return
+	}
+	for i, arg := range args {
+		want := b.ParamKind(i)
+		if got, ok := literalKind(arg); ok && !got.Matches(want) {
+			a.addError("fn '%s': argument %d of '%s' must be %s, got %s",
+				fnName, i+1, b.Name, want, got)
+		}
+	}
+}
+
+// literalKind returns the stdlib kind of expr when it is a literal value.
+func literalKind(expr ast.Expr) (stdlib.Kind, bool) {
+	switch e := expr.(type) {
+	case ast.NumberExpr:
+		if e.Literal != "" {
+			// Hex literals are addresses, kept as their text.
+			return stdlib.String, true
+		}
+		return stdlib.Number, true
+	case ast.StringExpr:
+		return stdlib.String, true
+	case ast.BooleanLiteralExpr:
+		return stdlib.Bool, true
+	case ast.ArrayLiteralExpr:
+		return stdlib.Array, true
+	case ast.ObjectAssignmentExpr:
+		return stdlib.Object, true
+	case ast.NullExpr:
+		return stdlib.Null, true
+	}
+	return stdlib.Any, false
+}
+
+// constNumber evaluates expr when it is built only from numeric literals,
+// following the VM's rules: whole numbers use truncating integer division.
+func constNumber(expr ast.Expr) (float64, bool) {
+	switch e := expr.(type) {
+	case ast.NumberExpr:
+		return e.Value, e.Literal == ""
+	case ast.PrefixExpr:
+		v, ok := constNumber(e.RightExpr)
+		if !ok || e.Operator.Literal != "-" {
+			return 0, false
+		}
+		return -v, true
+	case ast.BinaryExpr:
+		l, lok := constNumber(e.Left)
+		r, rok := constNumber(e.Right)
+		if !lok || !rok {
+			return 0, false
+		}
+		integral := l == math.Trunc(l) && r == math.Trunc(r)
+		switch e.Operator.Literal {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			if r == 0 {
+				return 0, false
+			}
+			if integral {
+				return math.Trunc(l / r), true
+			}
+			return l / r, true
+		case "%":
+			if r == 0 {
+				return 0, false
+			}
+			return math.Mod(l, r), true
+		}
+	}
+	return 0, false
+}
+
 func typeToString(t ast.Type) string {
 	if t == nil {
 		return ""
@@ -481,6 +1295,12 @@ func (a *Analyzer) isFunctionDeclared(name string) bool {
 	if builtinFunctions[name] {
 		return true
 	}
+	if _, ok := stdlib.Lookup(name); ok {
+		return true
+	}
+	if _, ok := a.natives[name]; ok {
+		return true
+	}
 	_, ok := a.declaredFunctions[name]
 	return ok
 }
@@ -45,7 +45,8 @@ func parse_primary_expr(p *parser) ast.Expr {
 			number, err := strconv.ParseInt(hexStr[2:], 16, 64)
 			if err == nil {
 				return ast.NumberExpr{
-					Value: float64(number),
+					Value:   float64(number),
+					Literal: hexStr,
 				}
 			}
 		}
@@ -162,10 +163,12 @@ func grouping_expr(p *parser) ast.Expr {
 }
 
 func parse_literal_array_expr(p *parser) ast.Expr {
-	p.expect(lexer.OPEN_BRACKET)
+	line := p.expect(lexer.OPEN_BRACKET).Line
 
 	args := []ast.Expr{}
+	lines := []int{}
 	for p.currentTokenType() != lexer.CLOSE_BRACKET {
+		lines = append(lines, p.currentToken().Line)
 		arg := parse_expr(p, defalt_bp)
 		args = append(args, arg)
 
@@ -174,9 +177,12 @@ func parse_literal_array_expr(p *parser) ast.Expr {
 		}
 	}
 
-	p.expect(lexer.CLOSE_BRACKET)
+	end := p.expect(lexer.CLOSE_BRACKET).Line
 	return ast.ArrayLiteralExpr{
-		Items: args,
+		Items:     args,
+		ItemLines: lines,
+		Line:      line,
+		End:       end,
 	}
 }
 
@@ -192,6 +198,7 @@ func parse_array_access_item_expr(p *parser, identifier ast.Expr, bp binding_pow
 }
 
 func parse_obj_item_assignment_expr(p *parser) ast.ObjectPropertyExpr {
+	line := p.currentToken().Line
 	keyName := p.expectIdentifierOrKeyword("Expected property name in object literal")
 	key := ast.SymbolExpr{Value: keyName}
 	p.expect(lexer.COLON)
@@ -206,11 +213,12 @@ func parse_obj_item_assignment_expr(p *parser) ast.ObjectPropertyExpr {
 	return ast.ObjectPropertyExpr{
 		Key:   key,
 		Value: value,
+		Line:  line,
 	}
 }
 
 func parse_obj_assignment_expr(p *parser) ast.Expr {
-	p.expect(lexer.OPEN_CURLY)
+	line := p.expect(lexer.OPEN_CURLY).Line
 
 	fields := make([]ast.ObjectPropertyExpr, 0)
 	for p.currentTokenType() != lexer.CLOSE_CURLY {
@@ -218,10 +226,12 @@ func parse_obj_assignment_expr(p *parser) ast.Expr {
 		fields = append(fields, prop)
 	}
 
-	p.expect(lexer.CLOSE_CURLY)
+	end := p.expect(lexer.CLOSE_CURLY).Line
 	return ast.ObjectAssignmentExpr{
 		Name:   nil,
 		Fields: fields,
+		Line:   line,
+		End:    end,
 	}
 }
 
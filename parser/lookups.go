@@ -97,12 +97,22 @@ func createTokenLookups() {
 	stmt(lexer.IF, parse_if_stmt)
 	stmt(lexer.WHILE, parse_while_loop_stmt)
 	stmt(lexer.FOR, parse_for_loop_stmt)
+	stmt(lexer.FOREACH, parse_foreach_stmt)
 	stmt(lexer.FN, parse_func_stmt)
 	stmt(lexer.RETURN, parse_return_stmt)
+	stmt(lexer.BREAK, parse_break_stmt)
+	stmt(lexer.CONTINUE, parse_continue_stmt)
 	stmt(lexer.REQUIRE, parse_require_stmt)
+	stmt(lexer.CHECK, parse_check_stmt)
 	stmt(lexer.AGENT, parse_agent_stmt)
+	stmt(lexer.REGISTRY, parse_registry_stmt)
 	stmt(lexer.POLICY, parse_policy_stmt)
 	stmt(lexer.TYPE, parse_type_stmt)
+	stmt(lexer.ERROR_DECL, parse_error_decl_stmt)
+	stmt(lexer.TEST, parse_test_stmt)
+	stmt(lexer.EXPECT, parse_expect_stmt)
+	stmt(lexer.EXPECT_REVERT, parse_expect_revert_stmt)
+	stmt(lexer.EXPECT_EMIT, parse_expect_emit_stmt)
 	stmt(lexer.EMIT, parse_emit_stmt)
 	stmt(lexer.TRY, parse_try_stmt)
 }
@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 
 	"github.com/peiblow/vvm/ast"
 	"github.com/peiblow/vvm/lexer"
@@ -22,10 +24,28 @@ func (p *parser) advance() lexer.Token {
 	return tk
 }
 
+// lastLine is the line of the most recently consumed token.
+func (p *parser) lastLine() int {
+	if p.pos == 0 {
+		return p.currentToken().Line
+	}
+	if last := p.tokens[p.pos-1]; last.EndLine > 0 {
+		return last.EndLine
+	}
+	return p.tokens[p.pos-1].Line
+}
+
 func (p *parser) currentTokenType() lexer.TokenType {
 	return p.tokens[p.pos].Type
 }
 
+func (p *parser) peekTokenType(offset int) lexer.TokenType {
+	if p.pos+offset >= len(p.tokens) {
+		return lexer.EOF
+	}
+	return p.tokens[p.pos+offset].Type
+}
+
 func (p *parser) hasTokens() bool {
 	return p.pos < len(p.tokens) && p.currentTokenType() != lexer.EOF
 }
@@ -69,8 +89,43 @@ func createParser(tokens []lexer.Token) *parser {
 }
 
 func Parse(tokens []lexer.Token) ast.BlockStmt {
-	Body := make([]ast.Stmt, 0)
+	return parseProgram(createParser(tokens))
+}
+
+// ParseError is a syntax error, reported at the line the parser stopped on.
+type ParseError struct {
+	Line    int
+	Message string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("[linha %d] %s", e.Line, e.Message)
+}
+
+var linePrefix = regexp.MustCompile(`^\[linha (\d+)\] `)
+
+// ParseChecked is Parse for callers that keep running after a syntax error,
+// such as editors: it returns the error instead of panicking.
+func ParseChecked(tokens []lexer.Token) (program ast.BlockStmt, err error) {
 	p := createParser(tokens)
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		msg := fmt.Sprint(r)
+		line := p.tokens[min(p.pos, len(p.tokens)-1)].Line
+		if m := linePrefix.FindStringSubmatch(msg); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			msg = msg[len(m[0]):]
+		}
+		err = ParseError{Line: line, Message: msg}
+	}()
+	return parseProgram(p), nil
+}
+
+func parseProgram(p *parser) ast.BlockStmt {
+	Body := make([]ast.Stmt, 0)
 
 	for p.hasTokens() {
 		Body = append(Body, parse_stmt(p))
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"fmt"
+
 	"github.com/peiblow/vvm/ast"
 	"github.com/peiblow/vvm/lexer"
 )
@@ -21,15 +23,18 @@ func parse_block(p *parser) ast.BlockStmt {
 }
 
 func parse_stmt(p *parser) ast.Stmt {
+	line := p.currentToken().Line
 	stmt_fn, exists := stmt_lu[p.currentTokenType()]
 
 	if exists {
-		return stmt_fn(p)
+		stmt := stmt_fn(p)
+		return ast.WithPos(stmt, ast.Pos{Line: line, End: p.lastLine()})
 	}
 
 	expr := parse_expr(p, defalt_bp)
 
 	return ast.ExpressionStmt{
+		Pos:        ast.Pos{Line: line, End: p.lastLine()},
 		Expression: expr,
 	}
 }
@@ -39,6 +44,7 @@ func parse_arguments(p *parser) []ast.ArgsStmt {
 
 	body := []ast.ArgsStmt{}
 	for p.currentTokenType() != lexer.CLOSE_PAREN {
+		line := p.currentToken().Line
 		expr := parse_expr(p, defalt_bp)
 		p.expect(lexer.COLON)
 		exprType := parse_expr(p, defalt_bp)
@@ -46,6 +52,7 @@ func parse_arguments(p *parser) []ast.ArgsStmt {
 		body = append(body, ast.ArgsStmt{
 			ArgName: expr,
 			ArgType: exprType,
+			Line:    line,
 		})
 
 		if p.currentTokenType() == lexer.COMMA {
@@ -105,10 +112,12 @@ func parse_if_stmt(p *parser) ast.Stmt {
 
 	thenBlock := parse_block(p)
 	var elseBlock ast.Stmt
+	var elseLine int
 	if p.currentTokenType() == lexer.ELSE {
-		p.advance()
+		elseLine = p.advance().Line
 		if p.currentTokenType() == lexer.IF {
-			elseBlock = parse_if_stmt(p)
+			line := p.currentToken().Line
+			elseBlock = ast.WithPos(parse_if_stmt(p), ast.Pos{Line: line, End: p.lastLine()})
 		} else {
 			elseBlock = parse_block(p)
 		}
@@ -118,6 +127,7 @@ func parse_if_stmt(p *parser) ast.Stmt {
 		Condition: condition,
 		Then:      thenBlock,
 		Else:      elseBlock,
+		ElseLine:  elseLine,
 	}
 }
 
@@ -138,6 +148,10 @@ func parse_for_loop_stmt(p *parser) ast.Stmt {
 	p.advance()
 	p.expect(lexer.OPEN_PAREN)
 
+	if is_foreach_header(p) {
+		return parse_foreach_body(p)
+	}
+
 	init := parse_stmt(p)
 	p.expect(lexer.SEMI_COLON)
 
@@ -157,10 +171,54 @@ func parse_for_loop_stmt(p *parser) ast.Stmt {
 	}
 }
 
+// is_foreach_header reports whether the tokens after `for (` are
+// `name in` or `key, value in` rather than a classic init statement.
+func is_foreach_header(p *parser) bool {
+	if p.currentTokenType() != lexer.IDENTIFIER {
+		return false
+	}
+	if p.peekTokenType(1) == lexer.IN {
+		return true
+	}
+	return p.peekTokenType(1) == lexer.COMMA &&
+		p.peekTokenType(2) == lexer.IDENTIFIER &&
+		p.peekTokenType(3) == lexer.IN
+}
+
+func parse_foreach_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.FOREACH)
+	p.expect(lexer.OPEN_PAREN)
+	return parse_foreach_body(p)
+}
+
+func parse_foreach_body(p *parser) ast.Stmt {
+	var key string
+	value := p.expectError(lexer.IDENTIFIER, "Expected loop variable in foreach").Literal
+
+	if p.currentTokenType() == lexer.COMMA {
+		p.advance()
+		key = value
+		value = p.expectError(lexer.IDENTIFIER, "Expected value variable after ',' in foreach").Literal
+	}
+
+	p.expect(lexer.IN)
+	iterable := parse_expr(p, defalt_bp)
+	p.expect(lexer.CLOSE_PAREN)
+
+	body := parse_block(p).Body
+
+	return ast.ForEachStmt{
+		Key:      key,
+		Value:    value,
+		Iterable: iterable,
+		Body:     body,
+	}
+}
+
 func parse_func_stmt(p *parser) ast.Stmt {
 	var returnType ast.Type
 
-	p.expect(lexer.FN)
+	doc := p.expect(lexer.FN).Doc
 	name := ast.ExpressionStmt{Expression: ast.SymbolExpr{Value: p.advance().Literal}}
 
 	args := parse_arguments(p)
@@ -175,6 +233,7 @@ func parse_func_stmt(p *parser) ast.Stmt {
 	body := parse_block(p)
 
 	return ast.FuncStmt{
+		Doc:        doc,
 		Name:       name,
 		Arguments:  args,
 		Body:       body,
@@ -196,91 +255,239 @@ func parse_return_stmt(p *parser) ast.Stmt {
 	}
 }
 
+func parse_break_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.BREAK)
+	return ast.BreakStmt{}
+}
+
+func parse_continue_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.CONTINUE)
+	return ast.ContinueStmt{}
+}
+
 func parse_require_stmt(p *parser) ast.Stmt {
 	p.expect(lexer.REQUIRE)
+	condition, code, message, details := parse_assertion(p, "require")
+	return ast.RequireStmt{
+		Condition: condition,
+		Code:      code,
+		Message:   message,
+		Details:   details,
+	}
+}
+
+func parse_check_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.CHECK)
+	condition, code, message, details := parse_assertion(p, "check")
+	return ast.CheckStmt{
+		Condition: condition,
+		Code:      code,
+		Message:   message,
+		Details:   details,
+	}
+}
+
+// parse_assertion parses `(cond; message)`, `(cond; code, message)` or
+// `(cond; code, message, details)`.
+func parse_assertion(p *parser, keyword string) (condition, code, message, details ast.Expr) {
 	p.expect(lexer.OPEN_PAREN)
 
-	condition := parse_expr(p, defalt_bp)
+	condition = parse_expr(p, defalt_bp)
 	p.expect(lexer.SEMI_COLON)
 
-	message := parse_expr(p, defalt_bp)
+	args := []ast.Expr{parse_expr(p, defalt_bp)}
+	for p.currentTokenType() == lexer.COMMA {
+		p.advance()
+		args = append(args, parse_expr(p, defalt_bp))
+	}
+	p.expect(lexer.CLOSE_PAREN)
 
+	switch len(args) {
+	case 1:
+		message = args[0]
+	case 2:
+		code, message = args[0], args[1]
+	case 3:
+		code, message, details = args[0], args[1], args[2]
+	default:
+		panic(fmt.Sprintf("%s takes a message, a code and message, or a code, message and details", keyword))
+	}
+	return condition, code, message, details
+}
+
+func parse_test_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.TEST)
+	name := p.expectError(lexer.STRING, "Expected test name string after 'test'").Literal
+
+	return ast.TestStmt{
+		Name: name,
+		Body: parse_block(p).Body,
+	}
+}
+
+func parse_expect_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.EXPECT)
+	p.expect(lexer.OPEN_PAREN)
+
+	condition := parse_expr(p, defalt_bp)
+	var message ast.Expr
+	if p.currentTokenType() == lexer.SEMI_COLON {
+		p.advance()
+		message = parse_expr(p, defalt_bp)
+	}
 	p.expect(lexer.CLOSE_PAREN)
-	return ast.RequireStmt{
+
+	return ast.ExpectStmt{
 		Condition: condition,
 		Message:   message,
 	}
 }
 
+func parse_expect_revert_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.EXPECT_REVERT)
+	p.expect(lexer.OPEN_PAREN)
+	code := parse_expr(p, defalt_bp)
+	p.expect(lexer.CLOSE_PAREN)
+
+	return ast.ExpectRevertStmt{
+		Code: code,
+		Body: parse_block(p).Body,
+	}
+}
+
+func parse_expect_emit_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.EXPECT_EMIT)
+	p.expect(lexer.OPEN_PAREN)
+
+	eventName := parse_expr(p, defalt_bp)
+	var payload ast.Expr
+	if p.currentTokenType() == lexer.COMMA {
+		p.advance()
+		payload = parse_expr(p, defalt_bp)
+	}
+	p.expect(lexer.CLOSE_PAREN)
+
+	return ast.ExpectEmitStmt{
+		EventName: eventName,
+		Payload:   payload,
+	}
+}
+
 func parse_agent_stmt(p *parser) ast.Stmt {
 	p.expect(lexer.AGENT)
 	agentName := parse_expr(p, defalt_bp)
-	p.expect(lexer.OPEN_CURLY)
 
-	parse_expr(p, defalt_bp)
-	p.expect(lexer.COLON)
-	version := parse_expr(p, defalt_bp)
+	return ast.AgentStmt{
+		Identifier: agentName,
+		Fields:     parse_metadata_fields(p, "agent"),
+	}
+}
 
-	parse_expr(p, defalt_bp)
-	p.expect(lexer.COLON)
-	owner := parse_expr(p, defalt_bp)
+func parse_registry_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.REGISTRY)
+	kind := p.expectError(lexer.IDENTIFIER, "Expected registry kind (Model, Dataset or Tool) after 'registry'").Literal
+	name := ast.SymbolExpr{
+		Value: p.expectError(lexer.IDENTIFIER, "Expected registry entry name").Literal,
+	}
 
-	parse_expr(p, defalt_bp)
-	p.expect(lexer.COLON)
-	purpose := parse_expr(p, defalt_bp)
+	return ast.RegistryStmt{
+		Kind:       kind,
+		Identifier: name,
+		Fields:     parse_metadata_fields(p, "registry"),
+	}
+}
 
-	p.expect(lexer.CLOSE_CURLY)
+// parse_metadata_fields parses a `{ key: value ... }` block of an agent or
+// registry declaration. Commas between fields are optional.
+func parse_metadata_fields(p *parser, context string) []ast.MetadataField {
+	p.expect(lexer.OPEN_CURLY)
 
-	return ast.AgentStmt{
-		Identifier: agentName,
-		Version:    version,
-		Owner:      owner,
-		Purpose:    purpose,
+	fields := make([]ast.MetadataField, 0)
+	for p.hasTokens() && p.currentTokenType() != lexer.CLOSE_CURLY {
+		line := p.currentToken().Line
+		key := p.expectIdentifierOrKeyword("Expected field name in " + context + " declaration")
+		p.expect(lexer.COLON)
+		value := parse_expr(p, defalt_bp)
+		fields = append(fields, ast.MetadataField{Key: key, Value: value, Line: line})
+
+		if p.currentTokenType() == lexer.COMMA {
+			p.advance()
+		}
 	}
+
+	p.expect(lexer.CLOSE_CURLY)
+	return fields
 }
 
 func parse_policy_stmt(p *parser) ast.Stmt {
-	p.expect(lexer.POLICY)
+	doc := p.expect(lexer.POLICY).Doc
 	policyName := parse_expr(p, defalt_bp)
 
 	p.expect(lexer.OPEN_CURLY)
 
-	rules := make(map[string]ast.Expr)
+	rules := make([]ast.PolicyRule, 0)
 	for p.currentTokenType() != lexer.CLOSE_CURLY {
+		line := p.currentToken().Line
 		ruleKey := p.expectError(lexer.IDENTIFIER, "Expected rule identifier in policy declaration").Literal
 		p.expect(lexer.COLON)
+		isParam := p.currentTokenType() == lexer.PARAM
+		if isParam {
+			p.advance()
+		}
 		ruleValue := parse_expr(p, defalt_bp)
-		rules[ruleKey] = ruleValue
+		rules = append(rules, ast.PolicyRule{Key: ruleKey, Value: ruleValue, Param: isParam, Line: line})
 	}
 
 	p.expect(lexer.CLOSE_CURLY)
 
 	return ast.PolicyStmt{
+		Doc:        doc,
 		Identifier: policyName,
 		Rules:      rules,
 	}
 }
 
 func parse_type_stmt(p *parser) ast.Stmt {
-	p.expect(lexer.TYPE)
+	doc := p.expect(lexer.TYPE).Doc
 	typeName := parse_expr(p, defalt_bp)
 
+	return ast.TypeDeclareStmt{
+		Doc:    doc,
+		Name:   typeName,
+		Fields: parse_type_fields(p, "type"),
+	}
+}
+
+func parse_error_decl_stmt(p *parser) ast.Stmt {
+	p.expect(lexer.ERROR_DECL)
+	errorName := p.expectError(lexer.IDENTIFIER, "Expected error name in error declaration").Literal
+
+	return ast.ErrorDeclStmt{
+		Name:   errorName,
+		Fields: parse_type_fields(p, "error"),
+	}
+}
+
+// parse_type_fields parses a `{ name: Type ... }` body, as used by type and
+// error declarations. Fields may be separated by commas.
+func parse_type_fields(p *parser, declaration string) []ast.TypeField {
 	p.expect(lexer.OPEN_CURLY)
 
-	fields := make(map[string]ast.Expr)
+	fields := make([]ast.TypeField, 0)
 	for p.currentTokenType() != lexer.CLOSE_CURLY {
-		fieldKey := p.expectIdentifierOrKeyword("Expected type identifier in type declaration")
+		line := p.currentToken().Line
+		fieldKey := p.expectIdentifierOrKeyword(fmt.Sprintf("Expected type identifier in %s declaration", declaration))
 		p.expect(lexer.COLON)
 		fieldType := parse_expr(p, defalt_bp)
-		fields[fieldKey] = fieldType
+		fields = append(fields, ast.TypeField{Name: fieldKey, Type: fieldType, Line: line})
+
+		if p.currentTokenType() == lexer.COMMA {
+			p.advance()
+		}
 	}
 
 	p.expect(lexer.CLOSE_CURLY)
-
-	return ast.TypeDeclareStmt{
-		Name:   typeName,
-		Fields: fields,
-	}
+	return fields
 }
 
 func parse_emit_stmt(p *parser) ast.Stmt {
@@ -307,20 +514,26 @@ func parse_try_stmt(p *parser) ast.Stmt {
 	p.expect(lexer.TRY)
 	tryBlock := parse_block(p)
 
-	var catchVar string
-	var catchBlock ast.BlockStmt
-	if p.currentTokenType() == lexer.CATCH {
-		p.expect(lexer.CATCH)
+	var catches []ast.CatchClause
+	for p.currentTokenType() == lexer.CATCH {
+		line := p.expect(lexer.CATCH).Line
 		p.expect(lexer.OPEN_PAREN)
-		catchVar = p.expectIdentifierOrKeyword("Expected error variable name in catch statement")
+		clause := ast.CatchClause{
+			Var: p.expectIdentifierOrKeyword("Expected error variable name in catch statement"),
+		}
+		if p.currentTokenType() == lexer.COLON {
+			p.advance()
+			clause.Type = p.expectError(lexer.IDENTIFIER, "Expected error type after ':' in catch statement").Literal
+		}
 		p.expect(lexer.CLOSE_PAREN)
 
-		catchBlock = parse_block(p)
+		clause.Body = parse_block(p).Body
+		clause.Pos = ast.Pos{Line: line, End: p.lastLine()}
+		catches = append(catches, clause)
 	}
 
 	return ast.TryCatchStmt{
-		TryBlock:   tryBlock.Body,
-		CatchVar:   catchVar,
-		CatchBlock: catchBlock.Body,
+		TryBlock: tryBlock.Body,
+		Catches:  catches,
 	}
 }
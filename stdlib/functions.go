@@ -0,0 +1,388 @@
+package stdlib
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Value helpers
+// ─────────────────────────────────────────────────────────────────────────────
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// normalizeNumber returns whole numbers as int, matching what the VM pushes
+// for integer arithmetic, and everything else as float64.
+func normalizeNumber(f float64) interface{} {
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return int(f)
+	}
+	return f
+}
+
+func toIndex(name string, v interface{}) (int, error) {
+	f, ok := toFloat(v)
+	if !ok || f != math.Trunc(f) {
+		return 0, argError(name, "index must be a whole number, got %v", v)
+	}
+	return int(f), nil
+}
+
+// equal compares two runtime values, treating int and float64 as the same
+// numeric domain like the VM's OP_EQ does.
+func equal(a, b interface{}) bool {
+	af, aNum := toFloat(a)
+	bf, bNum := toFloat(b)
+	if aNum && bNum {
+		return af == bf
+	}
+	switch a.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+	switch b.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+	return a == b
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, len(val))
+		for i, item := range val {
+			parts[i] = formatValue(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]interface{}:
+		keys := sortedKeys(val)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k + ": " + formatValue(val[k])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return ""
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// clampRange resolves [start, end) against a sequence of length n.
+func clampRange(name string, n int, args []interface{}) (int, int, error) {
+	start, err := toIndex(name, args[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	end := n
+	if len(args) > 2 {
+		if end, err = toIndex(name, args[2]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if start < 0 || end > n || start > end {
+		return 0, 0, argError(name, "range [%d, %d) out of bounds for length %d", start, end, n)
+	}
+	return start, end, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Numbers
+// ─────────────────────────────────────────────────────────────────────────────
+
+func numericArgs(name string, args []interface{}) ([]interface{}, error) {
+	if len(args) == 1 {
+		if arr, ok := args[0].([]interface{}); ok {
+			args = arr
+		}
+	}
+	if len(args) == 0 {
+		return nil, argError(name, "needs at least one number")
+	}
+	for _, a := range args {
+		if _, ok := toFloat(a); !ok {
+			return nil, argError(name, "expected numbers, got %s", KindOf(a))
+		}
+	}
+	return args, nil
+}
+
+func builtinMin(args []interface{}) (interface{}, error) {
+	nums, err := numericArgs("min", args)
+	if err != nil {
+		return nil, err
+	}
+	best := nums[0]
+	for _, n := range nums[1:] {
+		if f, _ := toFloat(n); f < mustFloat(best) {
+			best = n
+		}
+	}
+	return best, nil
+}
+
+func builtinMax(args []interface{}) (interface{}, error) {
+	nums, err := numericArgs("max", args)
+	if err != nil {
+		return nil, err
+	}
+	best := nums[0]
+	for _, n := range nums[1:] {
+		if f, _ := toFloat(n); f > mustFloat(best) {
+			best = n
+		}
+	}
+	return best, nil
+}
+
+func mustFloat(v interface{}) float64 {
+	f, _ := toFloat(v)
+	return f
+}
+
+func builtinAbs(args []interface{}) (interface{}, error) {
+	f, _ := toFloat(args[0])
+	return normalizeNumber(math.Abs(f)), nil
+}
+
+func builtinSum(args []interface{}) (interface{}, error) {
+	total := 0.0
+	for _, item := range args[0].([]interface{}) {
+		f, ok := toFloat(item)
+		if !ok {
+			return nil, argError("sum", "expected an array of numbers, found %s", KindOf(item))
+		}
+		total += f
+	}
+	if math.IsInf(total, 0) {
+		return nil, &Error{Code: "ARITHMETIC_OVERFLOW", Message: "sum: result overflows"}
+	}
+	return normalizeNumber(total), nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Collections
+// ─────────────────────────────────────────────────────────────────────────────
+
+func builtinContains(args []interface{}) (interface{}, error) {
+	idx, err := indexOf("contains", args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return idx >= 0, nil
+}
+
+func builtinIndexOf(args []interface{}) (interface{}, error) {
+	return indexOf("indexOf", args[0], args[1])
+}
+
+func indexOf(name string, haystack, needle interface{}) (int, error) {
+	switch h := haystack.(type) {
+	case []interface{}:
+		for i, item := range h {
+			if equal(item, needle) {
+				return i, nil
+			}
+		}
+		return -1, nil
+	case string:
+		s, ok := needle.(string)
+		if !ok {
+			return 0, argError(name, "can only search a string for a string, got %s", KindOf(needle))
+		}
+		byteIdx := strings.Index(h, s)
+		if byteIdx < 0 {
+			return -1, nil
+		}
+		return len([]rune(h[:byteIdx])), nil
+	}
+	return 0, argError(name, "expected an array or string, got %s", KindOf(haystack))
+}
+
+func builtinKeys(args []interface{}) (interface{}, error) {
+	obj := args[0].(map[string]interface{})
+	keys := sortedKeys(obj)
+	result := make([]interface{}, len(keys))
+	for i, k := range keys {
+		result[i] = k
+	}
+	return result, nil
+}
+
+func builtinValues(args []interface{}) (interface{}, error) {
+	obj := args[0].(map[string]interface{})
+	keys := sortedKeys(obj)
+	result := make([]interface{}, len(keys))
+	for i, k := range keys {
+		result[i] = obj[k]
+	}
+	return result, nil
+}
+
+func builtinHasKey(args []interface{}) (interface{}, error) {
+	_, ok := args[0].(map[string]interface{})[args[1].(string)]
+	return ok, nil
+}
+
+func builtinPush(args []interface{}) (interface{}, error) {
+	arr := args[0].([]interface{})
+	result := make([]interface{}, len(arr), len(arr)+1)
+	copy(result, arr)
+	return append(result, args[1]), nil
+}
+
+func builtinSlice(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case []interface{}:
+		start, end, err := clampRange("slice", len(v), args)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]interface{}, end-start)
+		copy(result, v[start:end])
+		return result, nil
+	case string:
+		runes := []rune(v)
+		start, end, err := clampRange("slice", len(runes), args)
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[start:end]), nil
+	}
+	return nil, argError("slice", "expected an array or string, got %s", KindOf(args[0]))
+}
+
+func builtinSort(args []interface{}) (interface{}, error) {
+	arr := args[0].([]interface{})
+	result := make([]interface{}, len(arr))
+	copy(result, arr)
+	if len(result) == 0 {
+		return result, nil
+	}
+
+	switch KindOf(result[0]) {
+	case Number:
+		for _, item := range result {
+			if KindOf(item) != Number {
+				return nil, argError("sort", "cannot sort mixed Number and %s values", KindOf(item))
+			}
+		}
+		sort.SliceStable(result, func(i, j int) bool {
+			return mustFloat(result[i]) < mustFloat(result[j])
+		})
+	case String:
+		for _, item := range result {
+			if KindOf(item) != String {
+				return nil, argError("sort", "cannot sort mixed String and %s values", KindOf(item))
+			}
+		}
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].(string) < result[j].(string)
+		})
+	default:
+		return nil, argError("sort", "can only sort numbers or strings, got %s", KindOf(result[0]))
+	}
+	return result, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Strings
+// ─────────────────────────────────────────────────────────────────────────────
+
+func builtinStartsWith(args []interface{}) (interface{}, error) {
+	return strings.HasPrefix(args[0].(string), args[1].(string)), nil
+}
+
+func builtinLower(args []interface{}) (interface{}, error) {
+	return strings.ToLower(args[0].(string)), nil
+}
+
+func builtinUpper(args []interface{}) (interface{}, error) {
+	return strings.ToUpper(args[0].(string)), nil
+}
+
+func builtinSplit(args []interface{}) (interface{}, error) {
+	parts := strings.Split(args[0].(string), args[1].(string))
+	result := make([]interface{}, len(parts))
+	for i, p := range parts {
+		result[i] = p
+	}
+	return result, nil
+}
+
+func builtinJoin(args []interface{}) (interface{}, error) {
+	arr := args[0].([]interface{})
+	parts := make([]string, len(arr))
+	for i, item := range arr {
+		parts[i] = formatValue(item)
+	}
+	return strings.Join(parts, args[1].(string)), nil
+}
+
+func builtinSubstring(args []interface{}) (interface{}, error) {
+	runes := []rune(args[0].(string))
+	start, end, err := clampRange("substring", len(runes), args)
+	if err != nil {
+		return nil, err
+	}
+	return string(runes[start:end]), nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Conversions
+// ─────────────────────────────────────────────────────────────────────────────
+
+func builtinToString(args []interface{}) (interface{}, error) {
+	return formatValue(args[0]), nil
+}
+
+func builtinToNumber(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case int, int64, float64:
+		f, _ := toFloat(v)
+		return normalizeNumber(f), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, argError("toNumber", "cannot convert %q to a number", v)
+		}
+		return normalizeNumber(f), nil
+	}
+	return nil, argError("toNumber", "cannot convert %s to a number", KindOf(args[0]))
+}
@@ -0,0 +1,12 @@
+package stdlib
+
+// Native is a function supplied by the program embedding the VM rather than
+// by the language itself — a sanctions lookup, an FX rate feed, and so on.
+// It shares the Builtin signature so the analyzer can check calls to it, and
+// adds a determinism flag: natives whose result may differ between runs
+// (network, clock, randomness) must leave Deterministic unset so strict
+// contracts can refuse them.
+type Native struct {
+	Builtin
+	Deterministic bool
+}
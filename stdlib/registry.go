@@ -0,0 +1,224 @@
+// Package stdlib holds the builtin functions available to every Synx
+// contract. The analyzer uses the registry for arity and type checks, the
+// compiler emits OP_BUILTIN for any name found here, and the VM dispatches
+// to the Go implementation.
+//
+// Adding a builtin only requires a new entry in the builtins table below
+// (plus its implementation in functions.go); no other package needs to
+// change.
+package stdlib
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Kind is the runtime shape a builtin parameter accepts or returns.
+type Kind string
+
+const (
+	Any    Kind = "Any"
+	Number Kind = "Number"
+	String Kind = "String"
+	Bool   Kind = "Bool"
+	Array  Kind = "Array"
+	Object Kind = "Object"
+	Null   Kind = "Null"
+)
+
+// Builtin describes a native function callable from Synx source.
+//
+// Params lists the accepted kind of each positional argument. The last
+// Optional params may be omitted by the caller; when Variadic is set the
+// last param may instead be repeated any number of times.
+type Builtin struct {
+	Name     string
+	Params   []Kind
+	Optional int
+	Variadic bool
+	Returns  Kind
+	Doc      string
+	Fn       func(args []interface{}) (interface{}, error)
+}
+
+// MinArgs is the smallest number of arguments the builtin accepts.
+func (b Builtin) MinArgs() int {
+	return len(b.Params) - b.Optional
+}
+
+// MaxArgs is the largest number of arguments accepted, or -1 if unbounded.
+func (b Builtin) MaxArgs() int {
+	if b.Variadic {
+		return -1
+	}
+	return len(b.Params)
+}
+
+// ParamKind returns the expected kind of the i-th argument.
+func (b Builtin) ParamKind(i int) Kind {
+	if i < len(b.Params) {
+		return b.Params[i]
+	}
+	if b.Variadic && len(b.Params) > 0 {
+		return b.Params[len(b.Params)-1]
+	}
+	return Any
+}
+
+// CheckArity reports an error if n arguments cannot be passed to the builtin.
+func (b Builtin) CheckArity(n int) error {
+	min, max := b.MinArgs(), b.MaxArgs()
+	switch {
+	case n < min && max == min:
+		return fmt.Errorf("'%s' expects %d argument(s), got %d", b.Name, min, n)
+	case n < min:
+		return fmt.Errorf("'%s' expects at least %d argument(s), got %d", b.Name, min, n)
+	case max >= 0 && n > max && max == min:
+		return fmt.Errorf("'%s' expects %d argument(s), got %d", b.Name, max, n)
+	case max >= 0 && n > max:
+		return fmt.Errorf("'%s' expects at most %d argument(s), got %d", b.Name, max, n)
+	}
+	return nil
+}
+
+// Error is returned by builtin implementations. The VM raises it as a
+// catchable Synx error carrying Code and Message.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func argError(name string, format string, args ...interface{}) error {
+	return &Error{
+		Code:    "INVALID_ARGUMENT",
+		Message: fmt.Sprintf("%s: %s", name, fmt.Sprintf(format, args...)),
+	}
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Registry
+// ─────────────────────────────────────────────────────────────────────────────
+var builtins = []Builtin{
+	// Numbers
+	{Name: "min", Params: []Kind{Any}, Variadic: true, Returns: Number, Fn: builtinMin,
+		Doc: "min(a, b, ...) or min(array) — smallest number"},
+	{Name: "max", Params: []Kind{Any}, Variadic: true, Returns: Number, Fn: builtinMax,
+		Doc: "max(a, b, ...) or max(array) — largest number"},
+	{Name: "abs", Params: []Kind{Number}, Returns: Number, Fn: builtinAbs,
+		Doc: "abs(n) — absolute value"},
+	{Name: "sum", Params: []Kind{Array}, Returns: Number, Fn: builtinSum,
+		Doc: "sum(array) — total of a numeric array"},
+
+	// Collections
+	{Name: "contains", Params: []Kind{Any, Any}, Returns: Bool, Fn: builtinContains,
+		Doc: "contains(arrayOrString, value) — membership / substring test"},
+	{Name: "indexOf", Params: []Kind{Any, Any}, Returns: Number, Fn: builtinIndexOf,
+		Doc: "indexOf(arrayOrString, value) — position of value, or -1"},
+	{Name: "keys", Params: []Kind{Object}, Returns: Array, Fn: builtinKeys,
+		Doc: "keys(object) — keys in sorted order"},
+	{Name: "values", Params: []Kind{Object}, Returns: Array, Fn: builtinValues,
+		Doc: "values(object) — values ordered by sorted key"},
+	{Name: "hasKey", Params: []Kind{Object, String}, Returns: Bool, Fn: builtinHasKey,
+		Doc: "hasKey(object, key) — whether key is present"},
+	{Name: "push", Params: []Kind{Array, Any}, Returns: Array, Fn: builtinPush,
+		Doc: "push(array, value) — new array with value appended"},
+	{Name: "slice", Params: []Kind{Any, Number, Number}, Optional: 1, Returns: Any, Fn: builtinSlice,
+		Doc: "slice(arrayOrString, start, end?) — sub-range [start, end)"},
+	{Name: "sort", Params: []Kind{Array}, Returns: Array, Fn: builtinSort,
+		Doc: "sort(array) — new array of numbers or strings in ascending order"},
+
+	// Strings
+	{Name: "startsWith", Params: []Kind{String, String}, Returns: Bool, Fn: builtinStartsWith,
+		Doc: "startsWith(s, prefix)"},
+	{Name: "lower", Params: []Kind{String}, Returns: String, Fn: builtinLower,
+		Doc: "lower(s) — lower-cased copy"},
+	{Name: "upper", Params: []Kind{String}, Returns: String, Fn: builtinUpper,
+		Doc: "upper(s) — upper-cased copy"},
+	{Name: "split", Params: []Kind{String, String}, Returns: Array, Fn: builtinSplit,
+		Doc: "split(s, sep) — array of substrings"},
+	{Name: "join", Params: []Kind{Array, String}, Returns: String, Fn: builtinJoin,
+		Doc: "join(array, sep) — elements joined into a string"},
+	{Name: "substring", Params: []Kind{String, Number, Number}, Optional: 1, Returns: String, Fn: builtinSubstring,
+		Doc: "substring(s, start, end?) — characters [start, end)"},
+
+	// Conversions
+	{Name: "toString", Params: []Kind{Any}, Returns: String, Fn: builtinToString,
+		Doc: "toString(v) — string representation"},
+	{Name: "toNumber", Params: []Kind{Any}, Returns: Number, Fn: builtinToNumber,
+		Doc: "toNumber(v) — parse a string or pass a number through"},
+}
+
+var registry = func() map[string]Builtin {
+	m := make(map[string]Builtin, len(builtins))
+	for _, b := range builtins {
+		m[b.Name] = b
+	}
+	return m
+}()
+
+// Lookup returns the builtin registered under name.
+func Lookup(name string) (Builtin, bool) {
+	b, ok := registry[name]
+	return b, ok
+}
+
+// Names returns the names of all builtins in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Call invokes the named builtin after checking its arity and argument kinds.
+func Call(name string, args []interface{}) (interface{}, error) {
+	b, ok := registry[name]
+	if !ok {
+		return nil, &Error{Code: "UNKNOWN_BUILTIN", Message: fmt.Sprintf("unknown builtin '%s'", name)}
+	}
+	return b.Invoke(args)
+}
+
+// Invoke checks args against the builtin's signature and calls it.
+func (b Builtin) Invoke(args []interface{}) (interface{}, error) {
+	if err := b.CheckArity(len(args)); err != nil {
+		return nil, &Error{Code: "INVALID_ARGUMENT", Message: err.Error()}
+	}
+	for i, arg := range args {
+		if kind := b.ParamKind(i); !KindOf(arg).Matches(kind) {
+			return nil, argError(b.Name, "argument %d must be %s, got %s", i+1, kind, KindOf(arg))
+		}
+	}
+	return b.Fn(args)
+}
+
+// KindOf classifies a runtime value.
+func KindOf(v interface{}) Kind {
+	switch v.(type) {
+	case int, int64, float64:
+		return Number
+	case string:
+		return String
+	case bool:
+		return Bool
+	case []interface{}:
+		return Array
+	case map[string]interface{}:
+		return Object
+	case nil:
+		return Null
+	}
+	return Any
+}
+
+// Matches reports whether a value of kind k is acceptable where want is
+// expected.
+func (k Kind) Matches(want Kind) bool {
+	return want == Any || k == want || k == Any
+}
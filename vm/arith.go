@@ -0,0 +1,143 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/peiblow/vvm/compiler"
+)
+
+// Arithmetic semantics
+//
+// Numbers reach the VM either as Go ints (OP_PUSH, results of integer ops) or
+// as float64 (OP_CONST literals, JSON-decoded args). Integrality is therefore
+// decided by value rather than by Go type: when both operands are whole
+// numbers the operation runs on int64 with overflow checks and `/`
+// truncates toward zero; a whole operand outside the int64 range is itself
+// an overflow. As soon as one operand has a fractional part the operation
+// is carried out in float64.
+//
+// Overflow and division by zero raise catchable Synx errors instead of
+// producing Inf/NaN or silently wrapping.
+
+const (
+	errArithmeticOverflow = "ARITHMETIC_OVERFLOW"
+	errDivisionByZero     = "DIVISION_BY_ZERO"
+)
+
+// asInteger reports v as an int64 when it is a whole number. overflow is
+// set when v is whole but outside the int64 range (see
+// compiler.IntegerOperand).
+func asInteger(v interface{}) (n int64, whole, overflow bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true, false
+	case int64:
+		return n, true, false
+	case float64:
+		return compiler.IntegerOperand(n)
+	}
+	return 0, false, false
+}
+
+func (vm *VM) raiseArithmetic(code string, format string, args ...interface{}) {
+	vm.raise(map[string]interface{}{
+		"code":    code,
+		"message": fmt.Sprintf(format, args...),
+	})
+}
+
+// arith applies op to a and b, pushing the result or raising an error.
+func (vm *VM) arith(op string, a, b interface{}) {
+	if !isNumeric(a) || !isNumeric(b) {
+		panic(fmt.Sprintf("unsupported %s operands: %T and %T", op, a, b))
+	}
+
+	ia, aInt, aOverflow := asInteger(a)
+	ib, bInt, bOverflow := asInteger(b)
+	if aInt && bInt {
+		if aOverflow || bOverflow {
+			vm.raiseArithmetic(errArithmeticOverflow, "integer overflow in %v %s %v", a, op, b)
+			return
+		}
+		vm.intArith(op, ia, ib)
+		return
+	}
+
+	vm.floatArith(op, asNumber(a), asNumber(b))
+}
+
+func (vm *VM) intArith(op string, a, b int64) {
+	var r int64
+
+	switch op {
+	case "+":
+		if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+			vm.raiseArithmetic(errArithmeticOverflow, "integer overflow in %d + %d", a, b)
+			return
+		}
+		r = a + b
+	case "-":
+		if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+			vm.raiseArithmetic(errArithmeticOverflow, "integer overflow in %d - %d", a, b)
+			return
+		}
+		r = a - b
+	case "*":
+		r = a * b
+		if a != 0 && (r/a != b || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64)) {
+			vm.raiseArithmetic(errArithmeticOverflow, "integer overflow in %d * %d", a, b)
+			return
+		}
+	case "/", "%":
+		if b == 0 {
+			vm.raiseArithmetic(errDivisionByZero, "division by zero in %d %s %d", a, op, b)
+			return
+		}
+		if a == math.MinInt64 && b == -1 {
+			vm.raiseArithmetic(errArithmeticOverflow, "integer overflow in %d %s %d", a, op, b)
+			return
+		}
+		if op == "/" {
+			r = a / b
+		} else {
+			r = a % b
+		}
+	default:
+		panic(fmt.Sprintf("unknown arithmetic operator %q", op))
+	}
+
+	vm.push(int(r))
+}
+
+func (vm *VM) floatArith(op string, a, b float64) {
+	var r float64
+
+	switch op {
+	case "+":
+		r = a + b
+	case "-":
+		r = a - b
+	case "*":
+		r = a * b
+	case "/", "%":
+		if b == 0 {
+			vm.raiseArithmetic(errDivisionByZero, "division by zero in %v %s %v", a, op, b)
+			return
+		}
+		if op == "/" {
+			r = a / b
+		} else {
+			r = math.Mod(a, b)
+		}
+	default:
+		panic(fmt.Sprintf("unknown arithmetic operator %q", op))
+	}
+
+	if math.IsInf(r, 0) || math.IsNaN(r) {
+		vm.raiseArithmetic(errArithmeticOverflow, "floating point overflow in %v %s %v", a, op, b)
+		return
+	}
+
+	vm.push(r)
+}
@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/peiblow/vvm/compiler"
+)
+
+func TestArith(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      string
+		a, b    interface{}
+		want    interface{} // pushed result, when wantErr is ""
+		wantErr string      // code raised
+	}{
+		{name: "int add", op: "+", a: 7, b: 5, want: 12},
+		{name: "whole floats use integer math", op: "/", a: 7.0, b: 2.0, want: 3},
+		{name: "division truncates toward zero", op: "/", a: -7, b: 2, want: -3},
+		{name: "fraction uses float math", op: "+", a: 7.5, b: 1, want: 8.5},
+		{name: "int mod", op: "%", a: 7, b: 3, want: 1},
+		{name: "mod keeps the dividend's sign", op: "%", a: -7, b: 3, want: -1},
+		{name: "float mod", op: "%", a: 7.5, b: 2, want: 1.5},
+		{name: "int division by zero", op: "/", a: 1, b: 0, wantErr: errDivisionByZero},
+		{name: "int mod by zero", op: "%", a: 1, b: 0, wantErr: errDivisionByZero},
+		{name: "float division by zero", op: "/", a: 1.5, b: 0, wantErr: errDivisionByZero},
+		{name: "float mod by zero", op: "%", a: 1.5, b: 0.0, wantErr: errDivisionByZero},
+		{name: "add overflow", op: "+", a: math.MaxInt64, b: 1, wantErr: errArithmeticOverflow},
+		{name: "sub overflow", op: "-", a: math.MinInt64, b: 1, wantErr: errArithmeticOverflow},
+		{name: "mul overflow", op: "*", a: math.MaxInt64, b: 2, wantErr: errArithmeticOverflow},
+		{name: "MinInt64 / -1", op: "/", a: math.MinInt64, b: -1, wantErr: errArithmeticOverflow},
+		{name: "MinInt64 % -1", op: "%", a: math.MinInt64, b: -1, wantErr: errArithmeticOverflow},
+		{name: "whole operand past int64", op: "+", a: 1e19, b: 0, wantErr: errArithmeticOverflow},
+		{name: "2^63 operand", op: "-", a: 9223372036854775808.0, b: 1, wantErr: errArithmeticOverflow},
+		{name: "float overflow", op: "*", a: 1e300, b: 1.5e300, wantErr: errArithmeticOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := New(&compiler.Compiler{})
+			vm.arith(tt.op, tt.a, tt.b)
+			if tt.wantErr != "" {
+				if vm.lastError == nil || vm.lastError["code"] != tt.wantErr {
+					t.Fatalf("%v %s %v raised %v, want %s", tt.a, tt.op, tt.b, vm.lastError, tt.wantErr)
+				}
+				return
+			}
+			if vm.lastError != nil {
+				t.Fatalf("%v %s %v raised %v", tt.a, tt.op, tt.b, vm.lastError)
+			}
+			if len(vm.stack) != 1 || vm.stack[0] != tt.want {
+				t.Fatalf("%v %s %v pushed %v, want %v (%T)", tt.a, tt.op, tt.b, vm.stack, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestModOperator(t *testing.T) {
+	src := `contract C {
+  fn mod(a: UInt, b: UInt): UInt { return a % b }
+}`
+	artifact, err := NewRuntime().Build([]byte(src), BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	if result := NewFromArtifact(artifact).RunFunction("mod", 7.0, 3.0); !result.Success || result.Value != 1 {
+		t.Fatalf("mod(7, 3) = %v (error %v), want 1", result.Value, result.Error)
+	}
+	if result := NewFromArtifact(artifact).RunFunction("mod", 7.0, 0.0); result.Success || result.Error["code"] != errDivisionByZero {
+		t.Fatalf("mod(7, 0) = %v (error %v), want %s", result.Value, result.Error, errDivisionByZero)
+	}
+}
@@ -0,0 +1,32 @@
+package vm
+
+import (
+	"github.com/peiblow/vvm/stdlib"
+)
+
+// execBuiltin calls a stdlib function. Operands are the const index of the
+// builtin name and the number of arguments on the stack.
+func (vm *VM) execBuiltin(nameIdx, argc int) {
+	name, _ := vm.compiler.ConstPool[nameIdx].(string)
+
+	args := make([]interface{}, argc)
+	for i := argc - 1; i >= 0; i-- {
+		args[i] = vm.pop("OP_BUILTIN")
+	}
+
+	result, err := stdlib.Call(name, args)
+	if err != nil {
+		errMap := map[string]interface{}{
+			"code":    "BUILTIN_ERROR",
+			"message": err.Error(),
+		}
+		if e, ok := err.(*stdlib.Error); ok {
+			errMap["code"] = e.Code
+			errMap["message"] = e.Message
+		}
+		vm.raise(errMap)
+		return
+	}
+
+	vm.push(result)
+}
@@ -0,0 +1,96 @@
+package vm
+
+import (
+	"fmt"
+	"testing"
+)
+
+const catchContract = `contract C {
+  error LimitExceeded { limit: UInt, requested: UInt }
+  error Frozen { account: String }
+
+  fn fail(kind: UInt): Void {
+    if (kind == 1) {
+      require(false; LimitExceeded(100, 150))
+    }
+    if (kind == 2) {
+      require(false; Frozen("acc-1"))
+    }
+    if (kind == 3) {
+      require(false; "OTHER", "something else")
+    }
+  }
+
+  fn typed(kind: UInt): String {
+    try {
+      fail(kind)
+    } catch (e: LimitExceeded) {
+      return "limit " + e.details.limit
+    } catch (e: Frozen) {
+      return "frozen " + e.details.account
+    } catch (e) {
+      return "other " + e.code
+    }
+    return "ok"
+  }
+
+  fn outer(kind: UInt): String {
+    try {
+      try {
+        fail(kind)
+      } catch (e: LimitExceeded) {
+        return "inner"
+      }
+    } catch (e) {
+      return "outer " + e.code
+    }
+    return "ok"
+  }
+
+  fn uncaught(kind: UInt): String {
+    try {
+      fail(kind)
+    } catch (e: LimitExceeded) {
+      return "limit"
+    }
+    return "ok"
+  }
+}`
+
+func TestTypedCatch(t *testing.T) {
+	artifact, err := NewRuntime().Build([]byte(catchContract), BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	tests := []struct {
+		function string
+		kind     float64
+		want     string // returned value, when wantErr is ""
+		wantErr  string // code the call fails with
+	}{
+		{function: "typed", kind: 0, want: "ok"},
+		{function: "typed", kind: 1, want: "limit 100"},
+		{function: "typed", kind: 2, want: "frozen acc-1"},
+		{function: "typed", kind: 3, want: "other OTHER"},
+		{function: "outer", kind: 1, want: "inner"},
+		{function: "outer", kind: 2, want: "outer Frozen"},
+		{function: "uncaught", kind: 1, want: "limit"},
+		{function: "uncaught", kind: 2, wantErr: "Frozen"},
+		{function: "uncaught", kind: 3, wantErr: "OTHER"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s(%v)", tt.function, tt.kind), func(t *testing.T) {
+			result := NewFromArtifact(artifact).RunFunction(tt.function, tt.kind)
+			if tt.wantErr != "" {
+				if result.Success || result.Error["code"] != tt.wantErr {
+					t.Fatalf("%s(%v) = %v (error %v), want code %s", tt.function, tt.kind, result.Value, result.Error, tt.wantErr)
+				}
+				return
+			}
+			if !result.Success || result.Value != tt.want {
+				t.Fatalf("%s(%v) = %v (error %v), want %q", tt.function, tt.kind, result.Value, result.Error, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/peiblow/vvm/compiler"
+)
+
+// Debugger drives a function call one step at a time. Steps follow the
+// compiler's line table: StepInto stops at the next statement wherever it
+// is, StepOver skips statements inside calls made from the current frame,
+// and StepOut runs until the current function returns. Every step also
+// stops at breakpoints.
+type Debugger struct {
+	vm          *VM
+	function    string
+	meta        compiler.FunctionMeta
+	breakpoints map[int]bool
+	result      *ExecutionResult
+}
+
+// Frame is one entry of the call stack, innermost first.
+type Frame struct {
+	Function string
+	PC       int
+	Line     int
+}
+
+// TryInfo describes an active try block.
+type TryInfo struct {
+	Handler   int
+	ErrorSlot int
+	CallDepth int
+}
+
+// Debug prepares a call to funcName without running it. The debugger stops
+// before the function's first instruction.
+func (vm *VM) Debug(funcName string, args ...interface{}) (*Debugger, error) {
+	meta, failed := vm.enterFunction(funcName, args)
+	if failed != nil {
+		return nil, fmt.Errorf("%v", failed.Error["message"])
+	}
+	return &Debugger{
+		vm:          vm,
+		function:    funcName,
+		meta:        meta,
+		breakpoints: make(map[int]bool),
+	}, nil
+}
+
+// Break sets a breakpoint on the instruction at pc.
+func (d *Debugger) Break(pc int) error {
+	if pc < 0 || pc >= len(d.vm.compiler.Code) {
+		return fmt.Errorf("pc %d is outside the bytecode (0-%d)", pc, len(d.vm.compiler.Code)-1)
+	}
+	d.breakpoints[pc] = true
+	return nil
+}
+
+// BreakLine sets a breakpoint on the first instruction of a source line and
+// returns its pc.
+func (d *Debugger) BreakLine(line int) (int, error) {
+	pc, ok := d.vm.compiler.LinePC(line)
+	if !ok {
+		return 0, fmt.Errorf("no code on line %d", line)
+	}
+	d.breakpoints[pc] = true
+	return pc, nil
+}
+
+// Clear removes the breakpoint at pc.
+func (d *Debugger) Clear(pc int) {
+	delete(d.breakpoints, pc)
+}
+
+// Breakpoints lists the breakpoint addresses in ascending order.
+func (d *Debugger) Breakpoints() []int {
+	pcs := make([]int, 0, len(d.breakpoints))
+	for pc := range d.breakpoints {
+		pcs = append(pcs, pc)
+	}
+	sort.Ints(pcs)
+	return pcs
+}
+
+// Done reports whether the call has finished.
+func (d *Debugger) Done() bool {
+	return d.result != nil
+}
+
+// Result is the call's result once it has finished, or nil.
+func (d *Debugger) Result() *ExecutionResult {
+	return d.result
+}
+
+// PC is the address of the next instruction to execute.
+func (d *Debugger) PC() int {
+	return d.vm.ip
+}
+
+// Line is the source line of the next instruction, or 0 if unknown.
+func (d *Debugger) Line() int {
+	return d.vm.compiler.LineAt(d.vm.ip)
+}
+
+// Instruction disassembles the next instruction.
+func (d *Debugger) Instruction() string {
+	code := d.vm.compiler.Code
+	if d.vm.ip >= len(code) {
+		return ""
+	}
+	inst, err := compiler.Decode(code, d.vm.ip)
+	if err != nil {
+		return compiler.OpcodeName(code[d.vm.ip])
+	}
+	return d.vm.compiler.Format(inst)
+}
+
+// StepInstruction executes exactly one instruction.
+func (d *Debugger) StepInstruction() {
+	d.exec()
+}
+
+// StepInto runs to the next statement, entering calls.
+func (d *Debugger) StepInto() {
+	d.run(func() bool { return d.vm.compiler.IsStatementStart(d.vm.ip) })
+}
+
+// StepOver runs to the next statement of the current frame or its callers.
+func (d *Debugger) StepOver() {
+	depth := len(d.vm.callStack)
+	d.run(func() bool {
+		return len(d.vm.callStack) <= depth && d.vm.compiler.IsStatementStart(d.vm.ip)
+	})
+}
+
+// StepOut runs until the current function returns to its caller.
+func (d *Debugger) StepOut() {
+	depth := len(d.vm.callStack)
+	d.run(func() bool { return len(d.vm.callStack) < depth })
+}
+
+// Continue runs until a breakpoint or the end of the call.
+func (d *Debugger) Continue() {
+	d.run(func() bool { return false })
+}
+
+// run executes at least one instruction, then stops when stop reports true,
+// at a breakpoint, or when the call finishes.
+func (d *Debugger) run(stop func() bool) {
+	for d.exec() {
+		if d.breakpoints[d.vm.ip] || stop() {
+			return
+		}
+	}
+}
+
+// exec executes one instruction and reports whether the call is still
+// running.
+func (d *Debugger) exec() bool {
+	if d.result != nil {
+		return false
+	}
+	if result := d.vm.debugStep(); result != nil {
+		final := d.vm.finishFunction(d.function, d.meta, *result)
+		d.result = &final
+		return false
+	}
+	return true
+}
+
+// Stack returns a copy of the operand stack, bottom first.
+func (d *Debugger) Stack() []interface{} {
+	return append([]interface{}{}, d.vm.stack...)
+}
+
+// Lookup returns the storage value of a named variable.
+func (d *Debugger) Lookup(name string) (interface{}, bool) {
+	slot, ok := d.vm.compiler.Symbols[name]
+	if !ok {
+		return nil, false
+	}
+	return d.vm.storage[slot], true
+}
+
+// Symbols lists the named storage slots, hiding the compiler's internal
+// names.
+func (d *Debugger) Symbols() []string {
+	names := make([]string, 0, len(d.vm.compiler.Symbols))
+	for name := range d.vm.compiler.Symbols {
+		if strings.HasPrefix(name, "__") || strings.Contains(name, "/") || strings.Contains(name, ":") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CallStack returns the active frames, innermost first. The call started
+// by Debug is the outermost frame.
+func (d *Debugger) CallStack() []Frame {
+	frames := []Frame{d.frameAt(d.vm.ip)}
+	// callStack[0] is the halt address pushed by enterFunction.
+	for i := len(d.vm.callStack) - 1; i >= 1; i-- {
+		frames = append(frames, d.frameAt(d.vm.callStack[i]))
+	}
+	return frames
+}
+
+func (d *Debugger) frameAt(pc int) Frame {
+	return Frame{
+		Function: d.vm.functionAt(pc),
+		PC:       pc,
+		Line:     d.vm.compiler.LineAt(pc),
+	}
+}
+
+// TryStack returns the active try blocks, innermost first.
+func (d *Debugger) TryStack() []TryInfo {
+	infos := make([]TryInfo, 0, len(d.vm.tryStack))
+	for i := len(d.vm.tryStack) - 1; i >= 0; i-- {
+		frame := d.vm.tryStack[i]
+		infos = append(infos, TryInfo{
+			Handler:   frame.handlerAddr,
+			ErrorSlot: frame.errorSlot,
+			CallDepth: frame.callDepth,
+		})
+	}
+	return infos
+}
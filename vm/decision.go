@@ -0,0 +1,220 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Decision outcomes.
+const (
+	DecisionAllow  = "ALLOW"
+	DecisionDeny   = "DENY"
+	DecisionReview = "REVIEW"
+)
+
+// Decision is the standard envelope governance callers act on. It is
+// derived from what a function returns:
+//
+//   - a Bool: true is ALLOW, false is DENY
+//   - a string "ALLOW", "DENY" or "REVIEW"
+//   - an object with a "decision" string, and optionally "reasons" (a
+//     string or array of strings) and "rules" (an array of rule names)
+//
+// A failed require or check is a DENY whose reasons are the failure
+// messages. Other return values and errors carry no decision.
+type Decision struct {
+	Outcome      string   `json:"outcome"`
+	Reasons      []string `json:"reasons"`
+	MatchedRules []string `json:"matched_rules"`
+}
+
+// decide builds the decision envelope for a finished call, or nil if the
+// call does not express one. rules are the policy rules read while it ran;
+// isAssertion reports whether an error came from a failed require or check,
+// whatever code it carries.
+func decide(result ExecutionResult, rules []string, isAssertion func(map[string]interface{}) bool) *Decision {
+	d := &Decision{Reasons: []string{}, MatchedRules: append([]string{}, rules...)}
+
+	if !result.Success {
+		if result.Error == nil {
+			return nil
+		}
+		failures, _ := result.Error["failures"].([]interface{})
+		if len(failures) == 0 {
+			failures = []interface{}{result.Error}
+		}
+		for _, f := range failures {
+			failure, _ := f.(map[string]interface{})
+			if failure == nil || !isAssertion(failure) {
+				return nil
+			}
+			d.Reasons = append(d.Reasons, fmt.Sprintf("%v", failure["message"]))
+		}
+		d.Outcome = DecisionDeny
+		return d
+	}
+
+	switch v := result.Value.(type) {
+	case bool:
+		d.Outcome = DecisionDeny
+		if v {
+			d.Outcome = DecisionAllow
+		}
+	case string:
+		if !isOutcome(v) {
+			return nil
+		}
+		d.Outcome = v
+	case map[string]interface{}:
+		outcome, _ := v["decision"].(string)
+		if !isOutcome(outcome) {
+			return nil
+		}
+		d.Outcome = outcome
+		d.Reasons = append(d.Reasons, stringList(v["reasons"])...)
+		for _, rule := range stringList(v["rules"]) {
+			if !containsString(d.MatchedRules, rule) {
+				d.MatchedRules = append(d.MatchedRules, rule)
+			}
+		}
+	default:
+		return nil
+	}
+	return d
+}
+
+func isOutcome(s string) bool {
+	return s == DecisionAllow || s == DecisionDeny || s == DecisionReview
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// recordRuleRead notes that property key of target was read, if target is
+// one of the contract's policies.
+func (vm *VM) recordRuleRead(target map[string]interface{}, key string) {
+	if len(vm.policyObjects) == 0 {
+		return
+	}
+	policy, ok := vm.policyObjects[reflect.ValueOf(target).Pointer()]
+	if !ok {
+		return
+	}
+	rule := policy + "." + key
+	if !containsString(vm.matchedRules, rule) {
+		vm.matchedRules = append(vm.matchedRules, rule)
+		vm.tracePolicyRead(rule, target[key])
+	}
+}
+
+// indexPolicyObjects remembers which stored objects are policies so reads
+// of their rules can be reported in the decision envelope.
+func (vm *VM) indexPolicyObjects() {
+	vm.policyObjects = make(map[uintptr]string)
+	for name, meta := range vm.compiler.Policies {
+		if obj, ok := vm.storage[meta.Slot].(map[string]interface{}); ok {
+			vm.policyObjects[reflect.ValueOf(obj).Pointer()] = name
+		}
+	}
+}
+
+func (vm *VM) markAssertionError(errMap map[string]interface{}) {
+	if vm.assertionErrors == nil {
+		vm.assertionErrors = make(map[uintptr]bool)
+	}
+	vm.assertionErrors[reflect.ValueOf(errMap).Pointer()] = true
+}
+
+func (vm *VM) isAssertionError(errMap map[string]interface{}) bool {
+	return vm.assertionErrors[reflect.ValueOf(errMap).Pointer()]
+}
+
+// checkReturn converts a function's return value to its declared type.
+// Comparisons produce 0 or 1, so numbers are accepted for Bool; numbers
+// are returned as int when whole.
+func (vm *VM) checkReturn(value interface{}, typeName string) (interface{}, error) {
+	switch {
+	case typeName == "":
+		return value, nil
+	case typeName == "Void":
+		return nil, nil
+	case strings.HasPrefix(typeName, "[]"):
+		arr, ok := value.([]interface{})
+		if !ok {
+			return nil, returnTypeError(typeName, value)
+		}
+		result := make([]interface{}, len(arr))
+		for i, item := range arr {
+			converted, err := vm.checkReturn(item, typeName[2:])
+			if err != nil {
+				return nil, err
+			}
+			result[i] = converted
+		}
+		return result, nil
+	}
+
+	switch typeName {
+	case "Bool":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int, int64, float64:
+			return toBool(v), nil
+		}
+	case "UInt":
+		// Whole numbers past the int64 range would wrap when converted.
+		n, whole, overflow := asInteger(value)
+		if whole && overflow {
+			return nil, fmt.Errorf("function must return UInt, got %v, which is past the 64-bit integer range", value)
+		}
+		if whole && n >= 0 {
+			return int(n), nil
+		}
+	case "String", "Address":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	default:
+		if obj, ok := value.(map[string]interface{}); ok {
+			if typeMeta, declared := vm.compiler.Types[typeName]; declared {
+				for field := range typeMeta.Fields {
+					if _, present := obj[field]; !present {
+						return nil, fmt.Errorf("function must return %s, but field '%s' is missing", typeName, field)
+					}
+				}
+			}
+			return obj, nil
+		}
+	}
+	return nil, returnTypeError(typeName, value)
+}
+
+func returnTypeError(typeName string, value interface{}) error {
+	return fmt.Errorf("function must return %s, got %s", typeName, describeValue(value))
+}
+
+func describeValue(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "Bool"
+	case string:
+		return "String"
+	case int, int64, float64:
+		return "Number"
+	case []interface{}:
+		return "Array"
+	case map[string]interface{}:
+		return "Object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,159 @@
+package vm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/peiblow/vvm/compiler"
+)
+
+func TestDecide(t *testing.T) {
+	failed := func(errs ...map[string]interface{}) ExecutionResult {
+		if len(errs) == 1 {
+			return ExecutionResult{Error: errs[0]}
+		}
+		failures := make([]interface{}, len(errs))
+		for i, e := range errs {
+			failures[i] = e
+		}
+		return ExecutionResult{Error: map[string]interface{}{"code": "CHECK_FAILED", "failures": failures}}
+	}
+	assertion := func(message string) map[string]interface{} {
+		return map[string]interface{}{"code": "REQUIRE_FAILED", "message": message}
+	}
+	isAssertion := func(e map[string]interface{}) bool { return e["code"] == "REQUIRE_FAILED" }
+	rules := []string{"Credit.minScore"}
+
+	tests := []struct {
+		name   string
+		result ExecutionResult
+		want   *Decision
+	}{
+		{
+			name:   "true",
+			result: ExecutionResult{Success: true, Value: true},
+			want:   &Decision{Outcome: DecisionAllow, Reasons: []string{}, MatchedRules: rules},
+		},
+		{
+			name:   "false",
+			result: ExecutionResult{Success: true, Value: false},
+			want:   &Decision{Outcome: DecisionDeny, Reasons: []string{}, MatchedRules: rules},
+		},
+		{
+			name:   "outcome string",
+			result: ExecutionResult{Success: true, Value: "REVIEW"},
+			want:   &Decision{Outcome: DecisionReview, Reasons: []string{}, MatchedRules: rules},
+		},
+		{
+			name:   "other string",
+			result: ExecutionResult{Success: true, Value: "maybe"},
+		},
+		{
+			name: "object",
+			result: ExecutionResult{Success: true, Value: map[string]interface{}{
+				"decision": "DENY",
+				"reasons":  []interface{}{"score too low", "amount too high"},
+				"rules":    []interface{}{"Credit.maxAmount", "Credit.minScore"},
+			}},
+			want: &Decision{
+				Outcome:      DecisionDeny,
+				Reasons:      []string{"score too low", "amount too high"},
+				MatchedRules: []string{"Credit.minScore", "Credit.maxAmount"},
+			},
+		},
+		{
+			name:   "object with a single reason",
+			result: ExecutionResult{Success: true, Value: map[string]interface{}{"decision": "ALLOW", "reasons": "fine"}},
+			want:   &Decision{Outcome: DecisionAllow, Reasons: []string{"fine"}, MatchedRules: rules},
+		},
+		{
+			name:   "object without a decision",
+			result: ExecutionResult{Success: true, Value: map[string]interface{}{"score": 700}},
+		},
+		{
+			name:   "number",
+			result: ExecutionResult{Success: true, Value: 700},
+		},
+		{
+			name:   "failed require",
+			result: failed(assertion("Score too low")),
+			want:   &Decision{Outcome: DecisionDeny, Reasons: []string{"Score too low"}, MatchedRules: rules},
+		},
+		{
+			name:   "failed checks",
+			result: failed(assertion("Score too low"), assertion("Amount too high")),
+			want:   &Decision{Outcome: DecisionDeny, Reasons: []string{"Score too low", "Amount too high"}, MatchedRules: rules},
+		},
+		{
+			name:   "other error",
+			result: failed(map[string]interface{}{"code": "DIVISION_BY_ZERO", "message": "division by zero"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decide(tt.result, rules, isAssertion); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decide() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckReturn(t *testing.T) {
+	vm := New(&compiler.Compiler{Types: map[string]compiler.TypeMeta{
+		"Decision": {Fields: map[string]string{"score": "UInt", "client": "Address"}},
+	}})
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		typeName string
+		want     interface{}
+		wantErr  string // "" when the value converts
+	}{
+		{name: "untyped", value: 1.5, typeName: "", want: 1.5},
+		{name: "Void", value: 1, typeName: "Void", want: nil},
+		{name: "Bool", value: true, typeName: "Bool", want: true},
+		{name: "comparison result as Bool", value: 1, typeName: "Bool", want: true},
+		{name: "whole float as UInt", value: 700.0, typeName: "UInt", want: 700},
+		{name: "negative UInt", value: -1, typeName: "UInt", wantErr: "function must return UInt, got Number"},
+		{name: "fractional UInt", value: 1.5, typeName: "UInt", wantErr: "function must return UInt, got Number"},
+		{name: "UInt past int64", value: 1e19, typeName: "UInt", wantErr: "past the 64-bit integer range"},
+		{name: "UInt at 2^63", value: 9223372036854775808.0, typeName: "UInt", wantErr: "past the 64-bit integer range"},
+		{name: "String", value: "a", typeName: "String", want: "a"},
+		{name: "Number as String", value: 1, typeName: "String", wantErr: "function must return String, got Number"},
+		{name: "array", value: []interface{}{1.0, 2.0}, typeName: "[]UInt", want: []interface{}{1, 2}},
+		{name: "array item", value: []interface{}{1.0, "a"}, typeName: "[]UInt", wantErr: "function must return UInt, got String"},
+		{
+			name:     "declared type",
+			value:    map[string]interface{}{"score": 700, "client": "0xabc"},
+			typeName: "Decision",
+			want:     map[string]interface{}{"score": 700, "client": "0xabc"},
+		},
+		{
+			name:     "declared type missing a field",
+			value:    map[string]interface{}{"score": 700},
+			typeName: "Decision",
+			wantErr:  "function must return Decision, but field 'client' is missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := vm.checkReturn(tt.value, tt.typeName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("checkReturn(%v, %s) = %v, %v, want an error containing %q", tt.value, tt.typeName, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkReturn(%v, %s) = %v", tt.value, tt.typeName, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("checkReturn(%v, %s) = %#v, want %#v", tt.value, tt.typeName, got, tt.want)
+			}
+		})
+	}
+}
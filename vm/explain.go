@@ -0,0 +1,169 @@
+package vm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/peiblow/vvm/compiler"
+)
+
+// Trace step kinds.
+const (
+	StepRequire    = "require"
+	StepCheck      = "check"
+	StepBranch     = "branch"
+	StepPolicyRead = "policy_read"
+)
+
+// TraceStep is one entry of an explain trace. Require, check and branch
+// steps carry the condition's source text, the comparisons evaluated while
+// computing it and the outcome (Passed for a require or check, Taken "then" or
+// "else" for a branch). Policy reads carry the rule and the value read,
+// and are recorded the first time each rule is read.
+type TraceStep struct {
+	Kind     string         `json:"kind"`
+	Function string         `json:"function,omitempty"`
+	Expr     string         `json:"expr,omitempty"`
+	Message  string         `json:"message,omitempty"`
+	Operands []TraceOperand `json:"operands,omitempty"`
+	Passed   *bool          `json:"passed,omitempty"`
+	Taken    string         `json:"taken,omitempty"`
+	Rule     string         `json:"rule,omitempty"`
+	Value    interface{}    `json:"value,omitempty"`
+}
+
+// TraceOperand is a comparison evaluated as part of a condition.
+type TraceOperand struct {
+	Op     string      `json:"op"`
+	Left   interface{} `json:"left"`
+	Right  interface{} `json:"right"`
+	Result bool        `json:"result"`
+}
+
+// Explain turns on explain mode: the VM records every evaluated require and
+// if condition and every policy rule read, returned in
+// ExecutionResult.Trace.
+func (vm *VM) Explain() *VM {
+	vm.explain = true
+	vm.trace = []TraceStep{}
+	return vm
+}
+
+// comparison is a comparison noted for the explain trace, with the call
+// depth it was evaluated at.
+type comparison struct {
+	operand TraceOperand
+	depth   int
+}
+
+// noteComparison remembers a comparison for the next require or branch
+// step.
+func (vm *VM) noteComparison(op string, left, right interface{}, result bool) {
+	if !vm.explain {
+		return
+	}
+	vm.comparisons = append(vm.comparisons, comparison{
+		operand: TraceOperand{Op: op, Left: left, Right: right, Result: result},
+		depth:   len(vm.callStack),
+	})
+}
+
+// startStatement forgets the comparisons earlier statements of the current
+// call evaluated, and those of the calls they made, so that a condition's
+// operands are only its own. A caller's are kept: its condition may be
+// waiting on this call.
+func (vm *VM) startStatement() {
+	kept := vm.comparisons[:0]
+	for _, c := range vm.comparisons {
+		if c.depth < len(vm.callStack) {
+			kept = append(kept, c)
+		}
+	}
+	vm.comparisons = kept
+}
+
+// traceCondition records the outcome of the condition tested by the
+// OP_JMP_IF at addr.
+func (vm *VM) traceCondition(addr int, cond bool) {
+	if !vm.explain {
+		return
+	}
+	var operands []TraceOperand
+	for _, c := range vm.comparisons {
+		operands = append(operands, c.operand)
+	}
+	vm.comparisons = nil
+
+	point, ok := vm.compiler.TracePoints[addr]
+	if !ok {
+		return
+	}
+	step := TraceStep{
+		Kind:     point.Kind,
+		Function: vm.currentFunction(),
+		Expr:     point.Expr,
+		Message:  point.Message,
+		Operands: operands,
+	}
+	switch point.Kind {
+	case compiler.TraceRequire, compiler.TraceCheck:
+		step.Passed = &cond
+	case compiler.TraceBranch:
+		step.Kind = StepBranch
+		step.Taken = "else"
+		if cond {
+			step.Taken = "then"
+		}
+	}
+	vm.trace = append(vm.trace, step)
+}
+
+func (vm *VM) tracePolicyRead(rule string, value interface{}) {
+	if !vm.explain {
+		return
+	}
+	vm.trace = append(vm.trace, TraceStep{
+		Kind:     StepPolicyRead,
+		Function: vm.currentFunction(),
+		Rule:     rule,
+		Value:    deepCopy(value),
+	})
+}
+
+// currentFunction names the function whose body is executing, found as
+// the closest function entry at or before ip.
+func (vm *VM) currentFunction() string {
+	return vm.functionAt(vm.ip)
+}
+
+// functionAt returns the function whose code contains pc.
+func (vm *VM) functionAt(pc int) string {
+	best, name := -1, ""
+	for addr, fn := range vm.compiler.FunctionName {
+		if addr <= pc && addr > best {
+			best, name = addr, fn
+		}
+	}
+	return name
+}
+
+// JournalTrace appends the explain trace to the journal as a DecisionTrace
+// event, so it is persisted alongside the events the contract emitted.
+func (vm *VM) JournalTrace(result *ExecutionResult) {
+	if !vm.explain {
+		return
+	}
+	payload := map[string]interface{}{"steps": vm.trace}
+	encoded, _ := json.Marshal(payload)
+	sum := sha256.Sum256(encoded)
+
+	vm.journal = append(vm.journal, JournalEvent{
+		Type:           "DecisionTrace",
+		Payload:        payload,
+		Hash:           "0x" + hex.EncodeToString(sum[:]),
+		Timestamp:      vm.timestamp,
+		PolicyVersions: vm.policyVersions,
+	})
+	result.Journal = vm.journal
+}
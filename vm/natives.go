@@ -0,0 +1,145 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/peiblow/vvm/stdlib"
+)
+
+// reservedCallNames are handled by dedicated opcodes and cannot be
+// registered as natives.
+var reservedCallNames = map[string]bool{
+	"len":     true,
+	"length":  true,
+	"print":   true,
+	"require": true,
+	"emit":    true,
+}
+
+// Natives is a registry of host functions callable from contracts through
+// OP_CALL_NATIVE. A Runtime owns one and shares it with every VM it starts;
+// it is safe for concurrent use.
+type Natives struct {
+	mu  sync.RWMutex
+	fns map[string]stdlib.Native
+}
+
+func NewNatives() *Natives {
+	return &Natives{fns: make(map[string]stdlib.Native)}
+}
+
+// Register adds a native function. Names must be unique and may not shadow
+// a stdlib builtin or a language builtin such as print.
+func (n *Natives) Register(native stdlib.Native) error {
+	name := native.Name
+	if name == "" {
+		return fmt.Errorf("native function must have a name")
+	}
+	if native.Fn == nil {
+		return fmt.Errorf("native '%s' has no implementation", name)
+	}
+	if reservedCallNames[name] {
+		return fmt.Errorf("native '%s' collides with a language builtin", name)
+	}
+	if _, ok := stdlib.Lookup(name); ok {
+		return fmt.Errorf("native '%s' collides with a stdlib builtin", name)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, exists := n.fns[name]; exists {
+		return fmt.Errorf("native '%s' is already registered", name)
+	}
+	n.fns[name] = native
+	return nil
+}
+
+// Lookup returns the native registered under name.
+func (n *Natives) Lookup(name string) (stdlib.Native, bool) {
+	if n == nil {
+		return stdlib.Native{}, false
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	native, ok := n.fns[name]
+	return native, ok
+}
+
+// Signatures returns a snapshot of every registered native, keyed by name,
+// for use by the analyzer and compiler at deploy time.
+func (n *Natives) Signatures() map[string]stdlib.Native {
+	sigs := make(map[string]stdlib.Native)
+	if n == nil {
+		return sigs
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for name, native := range n.fns {
+		sigs[name] = native
+	}
+	return sigs
+}
+
+// Missing returns the names in required that are not registered, sorted.
+func (n *Natives) Missing(required []string) []string {
+	var missing []string
+	for _, name := range required {
+		if _, ok := n.Lookup(name); !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// UseNatives attaches a native registry to the VM. VMs without one fail any
+// OP_CALL_NATIVE with NATIVE_NOT_FOUND.
+func (vm *VM) UseNatives(n *Natives) *VM {
+	vm.natives = n
+	return vm
+}
+
+// execCallNative calls a host function. Operands are the const index of the
+// native's name and the number of arguments on the stack.
+func (vm *VM) execCallNative(nameIdx, argc int) {
+	name, _ := vm.compiler.ConstPool[nameIdx].(string)
+
+	args := make([]interface{}, argc)
+	for i := argc - 1; i >= 0; i-- {
+		args[i] = vm.pop("OP_CALL_NATIVE")
+	}
+
+	native, ok := vm.natives.Lookup(name)
+	if !ok {
+		vm.raise(map[string]interface{}{
+			"code":    "NATIVE_NOT_FOUND",
+			"message": fmt.Sprintf("native function '%s' is not registered with this runtime", name),
+		})
+		return
+	}
+	if vm.strict && !native.Deterministic {
+		vm.raise(map[string]interface{}{
+			"code":    "NONDETERMINISTIC_NATIVE",
+			"message": fmt.Sprintf("native function '%s' is non-deterministic and the contract was deployed in strict mode", name),
+		})
+		return
+	}
+
+	result, err := native.Invoke(args)
+	if err != nil {
+		errMap := map[string]interface{}{
+			"code":    "NATIVE_ERROR",
+			"message": err.Error(),
+		}
+		if e, ok := err.(*stdlib.Error); ok {
+			errMap["code"] = e.Code
+			errMap["message"] = e.Message
+		}
+		vm.raise(errMap)
+		return
+	}
+
+	vm.push(result)
+}
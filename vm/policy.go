@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"fmt"
+	"time"
+)
+
+// ActivatePolicies puts the version of each versioned policy that is in
+// force at the given time into the slot functions read the policy from, and
+// stamps journal events with that time. When several versions match, the
+// one that took effect most recently wins.
+//
+// RunFunction activates policies at the current time if the host has not
+// done so already.
+func (vm *VM) ActivatePolicies(at time.Time) error {
+	ts := at.Unix()
+	versions := make(map[string]string)
+
+	for name, meta := range vm.compiler.Policies {
+		if len(meta.Versions) == 0 {
+			continue
+		}
+
+		active := -1
+		for i, v := range meta.Versions {
+			if !v.ActiveAt(ts) {
+				continue
+			}
+			if active < 0 || v.EffectiveFrom > meta.Versions[active].EffectiveFrom {
+				active = i
+			}
+		}
+		if active < 0 {
+			return fmt.Errorf("no version of policy '%s' is in force at %s", name, at.UTC().Format(time.RFC3339))
+		}
+
+		version := meta.Versions[active]
+		vm.storage[meta.Slot] = deepCopy(vm.storage[version.Slot])
+		versions[name] = version.Version
+	}
+
+	vm.timestamp = ts
+	vm.policyVersions = versions
+	vm.policiesActive = true
+	return nil
+}
+
+// PolicyVersions returns the version of each versioned policy selected by
+// ActivatePolicies.
+func (vm *VM) PolicyVersions() map[string]string {
+	return vm.policyVersions
+}
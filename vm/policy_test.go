@@ -0,0 +1,170 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/peiblow/vvm/compiler"
+)
+
+const paramContract = `contract C {
+  policy Credit {
+    minScore: param 700
+    ratio: param 0.5
+    offset: param -3
+    region: param "EU"
+  }
+
+  fn minScore(): UInt { return Credit.minScore }
+}`
+
+func TestParamOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		rule    string // "" for Credit.minScore
+		want    compiler.ParamValue
+		wantErr string // "" when the overrides are accepted
+	}{
+		{
+			name: "default",
+			want: compiler.ParamValue{Value: 700.0, Default: 700.0, Source: compiler.ParamSourceDefault},
+		},
+		{
+			name:   "whole override",
+			params: map[string]interface{}{"Credit.minScore": 720.0},
+			want:   compiler.ParamValue{Value: 720.0, Default: 700.0, Source: compiler.ParamSourceDeploy},
+		},
+		{
+			name:   "fraction for a fractional default",
+			params: map[string]interface{}{"Credit.ratio": 0.25},
+			rule:   "Credit.ratio",
+			want:   compiler.ParamValue{Value: 0.25, Default: 0.5, Source: compiler.ParamSourceDeploy},
+		},
+		{
+			name:   "negative for a negative default",
+			params: map[string]interface{}{"Credit.offset": -10.0},
+			rule:   "Credit.offset",
+			want:   compiler.ParamValue{Value: -10.0, Default: -3.0, Source: compiler.ParamSourceDeploy},
+		},
+		{
+			name:    "fraction for a whole default",
+			params:  map[string]interface{}{"Credit.minScore": 600.5},
+			wantErr: "param 'Credit.minScore' must be a whole number like its default 700, got 600.5",
+		},
+		{
+			name:    "negative for a non-negative default",
+			params:  map[string]interface{}{"Credit.minScore": -5.0},
+			wantErr: "param 'Credit.minScore' must not be negative like its default 700, got -5",
+		},
+		{
+			name:    "wrong kind",
+			params:  map[string]interface{}{"Credit.region": 1.0},
+			wantErr: "param 'Credit.region' must be String, got Number",
+		},
+		{
+			name:    "unknown rule",
+			params:  map[string]interface{}{"Credit.maxAmount": 1.0},
+			wantErr: "param 'Credit.maxAmount' does not match any policy rule declared with param",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			artifact, err := NewRuntime().Build([]byte(paramContract), BuildOptions{Params: tt.params})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Build() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			rule := tt.rule
+			if rule == "" {
+				rule = "Credit.minScore"
+			}
+			if got := artifact.Params[rule]; got != tt.want {
+				t.Fatalf("params[%s] = %+v, want %+v", rule, got, tt.want)
+			}
+		})
+	}
+}
+
+const versionedContract = `contract C {
+  policy Credit {
+    version: "v1"
+    effective_from: "2025-01-01"
+    minScore: 700
+  }
+
+  policy Credit {
+    version: "v2"
+    effective_from: "2026-01-01"
+    effective_until: "2027-01-01"
+    minScore: 650
+  }
+
+  fn minScore(): UInt { return Credit.minScore }
+
+  fn deny(): Bool {
+    require(false; "DENIED", "always denied")
+    return true
+  }
+}`
+
+func TestPolicyVersions(t *testing.T) {
+	artifact, err := NewRuntime().Build([]byte(versionedContract), BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	encoded, err := json.Marshal(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		function  string
+		timestamp int64
+		success   bool
+		value     string // the returned value, when success
+		versions  map[string]string
+	}{
+		{"before any version", "minScore", 1717200000, false, "", map[string]string{}},                                   // 2024-06-01
+		{"open-ended version", "minScore", 1740787200, true, "700", map[string]string{"Credit": "v1"}},                   // 2025-03-01
+		{"later version supersedes it", "minScore", 1772323200, true, "650", map[string]string{"Credit": "v2"}},          // 2026-03-01
+		{"earlier version after the later ends", "minScore", 1803859200, true, "700", map[string]string{"Credit": "v1"}}, // 2027-03-01
+		{"failed call", "deny", 1772323200, false, "", map[string]string{"Credit": "v2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := NewRuntime().Exec("1", ExecRequest{
+				ContractArtifact: encoded,
+				Function:         tt.function,
+				Args:             map[string]interface{}{},
+				Timestamp:        tt.timestamp,
+			})
+			if resp.Success != tt.success {
+				t.Fatalf("Success = %v (error %v), want %v", resp.Success, resp.Error, tt.success)
+			}
+			data, ok := resp.Data.(map[string]interface{})
+			if !ok {
+				t.Fatalf("Data = %v, want the call's details", resp.Data)
+			}
+			if tt.success && fmt.Sprint(data["value"]) != tt.value {
+				t.Fatalf("value = %v, want %s", data["value"], tt.value)
+			}
+			if data["timestamp"] != tt.timestamp {
+				t.Fatalf("timestamp = %v, want %d", data["timestamp"], tt.timestamp)
+			}
+			if versions := data["policy_versions"]; !reflect.DeepEqual(versions, tt.versions) {
+				t.Fatalf("policy_versions = %v, want %v", versions, tt.versions)
+			}
+		})
+	}
+}
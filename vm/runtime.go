@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/peiblow/vvm/ast"
 	"github.com/peiblow/vvm/compiler"
 	"github.com/peiblow/vvm/lexer"
 	"github.com/peiblow/vvm/parser"
@@ -16,11 +19,15 @@ import (
 type Runtime struct {
 	contracts map[string]*compiler.ContractArtifact
 	mu        sync.RWMutex
+	// Natives are host functions contracts may call. Register them before
+	// serving; deploys are analyzed against the set registered at the time.
+	Natives *Natives
 }
 
 func NewRuntime() *Runtime {
 	return &Runtime{
 		contracts: make(map[string]*compiler.ContractArtifact),
+		Natives:   NewNatives(),
 	}
 }
 
@@ -44,6 +51,10 @@ type DeployRequest struct {
 	Version      string `json:"version"`
 	Owner        string `json:"owner"`
 	Source       []byte `json:"source"`
+	Strict       bool   `json:"strict"`
+	// Params overrides policy rules declared with `param`, keyed
+	// "Policy.rule" (or "Policy@version.rule" for one policy version).
+	Params map[string]interface{} `json:"params"`
 }
 
 type ExecRequest struct {
@@ -51,12 +62,57 @@ type ExecRequest struct {
 	ContractArtifact json.RawMessage        `json:"contract_artifact"`
 	Function         string                 `json:"function"`
 	Args             map[string]interface{} `json:"args"`
+	// Timestamp is the Unix time the call is evaluated at; it selects the
+	// policy versions in force. Zero means now.
+	Timestamp int64 `json:"timestamp"`
+	// Explain returns a trace of the requires, branches and policy rules
+	// the call evaluated; JournalTrace also appends it to the journal.
+	Explain      bool `json:"explain"`
+	JournalTrace bool `json:"journal_trace"`
 }
 
 type AgentInfo struct {
-	Hash    string `json:"hash"`
+	Hash         string   `json:"hash"`
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Owner        string   `json:"owner"`
+	Purpose      string   `json:"purpose,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	RiskTier     string   `json:"risk_tier,omitempty"`
+	Expiry       string   `json:"expiry,omitempty"`
+	Jurisdiction []string `json:"jurisdiction,omitempty"`
+	Registry     string   `json:"registry,omitempty"`
+}
+
+type RegistryInfo struct {
 	Name    string `json:"name"`
+	Kind    string `json:"kind"`
 	Version string `json:"version"`
+	Owner   string `json:"owner"`
+	Hash    string `json:"hash,omitempty"`
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// ListenAndServe accepts wire protocol connections on addr, serving each
+// one on its own goroutine. It only returns if the listener fails.
+func (r *Runtime) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	fmt.Fprintln(Output, "VVM Runtime listening on", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			fmt.Fprintln(Output, "Error accepting connection:", err)
+			continue
+		}
+
+		go r.HandleConnection(conn)
+	}
 }
 
 func (r *Runtime) HandleConnection(conn net.Conn) {
@@ -64,19 +120,19 @@ func (r *Runtime) HandleConnection(conn net.Conn) {
 
 	var frameLength uint32
 	if err := binary.Read(conn, binary.BigEndian, &frameLength); err != nil {
-		fmt.Println("Error reading frame length:", err)
+		fmt.Fprintln(Output, "Error reading frame length:", err)
 		return
 	}
 
 	payload := make([]byte, frameLength)
 	if _, err := io.ReadFull(conn, payload); err != nil {
-		fmt.Println("Error reading payload:", err)
+		fmt.Fprintln(Output, "Error reading payload:", err)
 		return
 	}
 
 	var msg WireMessage
 	if err := json.Unmarshal(payload, &msg); err != nil {
-		fmt.Println("Error unmarshaling message:", err)
+		fmt.Fprintln(Output, "Error unmarshaling message:", err)
 		return
 	}
 
@@ -85,18 +141,18 @@ func (r *Runtime) HandleConnection(conn net.Conn) {
 	// Serializing response
 	respBytes, err := json.Marshal(response)
 	if err != nil {
-		fmt.Println("Error marshaling response:", err)
+		fmt.Fprintln(Output, "Error marshaling response:", err)
 		return
 	}
 
 	respLength := uint32(len(respBytes))
 	if err := binary.Write(conn, binary.BigEndian, respLength); err != nil {
-		fmt.Println("Error writing response length:", err)
+		fmt.Fprintln(Output, "Error writing response length:", err)
 		return
 	}
 
 	if _, err := conn.Write(respBytes); err != nil {
-		fmt.Println("Error writing response payload:", err)
+		fmt.Fprintln(Output, "Error writing response payload:", err)
 		return
 	}
 }
@@ -135,7 +191,7 @@ func (r *Runtime) processMessage(msg *WireMessage) (resp WireResponse) {
 }
 
 func (r *Runtime) HandleDeploy(msg *WireMessage) WireResponse {
-	fmt.Printf("Received DEPLOY request with ID %s\n", msg.ID)
+	fmt.Fprintf(Output, "Received DEPLOY request with ID %s\n", msg.ID)
 	var req DeployRequest
 	if err := json.Unmarshal(msg.Data, &req); err != nil {
 		return WireResponse{
@@ -146,55 +202,17 @@ func (r *Runtime) HandleDeploy(msg *WireMessage) WireResponse {
 		}
 	}
 
-	source := string(req.Source)
-
-	lexResult := lexer.Tokenize(source)
-	if lexResult.HasErrors() {
-		errMsg := "lexical errors in contract source:\n"
-		for _, e := range lexResult.Errors {
-			errMsg += "  " + e.Error() + "\n"
-		}
-
-		return WireResponse{
-			Type:    "DEPLOY_RESPONSE",
-			ID:      msg.ID,
-			Success: false,
-			Error:   fmt.Sprintf("invalid deploy request: %v", errMsg),
-		}
-	}
-
-	ast := parser.Parse(lexResult.Tokens)
-
-	analysis := parser.Analyze(ast)
-	if analysis.HasErrors() {
-		return WireResponse{
-			Type:    "DEPLOY_RESPONSE",
-			ID:      msg.ID,
-			Success: false,
-			Error:   fmt.Sprintf("Semantic errors in contract source: \n %v", analysis.Errors),
-		}
-	}
-
-	fmt.Println("Successful parse and analysis of contract source. Proceeding to compilation and deployment...")
-
-	cmpl := compiler.New()
-	cmpl.CompileBlock(ast)
-	artifact := cmpl.Artifact()
-
-	initVM := NewFromArtifact(artifact)
-	initResult := initVM.Run()
-	if !initResult.Success {
+	artifact, err := r.Build(req.Source, BuildOptions{Strict: req.Strict, Params: req.Params})
+	if err != nil {
 		return WireResponse{
 			Type:    "DEPLOY_RESPONSE",
 			ID:      msg.ID,
 			Success: false,
-			Error:   fmt.Sprintf("initialization failed: %v", initResult.Error),
+			Error:   err.Error(),
 		}
 	}
 
-	artifact.InitStorage = initVM.GetStorage()
-
-	agentInfo, agentErr := getAgents(artifact)
+	agents, agentErr := getAgents(artifact)
 	if agentErr != nil {
 		return WireResponse{
 			Type:    "DEPLOY_RESPONSE",
@@ -208,7 +226,7 @@ func (r *Runtime) HandleDeploy(msg *WireMessage) WireResponse {
 	r.contracts[req.Hash] = artifact
 	r.mu.Unlock()
 
-	fmt.Println("Successful Deploy! ", req.Hash)
+	fmt.Fprintln(Output, "Successful Deploy! ", req.Hash)
 
 	return WireResponse{
 		Type:    "DEPLOY_RESPONSE",
@@ -221,13 +239,126 @@ func (r *Runtime) HandleDeploy(msg *WireMessage) WireResponse {
 			"contract_owner":    req.Owner,
 			"contract_artifact": artifact,
 			"functions":         getFunctionNames(artifact),
-			"agent":             agentInfo,
+			"agent":             agents[0],
+			"agents":            agents,
+			"registries":        getRegistries(artifact),
+			"params":            artifact.Params,
+			"abi":               artifact.ABI(),
 		},
 	}
 }
 
+// Check lexes, parses and analyzes src against the registered natives,
+// returning the AST when the source is valid. Parse errors panic, as they
+// do for Build.
+func (r *Runtime) Check(src []byte, opts BuildOptions) (ast.BlockStmt, error) {
+	lexResult := lexer.Tokenize(string(src))
+	if lexResult.HasErrors() {
+		errMsg := "lexical errors in contract source:\n"
+		for _, e := range lexResult.Errors {
+			errMsg += "  " + e.Error() + "\n"
+		}
+		return ast.BlockStmt{}, fmt.Errorf("invalid deploy request: %v", errMsg)
+	}
+
+	program := parser.Parse(lexResult.Tokens)
+	if opts.TestSource != nil {
+		if err := addTests(&program, opts.TestSource); err != nil {
+			return ast.BlockStmt{}, err
+		}
+	}
+
+	analysis := parser.AnalyzeWithOptions(program, parser.Options{
+		Natives: r.Natives.Signatures(),
+		Strict:  opts.Strict,
+	})
+	if analysis.HasErrors() {
+		return ast.BlockStmt{}, fmt.Errorf("Semantic errors in contract source: \n %v", analysis.Errors)
+	}
+	return program, nil
+}
+
+// addTests parses a test file, which may only hold test blocks, and
+// appends its tests to the contract declared in program.
+func addTests(program *ast.BlockStmt, src []byte) error {
+	lexResult := lexer.Tokenize(string(src))
+	if lexResult.HasErrors() {
+		errMsg := "lexical errors in test source:\n"
+		for _, e := range lexResult.Errors {
+			errMsg += "  " + e.Error() + "\n"
+		}
+		return fmt.Errorf("%s", errMsg)
+	}
+
+	tests := parser.Parse(lexResult.Tokens)
+	for _, stmt := range tests.Body {
+		if _, ok := stmt.(ast.TestStmt); !ok {
+			return fmt.Errorf("test source may only contain test blocks, found %T", stmt)
+		}
+	}
+
+	for i, stmt := range program.Body {
+		if contract, ok := stmt.(ast.ContractStmt); ok {
+			contract.Body = append(contract.Body, tests.Body...)
+			program.Body[i] = contract
+			return nil
+		}
+	}
+	return fmt.Errorf("no 'contract' declaration to add tests to")
+}
+
+// BuildOptions configures Build.
+type BuildOptions struct {
+	// Strict rejects calls to non-deterministic natives.
+	Strict bool
+	// Params overrides policy rules declared with `param`.
+	Params map[string]interface{}
+	// Tests compiles the contract's test blocks, and TestSource holds
+	// further test blocks (a *_test.snx file) to add to the contract.
+	Tests      bool
+	TestSource []byte
+}
+
+// Build runs the full pipeline — lex, parse, analyze, compile and the
+// initialization run that fills InitStorage — without registering the
+// result. Building the same source against the same natives and params
+// always yields a byte-identical artifact.
+func (r *Runtime) Build(src []byte, opts BuildOptions) (*compiler.ContractArtifact, error) {
+	program, err := r.Check(src, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	natives := r.Natives.Signatures()
+	cmpl := compiler.New()
+	cmpl.Natives = make(map[string]bool, len(natives))
+	for name := range natives {
+		cmpl.Natives[name] = true
+	}
+	cmpl.Strict = opts.Strict
+	cmpl.Params = opts.Params
+	cmpl.CompileTests = opts.Tests
+	cmpl.CompileBlock(program)
+	if err := cmpl.CheckParams(); err != nil {
+		return nil, err
+	}
+	artifact := cmpl.Artifact()
+	if err := Verify(artifact); err != nil {
+		return nil, fmt.Errorf("invalid bytecode: %v", err)
+	}
+
+	initVM := NewFromArtifact(artifact).UseNatives(r.Natives)
+	initResult := initVM.Run()
+	if !initResult.Success {
+		return nil, fmt.Errorf("initialization failed: %v", initResult.Error)
+	}
+
+	artifact.InitStorage = initVM.GetStorage()
+	return artifact, nil
+}
+
 func (r *Runtime) HandleExec(msg *WireMessage) WireResponse {
-	fmt.Printf("Received EXEC request with ID %s\n", msg.ID)
+	fmt.Fprintf(Output, "Received EXEC request with ID %s\n", msg.ID)
 
 	var req ExecRequest
 	if err := json.Unmarshal(msg.Data, &req); err != nil {
@@ -239,11 +370,17 @@ func (r *Runtime) HandleExec(msg *WireMessage) WireResponse {
 		}
 	}
 
+	return r.Exec(msg.ID, req)
+}
+
+// Exec runs one EXEC request against the artifact it carries and builds
+// the EXEC_RESPONSE for it.
+func (r *Runtime) Exec(id string, req ExecRequest) WireResponse {
 	var artifact compiler.ContractArtifact
 	if err := json.Unmarshal(req.ContractArtifact, &artifact); err != nil {
 		return WireResponse{
 			Type:    "EXEC_RESPONSE",
-			ID:      msg.ID,
+			ID:      id,
 			Success: false,
 			Error:   fmt.Sprintf("invalid exec request: %v", err),
 		}
@@ -252,17 +389,29 @@ func (r *Runtime) HandleExec(msg *WireMessage) WireResponse {
 	if len(artifact.Bytecode) == 0 {
 		return WireResponse{
 			Type:    "EXEC_RESPONSE",
-			ID:      msg.ID,
+			ID:      id,
 			Success: false,
 			Error:   "empty bytecode",
 		}
 	}
 
+	if err := Verify(&artifact); err != nil {
+		return WireResponse{
+			Type:    "EXEC_RESPONSE",
+			ID:      id,
+			Success: false,
+			Error: map[string]interface{}{
+				"code":    "INVALID_BYTECODE",
+				"message": err.Error(),
+			},
+		}
+	}
+
 	funcMeta, funcExists := artifact.Functions[req.Function]
 	if !funcExists {
 		return WireResponse{
 			Type:    "EXEC_RESPONSE",
-			ID:      msg.ID,
+			ID:      id,
 			Success: false,
 			Error:   fmt.Sprintf("function '%s' not found in contract", req.Function),
 		}
@@ -272,11 +421,9 @@ func (r *Runtime) HandleExec(msg *WireMessage) WireResponse {
 	for _, meta := range funcMeta.ArgMeta {
 		val, exists := req.Args[meta.Name]
 		if !exists {
-			fmt.Println("Provided args:", req.Args)
-			fmt.Printf("Missing argument '%s' for function '%s'\n", meta.Name, req.Function)
 			return WireResponse{
 				Type:    "EXEC_RESPONSE",
-				ID:      msg.ID,
+				ID:      id,
 				Success: false,
 				Error:   fmt.Sprintf("missing argument '%s' for function '%s'", meta.Name, req.Function),
 			}
@@ -285,28 +432,87 @@ func (r *Runtime) HandleExec(msg *WireMessage) WireResponse {
 		orderedArgs = append(orderedArgs, val)
 	}
 
-	vm := NewFromArtifact(&artifact)
+	if missing := r.Natives.Missing(artifact.Natives); len(missing) > 0 {
+		return WireResponse{
+			Type:    "EXEC_RESPONSE",
+			ID:      id,
+			Success: false,
+			Error:   fmt.Sprintf("contract requires native function(s) not registered with this runtime: %v", missing),
+		}
+	}
+
+	at := time.Now()
+	if req.Timestamp != 0 {
+		at = time.Unix(req.Timestamp, 0)
+	}
+
+	vm := NewFromArtifact(&artifact).UseNatives(r.Natives)
+	if req.Explain || req.JournalTrace {
+		vm.Explain()
+	}
+	if err := vm.ActivatePolicies(at); err != nil {
+		return WireResponse{
+			Type:    "EXEC_RESPONSE",
+			ID:      id,
+			Success: false,
+			Error: map[string]interface{}{
+				"code":    "NO_ACTIVE_POLICY",
+				"message": err.Error(),
+			},
+			Data: map[string]interface{}{
+				"artifact_hash":   req.ArtifactHash,
+				"function":        req.Function,
+				"timestamp":       at.Unix(),
+				"policy_versions": map[string]string{},
+			},
+		}
+	}
 	result := vm.RunFunction(req.Function, orderedArgs...)
+	if !result.Success {
+		// A failed call's events do not happen. Its trace is still
+		// journaled below, since denials are what auditors look for.
+		vm.journal, result.Journal = nil, nil
+	}
+	if req.JournalTrace {
+		vm.JournalTrace(&result)
+	}
 
 	if !result.Success {
+		// A failed require is still a decision (DENY) callers can act on,
+		// and the trace shows which condition caused it. Every failure
+		// reports the time and policy versions it was evaluated under.
 		return WireResponse{
 			Type:    "EXEC_RESPONSE",
-			ID:      msg.ID,
+			ID:      id,
 			Success: false,
 			Error:   result.Error,
+			Data: map[string]interface{}{
+				"artifact_hash":   req.ArtifactHash,
+				"function":        req.Function,
+				"journal":         result.Journal,
+				"decision":        result.Decision,
+				"trace":           result.Trace,
+				"timestamp":       at.Unix(),
+				"policy_versions": vm.PolicyVersions(),
+			},
 		}
 	}
 
 	return WireResponse{
 		Type:    "EXEC_RESPONSE",
-		ID:      msg.ID,
+		ID:      id,
 		Success: true,
 		Data: map[string]interface{}{
-			"artifact_hash": req.ArtifactHash,
-			"function":      req.Function,
-			"journal":       result.Journal,
+			"artifact_hash":   req.ArtifactHash,
+			"function":        req.Function,
+			"journal":         result.Journal,
+			"value":           result.Value,
+			"return_type":     funcMeta.ReturnType,
+			"decision":        result.Decision,
+			"trace":           result.Trace,
+			"timestamp":       at.Unix(),
+			"policy_versions": vm.PolicyVersions(),
 		},
-		Error: result.Error,
 	}
 }
 
@@ -322,36 +528,106 @@ func getFunctionNames(artifact *compiler.ContractArtifact) []string {
 	for name := range artifact.Functions {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
-func getAgents(artifact *compiler.ContractArtifact) (*AgentInfo, error) {
-	for _, val := range artifact.InitStorage {
-		agentMap, ok := val.(map[string]interface{})
+// getAgents returns the agents declared by the contract, in declaration
+// order, as recorded in the artifact's initialized storage.
+func getAgents(artifact *compiler.ContractArtifact) ([]AgentInfo, error) {
+	names := make([]string, 0, len(artifact.Agents))
+	for name := range artifact.Agents {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return artifact.Agents[names[i]] < artifact.Agents[names[j]]
+	})
+
+	agents := make([]AgentInfo, 0, len(names))
+	for _, name := range names {
+		record, ok := artifact.InitStorage[artifact.Agents[name]].(map[string]interface{})
 		if !ok {
-			continue
+			return nil, fmt.Errorf("agent '%s' was declared but not initialized", name)
 		}
+		agents = append(agents, agentInfoFromRecord(record))
+	}
 
-		// Agent entries always have a "hash" field generated by execAgentDeclare.
-		rawHash, hasHash := agentMap["hash"]
-		if !hasHash {
-			continue
-		}
+	if len(agents) == 0 {
+		return nil, fmt.Errorf("no agent declaration found in contract storage — did you declare an 'agent' block?")
+	}
+	return agents, nil
+}
 
-		hash, ok := rawHash.(string)
+func agentInfoFromRecord(record map[string]interface{}) AgentInfo {
+	info := AgentInfo{
+		Hash:         extractValue(record["hash"]),
+		Name:         extractValue(record["name"]),
+		Version:      extractValue(record["version"]),
+		Owner:        extractValue(record["owner"]),
+		Capabilities: stringList(record["capabilities"]),
+		Jurisdiction: stringList(record["jurisdiction"]),
+	}
+	if v, ok := record["purpose"]; ok {
+		info.Purpose = extractValue(v)
+	}
+	if v, ok := record["risk_tier"]; ok {
+		info.RiskTier = extractValue(v)
+	}
+	if v, ok := record["expiry"]; ok {
+		info.Expiry = extractValue(v)
+	}
+	if v, ok := record["registry"]; ok {
+		info.Registry = extractValue(v)
+	}
+	return info
+}
+
+// getRegistries returns the registry entries declared by the contract, in
+// declaration order.
+func getRegistries(artifact *compiler.ContractArtifact) []RegistryInfo {
+	names := make([]string, 0, len(artifact.Registries))
+	for name := range artifact.Registries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return artifact.Registries[names[i]] < artifact.Registries[names[j]]
+	})
+
+	entries := make([]RegistryInfo, 0, len(names))
+	for _, name := range names {
+		record, ok := artifact.InitStorage[artifact.Registries[name]].(map[string]interface{})
 		if !ok {
 			continue
 		}
-
-		name, _ := agentMap["name"].(string)
-		version, _ := agentMap["version"].(string)
-
-		return &AgentInfo{
-			Hash:    hash,
+		entry := RegistryInfo{
 			Name:    name,
-			Version: version,
-		}, nil
+			Kind:    extractValue(record["kind"]),
+			Version: extractValue(record["version"]),
+			Owner:   extractValue(record["owner"]),
+		}
+		if v, ok := record["hash"]; ok {
+			entry.Hash = extractValue(v)
+		}
+		if v, ok := record["purpose"]; ok {
+			entry.Purpose = extractValue(v)
+		}
+		entries = append(entries, entry)
 	}
+	return entries
+}
 
-	return nil, fmt.Errorf("no agent declaration found in contract storage — did you declare an 'agent' block?")
+// stringList accepts a single value or an array and returns its items as
+// strings; nil yields nil.
+func stringList(v interface{}) []string {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		out := make([]string, len(val))
+		for i, item := range val {
+			out[i] = extractValue(item)
+		}
+		return out
+	}
+	return []string{extractValue(v)}
 }
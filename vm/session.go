@@ -0,0 +1,264 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peiblow/vvm/ast"
+	"github.com/peiblow/vvm/compiler"
+	"github.com/peiblow/vvm/lexer"
+	"github.com/peiblow/vvm/parser"
+)
+
+// Session evaluates statements and expressions against a contract one input
+// at a time, keeping storage between inputs. Input is compiled onto the end
+// of the contract's bytecode, so it can read and assign the contract's
+// variables and policies and call its functions. `let` and `const` declare
+// session variables, which shadow a contract variable of the same name
+// instead of redeclaring it.
+type Session struct {
+	artifact *compiler.ContractArtifact
+	natives  *Natives
+	vm       *VM
+	at       time.Time
+	base     int // the first slot past the contract's own
+}
+
+// NewSession starts a session on a copy of the artifact's initial storage,
+// with policies activated at the current time.
+func NewSession(artifact *compiler.ContractArtifact, natives *Natives) (*Session, error) {
+	if err := Verify(artifact); err != nil {
+		return nil, fmt.Errorf("invalid bytecode: %v", err)
+	}
+	if missing := natives.Missing(artifact.Natives); len(missing) > 0 {
+		return nil, fmt.Errorf("contract requires native function(s) not registered: %v", missing)
+	}
+
+	s := &Session{artifact: artifact, natives: natives}
+	if err := s.Reset(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reset discards everything evaluated so far and starts again from the
+// artifact's initial storage, with policies activated at at.
+func (s *Session) Reset(at time.Time) error {
+	// The session compiles onto its own copy of the code and tables, so the
+	// artifact itself is never modified.
+	vm := NewFromArtifact(s.artifact).UseNatives(s.natives)
+	c := vm.compiler
+	c.Code = append([]byte(nil), c.Code...)
+	c.ConstPool = append([]interface{}(nil), c.ConstPool...)
+	c.Symbols = make(map[string]int, len(s.artifact.Symbols))
+	for name, slot := range s.artifact.Symbols {
+		c.Symbols[name] = slot
+		if slot >= c.NextSlot {
+			c.NextSlot = slot + 1
+		}
+	}
+	c.TracePoints = make(map[int]compiler.TracePoint, len(s.artifact.TracePoints))
+	for addr, point := range s.artifact.TracePoints {
+		c.TracePoints[addr] = point
+	}
+	c.Errors = s.artifact.Errors
+	c.Natives = make(map[string]bool)
+	for name := range s.natives.Signatures() {
+		c.Natives[name] = true
+	}
+	c.Strict = s.artifact.Strict
+
+	if err := vm.ActivatePolicies(at); err != nil {
+		return err
+	}
+	s.vm = vm
+	s.at = at
+	s.base = c.NextSlot
+	return nil
+}
+
+// SetTime re-activates policies at at, keeping storage.
+func (s *Session) SetTime(at time.Time) error {
+	if err := s.vm.ActivatePolicies(at); err != nil {
+		return err
+	}
+	s.at = at
+	return nil
+}
+
+// Time is the time policies are activated at.
+func (s *Session) Time() time.Time {
+	return s.at
+}
+
+// Eval compiles and runs src. Declarations belong in the contract source and
+// are rejected, as is `return`. If src ends with an expression, its value is
+// the result's Value and value is true. err reports input that does not
+// lex, parse, analyze or compile; failures while running are in the result.
+func (s *Session) Eval(src string) (result ExecutionResult, value bool, err error) {
+	lexed := lexer.Tokenize(src)
+	if lexed.HasErrors() {
+		return result, false, lexed.Errors[0]
+	}
+	program, err := parser.ParseChecked(lexed.Tokens)
+	if err != nil {
+		return result, false, err
+	}
+	for _, stmt := range program.Body {
+		switch stmt.(type) {
+		case ast.ContractStmt, ast.FuncStmt, ast.TypeDeclareStmt, ast.ErrorDeclStmt,
+			ast.PolicyStmt, ast.AgentStmt, ast.RegistryStmt, ast.TestStmt:
+			return result, false, fmt.Errorf("declarations must be made in the contract source")
+		case ast.ReturnStmt:
+			return result, false, fmt.Errorf("'return' is only valid inside a function")
+		}
+	}
+	if len(program.Body) == 0 {
+		return result, false, nil
+	}
+
+	analysis := parser.AnalyzeStatements(program.Body, s.scope(), parser.Options{
+		Natives: s.natives.Signatures(),
+		Strict:  s.artifact.Strict,
+	})
+	if analysis.HasErrors() {
+		return result, false, fmt.Errorf("%s", analysis.Errors[0].Message)
+	}
+
+	c := s.vm.compiler
+	shadowed := make(map[string]int)
+	for _, stmt := range program.Body {
+		if decl, ok := stmt.(ast.VarDeclStmt); ok {
+			for _, name := range []string{decl.Identifier, decl.Identifier + "/CONST"} {
+				if slot, exists := c.Symbols[name]; exists {
+					shadowed[name] = slot
+					delete(c.Symbols, name)
+				}
+			}
+		}
+	}
+	addr, value, err := c.CompileSnippet(program.Body)
+	if err != nil {
+		for name, slot := range shadowed {
+			c.Symbols[name] = slot
+		}
+		return result, false, err
+	}
+	// A session variable declared again has a new slot now; its old one is
+	// free. Contract slots are kept, since the contract's code uses them.
+	for name, slot := range shadowed {
+		if slot >= s.base && !strings.HasSuffix(name, "/CONST") {
+			c.ReuseSlot(slot)
+		}
+	}
+
+	vm := s.vm
+	vm.reset()
+	vm.ip = addr
+	vm.indexPolicyObjects()
+	result = vm.execute()
+	if len(vm.errors) > 0 {
+		result = ExecutionResult{Success: false, Journal: vm.journal, Error: vm.lastError}
+	}
+	if len(vm.checkFailures) > 0 {
+		result.Success = false
+		result.Error = vm.checkError(result.Error)
+	}
+	if result.Success && value && len(vm.stack) > 0 {
+		result.Value = vm.stack[len(vm.stack)-1]
+	}
+	return result, value && result.Success, nil
+}
+
+// Call runs a contract function with arguments keyed by name, as EXEC does.
+func (s *Session) Call(function string, args map[string]interface{}) (ExecutionResult, error) {
+	meta, ok := s.artifact.Functions[function]
+	if !ok {
+		return ExecutionResult{}, fmt.Errorf("function '%s' not found in contract", function)
+	}
+	ordered := make([]interface{}, 0, len(meta.ArgMeta))
+	for _, arg := range meta.ArgMeta {
+		val, ok := args[arg.Name]
+		if !ok {
+			return ExecutionResult{}, fmt.Errorf("missing argument '%s' for function '%s'", arg.Name, function)
+		}
+		ordered = append(ordered, val)
+	}
+
+	s.vm.reset()
+	return s.vm.RunFunction(function, ordered...), nil
+}
+
+// Variables returns the value of every named variable, contract and
+// session alike.
+func (s *Session) Variables() map[string]interface{} {
+	vars := make(map[string]interface{})
+	for _, name := range s.variableNames() {
+		vars[name] = deepCopy(s.vm.storage[s.vm.compiler.Symbols[name]])
+	}
+	return vars
+}
+
+// variableNames lists the named slots, leaving out types, the compiler's
+// hidden slots and constant markers.
+func (s *Session) variableNames() []string {
+	var names []string
+	for name := range s.vm.compiler.Symbols {
+		if _, isType := s.artifact.Types[name]; isType {
+			continue
+		}
+		if strings.HasPrefix(name, "__") || strings.HasSuffix(name, "/CONST") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scope describes the contract to the analyzer.
+func (s *Session) scope() parser.Scope {
+	scope := parser.Scope{
+		Functions: make(map[string]int, len(s.artifact.Functions)),
+		Errors:    make(map[string][]ast.TypeField, len(s.artifact.Errors)),
+		Variables: s.variableNames(),
+	}
+	for name, meta := range s.artifact.Functions {
+		scope.Functions[name] = len(meta.Args)
+	}
+	for name, meta := range s.artifact.Errors {
+		fields := make([]ast.TypeField, len(meta.Fields))
+		for i, field := range meta.Fields {
+			fields[i] = ast.TypeField{Name: field.Name, Type: ast.SymbolExpr{Value: field.Type}}
+		}
+		scope.Errors[name] = fields
+	}
+	for name := range s.artifact.Agents {
+		scope.Agents = append(scope.Agents, name)
+	}
+	for name := range s.artifact.Policies {
+		scope.Policies = append(scope.Policies, name)
+	}
+	return scope
+}
+
+// reset clears what a previous run left behind, keeping storage and the
+// active policies.
+func (vm *VM) reset() {
+	vm.stack = []interface{}{}
+	vm.tryStack = []TryFrame{}
+	vm.callStack = []int{}
+	vm.errors = nil
+	vm.journal = nil
+	vm.lastError = nil
+	vm.matchedRules = nil
+	vm.comparisons = nil
+	vm.checkFailures = nil
+	vm.failingAssertion = false
+	vm.assertionErrors = nil
+	if vm.explain {
+		vm.trace = []TraceStep{}
+	}
+}
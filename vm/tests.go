@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/peiblow/vvm/compiler"
+)
+
+// TestResult is the outcome of one contract test.
+type TestResult struct {
+	Name     string
+	Passed   bool
+	Error    map[string]interface{}
+	Duration time.Duration
+}
+
+// RunTests builds src with its test blocks and runs every test, in
+// declaration order, on a fresh deployment of the contract.
+func (r *Runtime) RunTests(src []byte, opts BuildOptions) ([]TestResult, error) {
+	opts.Tests = true
+	artifact, err := r.Build(src, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]TestResult, 0, len(artifact.Tests))
+	for _, name := range artifact.Tests {
+		start := time.Now()
+		result := NewFromArtifact(artifact).UseNatives(r.Natives).RunFunction(compiler.TestFunction(name))
+		results = append(results, TestResult{
+			Name:     name,
+			Passed:   result.Success,
+			Error:    result.Error,
+			Duration: time.Since(start),
+		})
+	}
+	return results, nil
+}
+
+// execExpectEmit fails the running test unless the journal holds an event
+// with the expected name whose payload contains the expected fields.
+func (vm *VM) execExpectEmit() {
+	expected := vm.pop("OP_EXPECT_EMIT")
+	name := extractValue(vm.pop("OP_EXPECT_EMIT"))
+
+	for _, event := range vm.journal {
+		if event.Type == name && payloadMatches(event.Payload["data"], expected) {
+			return
+		}
+	}
+
+	message := fmt.Sprintf("expected event %s to be emitted", name)
+	if expected != nil {
+		payload, _ := json.Marshal(expected)
+		message = fmt.Sprintf("expected event %s with payload %s to be emitted", name, payload)
+	}
+	vm.raise(map[string]interface{}{
+		"code":    "EXPECT_FAILED",
+		"message": message,
+	})
+}
+
+// payloadMatches reports whether actual contains every field of expected,
+// comparing nested objects the same way. A nil expectation matches anything.
+func payloadMatches(actual, expected interface{}) bool {
+	if expected == nil {
+		return true
+	}
+	want, ok := expected.(map[string]interface{})
+	if !ok {
+		return valuesEqual(actual, expected)
+	}
+	got, ok := actual.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, value := range want {
+		field, present := got[key]
+		if !present || !payloadMatches(field, value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/peiblow/vvm/compiler"
+)
+
+// Verify statically checks an artifact's bytecode before it is executed:
+// every instruction decodes, operands are in bounds, jumps and calls land
+// on instruction boundaries, every function address is valid, and the
+// stack depth at each instruction is the same on every path reaching it.
+// Artifacts that fail it would otherwise panic or misbehave mid-execution.
+func Verify(artifact *compiler.ContractArtifact) error {
+	code := artifact.Bytecode
+	if len(code) == 0 {
+		return fmt.Errorf("empty bytecode")
+	}
+
+	insts := make(map[int]compiler.Instruction)
+	for addr := 0; addr < len(code); {
+		inst, err := compiler.Decode(code, addr)
+		if err != nil {
+			return err
+		}
+		insts[addr] = inst
+		addr = inst.Next()
+	}
+
+	names := make([]string, 0, len(artifact.Functions))
+	for name := range artifact.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		meta := artifact.Functions[name]
+		if _, ok := insts[meta.Addr]; !ok {
+			return fmt.Errorf("function '%s' starts at %04d, which is not an instruction", name, meta.Addr)
+		}
+		if artifact.FunctionName[meta.Addr] != name {
+			return fmt.Errorf("function '%s' at %04d is missing from the function name table", name, meta.Addr)
+		}
+		if len(meta.Args) != len(meta.ArgMeta) {
+			return fmt.Errorf("function '%s' has %d argument slot(s) but %d argument(s)", name, len(meta.Args), len(meta.ArgMeta))
+		}
+	}
+
+	for addr := 0; addr < len(code); {
+		inst := insts[addr]
+		for i, kind := range inst.Info.Operands {
+			val := inst.Operands[i]
+			switch kind {
+			case compiler.OperandConst:
+				if val >= len(artifact.ConstPool) {
+					return fmt.Errorf("%04d %s: constant %d is out of range (pool has %d)", addr, inst.Info.Name, val, len(artifact.ConstPool))
+				}
+			case compiler.OperandAddr:
+				if _, ok := insts[val]; !ok {
+					return fmt.Errorf("%04d %s: target %04d is not an instruction", addr, inst.Info.Name, val)
+				}
+				if _, ok := artifact.FunctionName[val]; inst.Op == compiler.OP_CALL && !ok {
+					return fmt.Errorf("%04d CALL: target %04d is not a function", addr, val)
+				}
+			}
+		}
+		addr = inst.Next()
+	}
+
+	v := &verifier{artifact: artifact, insts: insts, depth: make(map[int]int)}
+	if err := v.walk(0, false); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := v.walk(artifact.Functions[name].Addr, true); err != nil {
+			return fmt.Errorf("function '%s': %v", name, err)
+		}
+	}
+	return nil
+}
+
+// verifier tracks the stack depth at each reachable instruction, relative
+// to the depth at the entry point being walked.
+type verifier struct {
+	artifact *compiler.ContractArtifact
+	insts    map[int]compiler.Instruction
+	depth    map[int]int
+}
+
+type pending struct {
+	addr, depth int
+}
+
+// walk follows every path from entry. Inside a function, RET must leave
+// exactly the return value on the stack; top-level code ends with HALT.
+func (v *verifier) walk(entry int, inFunction bool) error {
+	work := []pending{{entry, 0}}
+	for len(work) > 0 {
+		p := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		if seen, ok := v.depth[p.addr]; ok {
+			if seen != p.depth {
+				return fmt.Errorf("%04d: stack depth is %d on one path and %d on another", p.addr, seen, p.depth)
+			}
+			continue
+		}
+		v.depth[p.addr] = p.depth
+
+		inst, ok := v.insts[p.addr]
+		if !ok {
+			return fmt.Errorf("execution runs past the end of the code")
+		}
+
+		pops, pushes := v.stackEffect(inst)
+		if p.depth < pops {
+			return fmt.Errorf("%04d %s: needs %d value(s) on the stack, has %d", inst.Addr, inst.Info.Name, pops, p.depth)
+		}
+		after := p.depth - pops + pushes
+
+		switch inst.Op {
+		case compiler.OP_HALT, compiler.OP_ERR:
+			continue
+		case compiler.OP_RET:
+			if !inFunction {
+				return fmt.Errorf("%04d RET: outside a function", inst.Addr)
+			}
+			if p.depth != 1 {
+				return fmt.Errorf("%04d RET: expects only the return value on the stack, has %d value(s)", inst.Addr, p.depth)
+			}
+			continue
+		case compiler.OP_JMP:
+			work = append(work, pending{inst.Operands[0], after})
+			continue
+		case compiler.OP_JMP_IF:
+			work = append(work, pending{inst.Operands[0], after})
+		case compiler.OP_TRY:
+			// raise unwinds the stack to its depth at TRY.
+			work = append(work, pending{inst.Operands[0], after})
+		}
+		work = append(work, pending{inst.Next(), after})
+	}
+	return nil
+}
+
+// stackEffect resolves the operand-dependent stack effects in the table.
+func (v *verifier) stackEffect(inst compiler.Instruction) (pops, pushes int) {
+	pops, pushes = inst.Info.Pops, inst.Info.Pushes
+	switch inst.Op {
+	case compiler.OP_CALL:
+		// The callee leaves its return value in place of the arguments.
+		name := v.artifact.FunctionName[inst.Operands[0]]
+		return len(v.artifact.Functions[name].Args), 1
+	case compiler.OP_HASH:
+		return inst.Operands[0] + 1, pushes
+	case compiler.OP_BUILTIN, compiler.OP_CALL_NATIVE:
+		return inst.Operands[1], pushes
+	}
+	return pops, pushes
+}
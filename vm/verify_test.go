@@ -0,0 +1,154 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/peiblow/vvm/compiler"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		consts  []interface{}
+		wantErr string // "" when the artifact is valid
+	}{
+		{
+			name:   "valid",
+			code:   []byte{compiler.OP_CONST, 0, compiler.OP_POP, compiler.OP_HALT},
+			consts: []interface{}{"a"},
+		},
+		{
+			name:    "empty bytecode",
+			code:    []byte{},
+			wantErr: "empty bytecode",
+		},
+		{
+			name:    "truncated operand",
+			code:    []byte{compiler.OP_PUSH, 1, compiler.OP_JMP, 0},
+			wantErr: "truncated JMP instruction at 0002",
+		},
+		{
+			name:    "unknown opcode",
+			code:    []byte{0xEE, compiler.OP_HALT},
+			wantErr: "unknown opcode 0xEE at 0000",
+		},
+		{
+			name: "jump into the middle of an instruction",
+			code: []byte{
+				compiler.OP_PUSH, 1, // 0000
+				compiler.OP_JMP_IF, 0, 1, // 0002
+				compiler.OP_HALT, // 0005
+			},
+			wantErr: "0002 JMP_IF: target 0001 is not an instruction",
+		},
+		{
+			name:    "const index out of range",
+			code:    []byte{compiler.OP_CONST, 3, compiler.OP_POP, compiler.OP_HALT},
+			consts:  []interface{}{"a"},
+			wantErr: "0000 CONST: constant 3 is out of range (pool has 1)",
+		},
+		{
+			name: "stack mismatch between branches",
+			code: []byte{
+				compiler.OP_PUSH, 1, // 0000
+				compiler.OP_JMP_IF, 0, 7, // 0002
+				compiler.OP_PUSH, 2, // 0005
+				compiler.OP_HALT, // 0007
+			},
+			wantErr: "0007: stack depth is",
+		},
+		{
+			name:    "stack underflow",
+			code:    []byte{compiler.OP_POP, compiler.OP_HALT},
+			wantErr: "0000 POP: needs 1 value(s) on the stack, has 0",
+		},
+		{
+			name:    "runs past the end",
+			code:    []byte{compiler.OP_PUSH, 1, compiler.OP_POP},
+			wantErr: "execution runs past the end of the code",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			artifact := &compiler.ContractArtifact{
+				Bytecode:     tt.code,
+				ConstPool:    tt.consts,
+				FunctionName: map[int]string{},
+			}
+			err := Verify(artifact)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Verify() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyCompiledContract(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{
+			name: "branches, loops and try",
+			src: `contract C {
+  fn ratio(a: UInt, b: UInt): UInt {
+    if (b == 0) {
+      return 0
+    }
+    let total = 0
+    for (x in [1, 2, 3]) {
+      total = total + x
+    }
+    try {
+      return a / b
+    } catch (e) {
+      return total
+    }
+  }
+}`,
+		},
+		{
+			name: "call to a function declared later",
+			src: `contract C {
+  fn a(x: UInt): UInt { return b(x) + 1 }
+  fn b(x: UInt): UInt { return x * 2 }
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			artifact, err := NewRuntime().Build([]byte(tt.src), BuildOptions{})
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			if err := Verify(artifact); err != nil {
+				t.Fatalf("Verify() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestForwardCallReachesCallee(t *testing.T) {
+	src := `contract C {
+  fn a(x: UInt): UInt { return b(x) + 1 }
+  fn b(x: UInt): UInt { return x * 2 }
+}`
+	artifact, err := NewRuntime().Build([]byte(src), BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	result := NewFromArtifact(artifact).RunFunction("a", 3)
+	if !result.Success || result.Value != 7 {
+		t.Fatalf("a(3) = %v (success %v, error %v), want 7", result.Value, result.Success, result.Error)
+	}
+}
@@ -4,14 +4,22 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/peiblow/vvm/compiler"
 )
 
+// Output receives the runtime's log lines and the values contracts print.
+// It defaults to stdout; the CLI points it at stderr so that command output
+// stays machine-readable.
+var Output io.Writer = os.Stdout
+
 type VM struct {
 	compiler  *compiler.Compiler
 	stack     []interface{}
@@ -23,13 +31,33 @@ type VM struct {
 	errors    []error
 	journal   []JournalEvent
 	lastError map[string]interface{}
+	natives   *Natives
+	strict    bool
+
+	timestamp      int64
+	policyVersions map[string]string
+	policiesActive bool
+	policyObjects  map[uintptr]string
+	matchedRules   []string
+
+	explain     bool
+	trace       []TraceStep
+	comparisons []comparison
+
+	checkFailures []map[string]interface{}
+
+	// failingAssertion is set when a require condition jumps to its failure
+	// branch, so the error raised next is known to be a failed assertion.
+	failingAssertion bool
+	assertionErrors  map[uintptr]bool
 }
 
 type JournalEvent struct {
-	Type      string
-	Payload   map[string]interface{}
-	Hash      string
-	Timestamp int64
+	Type           string
+	Payload        map[string]interface{}
+	Hash           string
+	Timestamp      int64
+	PolicyVersions map[string]string `json:",omitempty"`
 }
 
 type TryFrame struct {
@@ -55,6 +83,12 @@ type ExecutionResult struct {
 	Success bool
 	Journal []JournalEvent
 	Error   map[string]interface{}
+	// Value is what the function returned, converted to its declared
+	// return type; Decision is the envelope derived from it (see decide).
+	Value    interface{}
+	Decision *Decision
+	// Trace is the explain trace, recorded only when Explain is on.
+	Trace []TraceStep
 }
 
 func NewFromArtifact(artifact *compiler.ContractArtifact) *VM {
@@ -64,8 +98,15 @@ func NewFromArtifact(artifact *compiler.ContractArtifact) *VM {
 		Functions:    artifact.Functions,
 		FunctionName: artifact.FunctionName,
 		Types:        artifact.Types,
+		Agents:       artifact.Agents,
+		Registries:   artifact.Registries,
+		Policies:     artifact.Policies,
+		TracePoints:  artifact.TracePoints,
+		Symbols:      artifact.Symbols,
+		Lines:        artifact.Lines,
 	}
 	vm := New(cmpl)
+	vm.strict = artifact.Strict
 
 	// Deep copy InitStorage to ensure execution doesn't modify the artifact
 	if artifact.InitStorage != nil {
@@ -113,9 +154,19 @@ func (vm *VM) Run() ExecutionResult {
 
 // RunFunction executes a specific function by name with the given arguments
 func (vm *VM) RunFunction(funcName string, args ...interface{}) ExecutionResult {
+	funcMeta, failed := vm.enterFunction(funcName, args)
+	if failed != nil {
+		return *failed
+	}
+	return vm.finishFunction(funcName, funcMeta, vm.execute())
+}
+
+// enterFunction binds args and points the VM at the start of funcName,
+// ready to execute. It returns a failed result if the call cannot start.
+func (vm *VM) enterFunction(funcName string, args []interface{}) (compiler.FunctionMeta, *ExecutionResult) {
 	funcMeta, exists := vm.compiler.Functions[funcName]
 	if !exists {
-		return ExecutionResult{
+		return funcMeta, &ExecutionResult{
 			Success: false,
 			Journal: vm.journal,
 			Error: map[string]interface{}{
@@ -126,7 +177,7 @@ func (vm *VM) RunFunction(funcName string, args ...interface{}) ExecutionResult
 	}
 
 	if len(args) != len(funcMeta.Args) {
-		return ExecutionResult{
+		return funcMeta, &ExecutionResult{
 			Success: false,
 			Journal: vm.journal,
 			Error: map[string]interface{}{
@@ -136,6 +187,19 @@ func (vm *VM) RunFunction(funcName string, args ...interface{}) ExecutionResult
 		}
 	}
 
+	if !vm.policiesActive {
+		if err := vm.ActivatePolicies(time.Now()); err != nil {
+			return funcMeta, &ExecutionResult{
+				Success: false,
+				Journal: vm.journal,
+				Error: map[string]interface{}{
+					"code":    "NO_ACTIVE_POLICY",
+					"message": err.Error(),
+				},
+			}
+		}
+	}
+
 	for i, arg := range args {
 		slot := funcMeta.Args[i]
 		vm.storage[slot] = arg
@@ -145,161 +209,258 @@ func (vm *VM) RunFunction(funcName string, args ...interface{}) ExecutionResult
 	vm.callStack = append(vm.callStack, haltAddr)
 
 	vm.ip = funcMeta.Addr
+	vm.indexPolicyObjects()
+	return funcMeta, nil
+}
 
-	vmResult := vm.execute()
-
+// finishFunction turns the raw result of executing funcName into the
+// call's result: failed checks, the typed return value and the decision.
+func (vm *VM) finishFunction(funcName string, funcMeta compiler.FunctionMeta, vmResult ExecutionResult) ExecutionResult {
 	if len(vm.errors) > 0 {
-		return ExecutionResult{
+		vmResult = ExecutionResult{
 			Success: false,
 			Journal: vm.journal,
 			Error:   vm.lastError,
 		}
-	} else {
-		return vmResult
 	}
-}
-
-func (vm *VM) execute() (result ExecutionResult) {
-	defer func() {
-		if r := recover(); r != nil {
-			result = ExecutionResult{
+	if len(vm.checkFailures) > 0 {
+		vmResult.Success = false
+		vmResult.Error = vm.checkError(vmResult.Error)
+	} else if vmResult.Success {
+		var returned interface{}
+		if len(vm.stack) > 0 {
+			returned = vm.stack[len(vm.stack)-1]
+		}
+		value, err := vm.checkReturn(returned, funcMeta.ReturnType)
+		if err != nil {
+			return ExecutionResult{
 				Success: false,
 				Journal: vm.journal,
 				Error: map[string]interface{}{
-					"code":    "RUNTIME_PANIC",
-					"message": fmt.Sprintf("%v", r),
+					"code":    "RETURN_TYPE_MISMATCH",
+					"message": fmt.Sprintf("%s: %v", funcName, err),
 				},
 			}
 		}
-	}()
+		vmResult.Value = value
+	}
 
-	code := vm.compiler.Code
+	vmResult.Decision = decide(vmResult, vm.matchedRules, vm.isAssertionError)
+	vmResult.Trace = vm.trace
+	return vmResult
+}
+
+func (vm *VM) execute() (result ExecutionResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = vm.panicResult(r)
+		}
+	}()
 
 	for {
-		op := code[vm.ip]
-		vm.ip++
+		if result := vm.step(); result != nil {
+			return *result
+		}
+	}
+}
 
-		if len(vm.errors) > 0 {
-			fmt.Printf("Execution halted due to errors: %v\n", vm.errors)
-			return ExecutionResult{
-				Success: false,
-				Journal: vm.journal,
-				Error:   vm.lastError,
-			}
+// debugStep executes one instruction for the debugger, recovering a panic
+// into a RUNTIME_PANIC result the way execute does for a whole run.
+func (vm *VM) debugStep() (result *ExecutionResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked := vm.panicResult(r)
+			result = &panicked
 		}
+	}()
+	return vm.step()
+}
 
-		switch op {
-		case compiler.OP_CONST:
-			vm.execConst(code)
-		case compiler.OP_PUSH:
-			vm.execPush(code)
-		case compiler.OP_TRUE:
-			vm.execTrue()
-		case compiler.OP_FALSE:
-			vm.execFalse()
-		case compiler.OP_ADD:
-			vm.execAdd()
-		case compiler.OP_SUB:
-			vm.execSub()
-		case compiler.OP_MUL:
-			vm.execMul()
-		case compiler.OP_DIV:
-			vm.execDiv()
-		case compiler.OP_GT:
-			vm.execGt()
-		case compiler.OP_GT_EQ:
-			vm.execGtEq()
-		case compiler.OP_LT:
-			vm.execLt()
-		case compiler.OP_LT_EQ:
-			vm.execLtEq()
-		case compiler.OP_EQ:
-			vm.execEq()
-		case compiler.OP_DIFF:
-			vm.execDiff()
-		case compiler.OP_SWAP:
-			vm.execSwap()
-		case compiler.OP_AND:
-			vm.execAnd()
-		case compiler.OP_OR:
-			vm.execOr()
-		case compiler.OP_NOT:
-			vm.execNot()
-		case compiler.OP_DUP:
-			vm.execDup()
-		case compiler.OP_PRINT:
-			vm.execPrint()
-		case compiler.OP_NOP:
-			// No operation
-		case compiler.OP_JMP:
-			vm.execJmp(code)
-		case compiler.OP_JMP_IF:
-			vm.execJmpIf(code)
-		case compiler.OP_CALL:
-			vm.execCall(code)
-		case compiler.OP_RET:
-			vm.execRet()
-		case compiler.OP_ACCESS:
-			vm.execAccess()
-		case compiler.OP_GET_PROPERTY:
-			vm.execGetProperty()
-		case compiler.OP_SET_PROPERTY:
-			vm.execSetProperty()
-		case compiler.OP_NULL:
-			vm.push(nil)
-		case compiler.OP_LENGTH:
-			vm.execLength()
-		case compiler.OP_STORE:
-			vm.execStore(code)
-		case compiler.OP_SLOAD:
-			vm.execSload(code)
-		case compiler.OP_AGENT_DECLARE:
-			vm.execAgentDeclare()
-		case compiler.OP_AGENT_GET:
-			vm.execAgentGet(code)
-		case compiler.OP_AGENT_VALIDATE:
-			vm.execAgentValidate()
-		case compiler.OP_POLICY_DECLARE:
-			vm.execPolicyDeclare(code)
-		case compiler.OP_TYPE_DECLARE:
-			vm.execTypeDeclare(code)
-		case compiler.OP_REQUIRE:
-			vm.execRequire()
-		case compiler.OP_EMIT:
-			vm.execEmitEvent()
-		case compiler.OP_GET_ENV:
-			vm.execGetEnv()
-		case compiler.OP_NONCE:
-			vm.execNonce()
-		case compiler.OP_HASH:
-			vm.execHash(code)
-		case compiler.OP_TRY:
-			vm.execTry(code)
-		case compiler.OP_END_TRY:
-			vm.execEndTry()
-		case compiler.OP_ERR:
-			vm.execErr()
-		case compiler.OP_DELETE:
-			vm.execDelete(code)
-		case compiler.OP_PUSH_OBJECT:
-			vm.push(make(map[string]interface{}))
-		case compiler.OP_HALT:
-			return ExecutionResult{
-				Success: true,
-				Journal: vm.journal,
-				Error:   vm.lastError,
-			}
-		default:
-			return ExecutionResult{
-				Success: false,
-				Journal: vm.journal,
-				Error: map[string]interface{}{
-					"code":    "UNKNOWN_OPCODE",
-					"message": fmt.Sprintf("unknown opcode: 0x%02X", op),
-				},
-			}
+func (vm *VM) panicResult(r interface{}) ExecutionResult {
+	return ExecutionResult{
+		Success: false,
+		Journal: vm.journal,
+		Error: map[string]interface{}{
+			"code":    "RUNTIME_PANIC",
+			"message": fmt.Sprintf("%v", r),
+		},
+	}
+}
+
+// step executes the instruction at ip and returns the outcome once
+// execution has finished, nil while it goes on. It runs once per
+// instruction, so it neither defers nor allocates: its callers recover
+// panics.
+func (vm *VM) step() *ExecutionResult {
+	if len(vm.errors) > 0 {
+		return &ExecutionResult{
+			Success: false,
+			Journal: vm.journal,
+			Error:   vm.lastError,
+		}
+	}
+
+	code := vm.compiler.Code
+	addr := vm.ip
+	op := code[addr]
+	info := &compiler.OpcodeTable[op]
+	if info.Name == "" {
+		return &ExecutionResult{
+			Success: false,
+			Journal: vm.journal,
+			Error: map[string]interface{}{
+				"code":    "UNKNOWN_OPCODE",
+				"message": fmt.Sprintf("unknown opcode: 0x%02X", op),
+			},
+		}
+	}
+	if vm.explain && vm.compiler.IsStatementStart(addr) {
+		vm.startStatement()
+	}
+	var args [compiler.MaxOperands]int
+	next, ok := info.ReadOperands(code, addr, &args)
+	if !ok {
+		return &ExecutionResult{
+			Success: false,
+			Journal: vm.journal,
+			Error: map[string]interface{}{
+				"code":    "INVALID_BYTECODE",
+				"message": fmt.Sprintf("truncated %s instruction at %04d", info.Name, addr),
+			},
+		}
+	}
+	vm.ip = next
+
+	switch op {
+	case compiler.OP_CONST:
+		vm.execConst(args[0])
+	case compiler.OP_PUSH:
+		vm.push(args[0])
+	case compiler.OP_TRUE:
+		vm.execTrue()
+	case compiler.OP_FALSE:
+		vm.execFalse()
+	case compiler.OP_ADD:
+		vm.execAdd()
+	case compiler.OP_SUB:
+		vm.execSub()
+	case compiler.OP_MUL:
+		vm.execMul()
+	case compiler.OP_DIV:
+		vm.execDiv()
+	case compiler.OP_MOD:
+		vm.execMod()
+	case compiler.OP_GT:
+		vm.execGt()
+	case compiler.OP_GT_EQ:
+		vm.execGtEq()
+	case compiler.OP_LT:
+		vm.execLt()
+	case compiler.OP_LT_EQ:
+		vm.execLtEq()
+	case compiler.OP_EQ:
+		vm.execEq()
+	case compiler.OP_DIFF:
+		vm.execDiff()
+	case compiler.OP_SWAP:
+		vm.execSwap()
+	case compiler.OP_AND:
+		vm.execAnd()
+	case compiler.OP_OR:
+		vm.execOr()
+	case compiler.OP_NOT:
+		vm.execNot()
+	case compiler.OP_DUP:
+		vm.execDup()
+	case compiler.OP_PRINT:
+		vm.execPrint()
+	case compiler.OP_NOP:
+		// No operation
+	case compiler.OP_JMP:
+		vm.ip = args[0]
+	case compiler.OP_JMP_IF:
+		vm.execJmpIf(addr, args[0])
+	case compiler.OP_CALL:
+		vm.execCall(args[0])
+	case compiler.OP_RET:
+		vm.execRet()
+	case compiler.OP_POP:
+		vm.pop("OP_POP")
+	case compiler.OP_BUILTIN:
+		vm.execBuiltin(args[0], args[1])
+	case compiler.OP_CALL_NATIVE:
+		vm.execCallNative(args[0], args[1])
+	case compiler.OP_ACCESS:
+		vm.execAccess()
+	case compiler.OP_GET_PROPERTY:
+		vm.execGetProperty()
+	case compiler.OP_SET_PROPERTY:
+		vm.execSetProperty()
+	case compiler.OP_NULL:
+		vm.push(nil)
+	case compiler.OP_LENGTH:
+		vm.execLength()
+	case compiler.OP_ITER_KEYS:
+		vm.execIterKeys()
+	case compiler.OP_ITER_ITEMS:
+		vm.execIterItems()
+	case compiler.OP_STORE:
+		vm.execStore(args[0])
+	case compiler.OP_SLOAD:
+		vm.execSload(args[0])
+	case compiler.OP_AGENT_DECLARE:
+		vm.execAgentDeclare(args[0])
+	case compiler.OP_REGISTRY_DECLARE:
+		vm.execRegistryDeclare(args[0], args[1])
+	case compiler.OP_REGISTRY_GET:
+		vm.execRegistryGet(args[0])
+	case compiler.OP_AGENT_VALIDATE:
+		vm.execAgentValidate()
+	case compiler.OP_POLICY_DECLARE:
+		vm.execPolicyDeclare()
+	case compiler.OP_TYPE_DECLARE:
+		vm.execTypeDeclare()
+	case compiler.OP_REQUIRE:
+		vm.execRequire()
+	case compiler.OP_EMIT:
+		vm.execEmitEvent()
+	case compiler.OP_GET_ENV:
+		vm.execGetEnv()
+	case compiler.OP_NONCE:
+		vm.execNonce()
+	case compiler.OP_HASH:
+		vm.execHash(args[0])
+	case compiler.OP_TRY:
+		vm.execTry(args[0], args[1])
+	case compiler.OP_END_TRY:
+		vm.execEndTry()
+	case compiler.OP_ERR:
+		vm.execErr()
+	case compiler.OP_CHECK:
+		vm.execCheck()
+	case compiler.OP_EXPECT_EMIT:
+		vm.execExpectEmit()
+	case compiler.OP_DELETE:
+		delete(vm.storage, args[0])
+	case compiler.OP_PUSH_OBJECT:
+		vm.push(make(map[string]interface{}))
+	case compiler.OP_HALT:
+		return &ExecutionResult{
+			Success: true,
+			Journal: vm.journal,
+			Error:   vm.lastError,
+		}
+	default:
+		return &ExecutionResult{
+			Success: false,
+			Journal: vm.journal,
+			Error: map[string]interface{}{
+				"code":    "UNKNOWN_OPCODE",
+				"message": fmt.Sprintf("unknown opcode: 0x%02X", op),
+			},
 		}
 	}
+	return nil
 }
 
 // Stack operations
@@ -319,25 +480,17 @@ func (vm *VM) pop(context string) interface{} {
 
 // Instruction implementations
 
-func (vm *VM) execConst(code []byte) {
-	idx := int(code[vm.ip])
-	vm.ip++
+func (vm *VM) execConst(idx int) {
 	val := vm.compiler.ConstPool[idx]
 	vm.push(val)
 }
 
-func (vm *VM) execPush(code []byte) {
-	val := int(code[vm.ip])
-	vm.ip++
-	vm.push(val)
-}
-
 func (vm *VM) execTrue() {
 	vm.push(true)
 }
 
 func (vm *VM) execFalse() {
-	vm.push(true)
+	vm.push(false)
 }
 
 func toBool(v interface{}) bool {
@@ -346,6 +499,8 @@ func toBool(v interface{}) bool {
 		return x
 	case int:
 		return x != 0
+	case int64:
+		return x != 0
 	case float64:
 		return x != 0
 	case string:
@@ -357,8 +512,8 @@ func toBool(v interface{}) bool {
 	}
 }
 
-// Booleans are represented as int 0/1 on the stack (matching execEq's convention)
-// so that OP_JMP_IF's `cond == 0` literal comparison works correctly.
+// Comparisons push booleans as int 0/1 (matching execEq's convention);
+// OP_JMP_IF accepts either form through toBool.
 func boolInt(b bool) int {
 	if b {
 		return 1
@@ -391,13 +546,14 @@ func (vm *VM) execAdd() {
 	a := vm.pop("OP_ADD")
 	b := vm.pop("OP_ADD")
 
+	if isNumeric(a) && isNumeric(b) {
+		vm.arith("+", a, b)
+		return
+	}
+
 	switch av := a.(type) {
 	case int:
 		switch bv := b.(type) {
-		case int:
-			vm.push(av + bv)
-		case float64:
-			vm.push(float64(av) + bv)
 		case string:
 			vm.push(strconv.Itoa(av) + bv)
 		default:
@@ -405,10 +561,6 @@ func (vm *VM) execAdd() {
 		}
 	case float64:
 		switch bv := b.(type) {
-		case float64:
-			vm.push(av + bv)
-		case int:
-			vm.push(av + float64(bv))
 		case string:
 			vm.push(strconv.FormatFloat(av, 'f', -1, 64) + bv)
 		default:
@@ -423,7 +575,7 @@ func (vm *VM) execAdd() {
 		case string:
 			vm.push(av + bv)
 		default:
-			fmt.Println(reflect.TypeOf(bv))
+			fmt.Fprintln(Output, reflect.TypeOf(bv))
 			panic("[STR] unsupported ADD type")
 		}
 	default:
@@ -432,62 +584,51 @@ func (vm *VM) execAdd() {
 }
 
 func (vm *VM) execSub() {
-	b := asNumber(vm.pop("OP_SUB"))
-	a := asNumber(vm.pop("OP_SUB"))
-	vm.push(a - b)
+	b := vm.pop("OP_SUB")
+	a := vm.pop("OP_SUB")
+	vm.arith("-", a, b)
 }
 
 func (vm *VM) execMul() {
-	b := asNumber(vm.pop("OP_MUL"))
-	a := asNumber(vm.pop("OP_MUL"))
-	vm.push(a * b)
+	b := vm.pop("OP_MUL")
+	a := vm.pop("OP_MUL")
+	vm.arith("*", a, b)
 }
 
 func (vm *VM) execDiv() {
-	b := asNumber(vm.pop("OP_DIV"))
-	a := asNumber(vm.pop("OP_DIV"))
-	vm.push(a / b)
+	b := vm.pop("OP_DIV")
+	a := vm.pop("OP_DIV")
+	vm.arith("/", a, b)
+}
+
+func (vm *VM) execMod() {
+	b := vm.pop("OP_MOD")
+	a := vm.pop("OP_MOD")
+	vm.arith("%", a, b)
 }
 
 func (vm *VM) execGt() {
 	b := asNumber(vm.pop("OP_GT"))
 	a := asNumber(vm.pop("OP_GT"))
-	if a > b {
-		vm.push(1)
-	} else {
-		vm.push(0)
-	}
+	vm.pushComparison(">", a, b, a > b)
 }
 
 func (vm *VM) execGtEq() {
 	b := asNumber(vm.pop("OP_GT_EQ"))
 	a := asNumber(vm.pop("OP_GT_EQ"))
-
-	if a >= b {
-		vm.push(1)
-	} else {
-		vm.push(0)
-	}
+	vm.pushComparison(">=", a, b, a >= b)
 }
 
 func (vm *VM) execLt() {
 	b := asNumber(vm.pop("OP_LT"))
 	a := asNumber(vm.pop("OP_LT"))
-	if a < b {
-		vm.push(1)
-	} else {
-		vm.push(0)
-	}
+	vm.pushComparison("<", a, b, a < b)
 }
 
 func (vm *VM) execLtEq() {
 	b := asNumber(vm.pop("OP_LT_EQ"))
 	a := asNumber(vm.pop("OP_LT_EQ"))
-	if a <= b {
-		vm.push(1)
-	} else {
-		vm.push(0)
-	}
+	vm.pushComparison("<=", a, b, a <= b)
 }
 
 func asNumber(v interface{}) float64 {
@@ -526,21 +667,20 @@ func valuesEqual(a, b interface{}) bool {
 func (vm *VM) execEq() {
 	b := vm.pop("OP_EQ")
 	a := vm.pop("OP_EQ")
-	if valuesEqual(a, b) {
-		vm.push(1)
-	} else {
-		vm.push(0)
-	}
+	vm.pushComparison("==", a, b, valuesEqual(a, b))
 }
 
 func (vm *VM) execDiff() {
 	b := vm.pop("OP_DIFF")
 	a := vm.pop("OP_DIFF")
-	if !valuesEqual(a, b) {
-		vm.push(1)
-	} else {
-		vm.push(0)
-	}
+	vm.pushComparison("!=", a, b, !valuesEqual(a, b))
+}
+
+// pushComparison pushes a comparison result as 0 or 1, noting the operands
+// for the explain trace.
+func (vm *VM) pushComparison(op string, a, b interface{}, result bool) {
+	vm.noteComparison(op, a, b, result)
+	vm.push(boolInt(result))
 }
 
 func (vm *VM) execSwap() {
@@ -560,39 +700,28 @@ func (vm *VM) execDup() {
 
 func (vm *VM) execPrint() {
 	if len(vm.stack) == 0 {
-		fmt.Println("Warning: OP_PRINT with empty stack, ignoring")
+		fmt.Fprintln(Output, "Warning: OP_PRINT with empty stack, ignoring")
 		return
 	}
 
 	val := vm.pop("OP_PRINT")
-	fmt.Println(val)
+	fmt.Fprintln(Output, val)
 }
 
-func (vm *VM) execJmp(code []byte) {
-	high := int(code[vm.ip])
-	low := int(code[vm.ip+1])
-	destiny := (high << 8) | low
-	vm.ip = destiny
-}
-
-func (vm *VM) execJmpIf(code []byte) {
-	high := int(code[vm.ip])
-	low := int(code[vm.ip+1])
-	destiny := (high << 8) | low
-	vm.ip += 2
+// execJmpIf jumps to destiny when the condition is false. at is the
+// address of the JMP_IF, which keys its trace point.
+func (vm *VM) execJmpIf(at, destiny int) {
 	cond := vm.pop("OP_JMP_IF")
-	if cond == 0 {
+	vm.traceCondition(at, toBool(cond))
+	if !toBool(cond) {
+		if vm.compiler.TracePoints[at].Kind == compiler.TraceRequire {
+			vm.failingAssertion = true
+		}
 		vm.ip = destiny
 	}
 }
 
-func (vm *VM) execCall(code []byte) {
-	// Read 2-byte address (high byte, low byte)
-	high := int(code[vm.ip])
-	low := int(code[vm.ip+1])
-	destiny := (high << 8) | low
-	vm.ip += 2
-
+func (vm *VM) execCall(destiny int) {
 	funcArgs := vm.compiler.GetFuncArgs(destiny)
 	for i := len(funcArgs) - 1; i >= 0; i-- {
 		val := vm.pop("OP_CALL")
@@ -646,6 +775,7 @@ func (vm *VM) execAccess() {
 		if !exists {
 			panic(fmt.Sprintf("Property '%s' not found in object", prop))
 		}
+		vm.recordRuleRead(obj, prop)
 		vm.push(val)
 	default:
 		panic(fmt.Sprintf("OP_ACCESS: unsupported target type %T", target))
@@ -666,6 +796,7 @@ func (vm *VM) execGetProperty() {
 		if !exists {
 			panic(fmt.Sprintf("Property '%s' not found in object", prop))
 		}
+		vm.recordRuleRead(obj, prop)
 		vm.push(val)
 	default:
 		panic(fmt.Sprintf("OP_GET_PROPERTY: unsupported target type %T", target))
@@ -704,16 +835,60 @@ func (vm *VM) execLength() {
 	}
 }
 
-func (vm *VM) execStore(code []byte) {
-	key := int(code[vm.ip])
-	vm.ip++
+// sortedKeys returns the keys of obj in lexical order so that iteration over
+// objects does not depend on Go's randomized map ordering.
+func sortedKeys(obj map[string]interface{}) []interface{} {
+	names := make([]string, 0, len(obj))
+	for k := range obj {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	keys := make([]interface{}, len(names))
+	for i, k := range names {
+		keys[i] = k
+	}
+	return keys
+}
+
+func (vm *VM) execIterKeys() {
+	coll := vm.pop("OP_ITER_KEYS")
+
+	switch v := coll.(type) {
+	case []interface{}:
+		keys := make([]interface{}, len(v))
+		for i := range v {
+			keys[i] = i
+		}
+		vm.push(keys)
+	case map[string]interface{}:
+		vm.push(sortedKeys(v))
+	default:
+		panic(fmt.Sprintf("OP_ITER_KEYS: cannot iterate over %T", coll))
+	}
+}
+
+func (vm *VM) execIterItems() {
+	coll := vm.pop("OP_ITER_ITEMS")
+
+	switch v := coll.(type) {
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		copy(items, v)
+		vm.push(items)
+	case map[string]interface{}:
+		vm.push(sortedKeys(v))
+	default:
+		panic(fmt.Sprintf("OP_ITER_ITEMS: cannot iterate over %T", coll))
+	}
+}
+
+func (vm *VM) execStore(key int) {
 	val := vm.pop("OP_STORE")
 	vm.storage[key] = val
 }
 
-func (vm *VM) execSload(code []byte) {
-	key := int(code[vm.ip])
-	vm.ip++
+func (vm *VM) execSload(key int) {
 	val, ok := vm.storage[key]
 	if !ok {
 		val = 0
@@ -721,118 +896,109 @@ func (vm *VM) execSload(code []byte) {
 	vm.push(val)
 }
 
-func (vm *VM) execAgentDeclare() {
-	purpose := vm.pop("OP_AGENT_DECLARE")
-	vm.ip++
+// agentRequiredFields must be present in every agent declaration. The
+// analyzer rejects sources without them; this guards hand-built bytecode.
+var agentRequiredFields = []string{"hash", "version", "owner"}
 
-	owner := vm.pop("OP_AGENT_DECLARE")
-	vm.ip++
+// execAgentDeclare pops the object of declared agent fields and pushes the
+// agent record (the fields plus the agent's name).
+func (vm *VM) execAgentDeclare(nameIdx int) {
+	name := extractValue(vm.compiler.ConstPool[nameIdx])
 
-	version := vm.pop("OP_AGENT_DECLARE")
-	vm.ip++
+	fields, ok := vm.pop("OP_AGENT_DECLARE").(map[string]interface{})
+	if !ok {
+		panic(fmt.Sprintf("OP_AGENT_DECLARE expected agent fields object for '%s'", name))
+	}
+	for _, key := range agentRequiredFields {
+		if _, ok := fields[key]; !ok {
+			panic(fmt.Sprintf("agent '%s' is missing required field '%s'", name, key))
+		}
+	}
 
-	name := vm.pop("OP_AGENT_DECLARE")
-	vm.ip++
+	fields["name"] = name
+	fmt.Fprintf(Output, "Agent '%s' declared with hash: %v\n", name, fields["hash"])
+	vm.push(fields)
+}
 
-	// Generate hash from registry data
-	hashInput := fmt.Sprintf("%v:%v:%v:%v:%v", name, version, owner, purpose, time.Now().UnixMilli())
-	hashBytes := sha256.Sum256([]byte(hashInput))
-	hash := "0x" + hex.EncodeToString(hashBytes[:])
+// execRegistryDeclare pops the object of declared registry fields and pushes
+// the registry entry (the fields plus its name and kind).
+func (vm *VM) execRegistryDeclare(nameIdx, kindIdx int) {
+	name := extractValue(vm.compiler.ConstPool[nameIdx])
+	kind := extractValue(vm.compiler.ConstPool[kindIdx])
 
-	fmt.Printf("Agent '%v' created with hash: %s\n", name, hash)
-
-	key := len(vm.storage) + 1
-	vm.storage[key] = map[string]interface{}{
-		"hash":    hash,
-		"name":    name,
-		"version": version,
-		"owner":   owner,
-		"purpose": purpose,
-	}
-	fmt.Println("Agent stored at key:", vm.storage)
-}
-
-func (vm *VM) execAgentGet(code []byte) {
-	identifierIdx := int(code[vm.ip])
-	vm.ip++
-
-	// Pop the identifier from stack
-	identifier := vm.pop("OP_REGISTRY_GET")
-	identifierStr := extractValue(identifier)
-
-	// Find the registry with the same name
-	var registry map[string]interface{}
-	var registryFound bool
-	for _, val := range vm.storage {
-		if reg, ok := val.(map[string]interface{}); ok {
-			if regName, exists := reg["name"]; exists {
-				regNameStr := extractValue(regName)
-				if regNameStr == identifierStr {
-					registry = reg
-					registryFound = true
-					break
-				}
-			}
-		}
+	fields, ok := vm.pop("OP_REGISTRY_DECLARE").(map[string]interface{})
+	if !ok {
+		panic(fmt.Sprintf("OP_REGISTRY_DECLARE expected registry fields object for '%s'", name))
 	}
 
-	if !registryFound {
-		panic(fmt.Sprintf("Registry '%v' not found (identifier: %d)", identifierStr, identifierIdx))
+	fields["name"] = name
+	fields["kind"] = kind
+	fmt.Fprintf(Output, "Registry %s '%s' declared (version: %v)\n", kind, name, extractValue(fields["version"]))
+	vm.push(fields)
+}
+
+// execRegistryGet pushes the registry entry named by its operand.
+func (vm *VM) execRegistryGet(nameIdx int) {
+	name := extractValue(vm.compiler.ConstPool[nameIdx])
+
+	slot, declared := vm.compiler.Registries[name]
+	entry, stored := vm.storage[slot].(map[string]interface{})
+	if !declared || !stored {
+		vm.raise(map[string]interface{}{
+			"code":    "REGISTRY_NOT_FOUND",
+			"message": fmt.Sprintf("registry entry '%s' not found", name),
+		})
+		return
 	}
 
-	vm.push(registry)
+	vm.push(entry)
 }
 
+// execAgentValidate pops a registry entry and an agent record, checks the
+// agent's claims against the entry and pushes the agent record back.
 func (vm *VM) execAgentValidate() {
-	agentOwner := vm.pop("AGENT_VALIDATE")
-	agentVersion := vm.pop("AGENT_VALIDATE")
 	registry := vm.pop("AGENT_VALIDATE").(map[string]interface{})
+	agent := vm.pop("AGENT_VALIDATE").(map[string]interface{})
 
-	agentOwnerStr := extractValue(agentOwner)
-	agentVersionStr := extractValue(agentVersion)
-	agentNameStr := extractValue(registry["name"])
+	agentName := extractValue(agent["name"])
+	registryName := extractValue(registry["name"])
 
-	// Validate version
-	registryVersion := extractValue(registry["version"])
-	if registryVersion != agentVersionStr {
-		panic(fmt.Sprintf("Agent validation failed: Version not found for '%v'\n  Registry version: %s\n  Agent version: %s", agentNameStr, registryVersion, agentVersionStr))
+	claims := []string{"version", "owner"}
+	if _, pinned := registry["hash"]; pinned {
+		claims = append(claims, "hash")
 	}
-
-	// Validate owner
-	registryOwner := extractValue(registry["owner"])
-	if registryOwner != agentOwnerStr {
-		panic(fmt.Sprintf("Agent validation failed: Owner mismatch for '%v'\n  Expected: %s\n  Got: %s", agentNameStr, registryOwner, agentOwnerStr))
+	for _, field := range claims {
+		expected := extractValue(registry[field])
+		got := extractValue(agent[field])
+		if expected != got {
+			vm.raise(map[string]interface{}{
+				"code": "AGENT_VALIDATION_FAILED",
+				"message": fmt.Sprintf("agent '%s': %s mismatch with registry '%s' (registry: %s, agent: %s)",
+					agentName, field, registryName, expected, got),
+			})
+			return
+		}
 	}
 
-	agentHashStr := extractValue(registry["hash"])
-
-	fmt.Printf("Agent '%v' validated successfully (hash: %s..., owner: %s, version: %v)\n", agentNameStr, agentHashStr[:18], agentOwnerStr, agentVersionStr)
-	agentData := map[string]interface{}{
-		"name":    agentNameStr,
-		"hash":    agentHashStr,
-		"version": agentVersionStr,
-		"owner":   agentOwnerStr,
-	}
-	vm.push(agentData)
+	agent["registry"] = registryName
+	fmt.Fprintf(Output, "Agent '%s' validated against registry '%s' (owner: %s, version: %s)\n",
+		agentName, registryName, extractValue(agent["owner"]), extractValue(agent["version"]))
+	vm.push(agent)
 }
 
-func (vm *VM) execPolicyDeclare(code []byte) {
-	vm.ip++
-
+func (vm *VM) execPolicyDeclare() {
 	policyObj := vm.pop("OP_POLICY_DECLARE")
 	vm.pop("OP_POLICY_DECLARE")
 	vm.push(policyObj)
 }
 
-func (vm *VM) execTypeDeclare(code []byte) {
-	vm.ip++
+func (vm *VM) execTypeDeclare() {
 	typeObj := vm.pop("OP_TYPE_DECLARE")
 	vm.pop("OP_TYPE_DECLARE")
 	vm.push(typeObj)
 }
 
 func (vm *VM) execGetEnv() {
-	vm.ip++
 	variableName := vm.pop("OP_GET_ENV")
 	variableNameStr := extractValue(variableName)
 
@@ -841,7 +1007,7 @@ func (vm *VM) execGetEnv() {
 		panic(fmt.Sprintf("Environment variable '%s' not found", variableNameStr))
 	}
 
-	fmt.Printf("Environment variable '%s' accessed with value: %s\n", variableNameStr, value)
+	fmt.Fprintf(Output, "Environment variable '%s' accessed with value: %s\n", variableNameStr, value)
 	vm.push(value)
 }
 
@@ -858,13 +1024,11 @@ func (vm *VM) execNonce() {
 	}
 
 	nonceHex := "0x" + hex.EncodeToString(nonceBytes)
-	fmt.Printf("Generated nonce of size %d: %s\n", size, nonceHex)
+	fmt.Fprintf(Output, "Generated nonce of size %d: %s\n", size, nonceHex)
 	vm.push(nonceHex)
 }
 
-func (vm *VM) execHash(code []byte) {
-	count := int(code[vm.ip])
-	vm.ip++
+func (vm *VM) execHash(count int) {
 
 	parts := make([]string, count)
 	for i := count - 1; i >= 0; i-- {
@@ -890,17 +1054,11 @@ func (vm *VM) execHash(code []byte) {
 	}
 
 	hashHex := "0x" + hex.EncodeToString(hashBytes)
-	fmt.Printf("Hashed data using %s: %s\n", hashTypeStr, hashHex)
+	fmt.Fprintf(Output, "Hashed data using %s: %s\n", hashTypeStr, hashHex)
 	vm.push(hashHex)
 }
 
-func (vm *VM) execTry(code []byte) {
-	high := int(code[vm.ip])
-	low := int(code[vm.ip+1])
-	slot := int(code[vm.ip+2])
-	vm.ip += 3
-	handler := (high << 8) | low
-
+func (vm *VM) execTry(handler, slot int) {
 	vm.tryStack = append(vm.tryStack, TryFrame{
 		handlerAddr: handler,
 		callDepth:   len(vm.callStack),
@@ -917,7 +1075,6 @@ func (vm *VM) execEndTry() {
 }
 
 func (vm *VM) execEmitEvent() {
-	vm.ip++
 	eventPayload := vm.pop("OP_EMIT_EVENT")
 	eventType := vm.pop("OP_EMIT_EVENT")
 
@@ -926,13 +1083,15 @@ func (vm *VM) execEmitEvent() {
 	hash := "0x" + hex.EncodeToString(hashBytes[:])
 
 	journalEvent := JournalEvent{
-		Type:    extractValue(eventType),
-		Payload: map[string]interface{}{"data": eventPayload},
-		Hash:    hash,
+		Type:           extractValue(eventType),
+		Payload:        map[string]interface{}{"data": eventPayload},
+		Hash:           hash,
+		Timestamp:      vm.timestamp,
+		PolicyVersions: vm.policyVersions,
 	}
 
 	vm.journal = append(vm.journal, journalEvent)
-	fmt.Printf("Event emitted: Type=%s, Hash=%s\n", journalEvent.Type, journalEvent.Hash)
+	fmt.Fprintf(Output, "Event emitted: Type=%s, Hash=%s\n", journalEvent.Type, journalEvent.Hash)
 }
 
 // extractValue extracts the actual value from AST expressions or returns string representation
@@ -958,12 +1117,6 @@ func extractValue(v interface{}) string {
 	}
 }
 
-func (vm *VM) execDelete(code []byte) {
-	vm.ip++
-	key := int(code[vm.ip])
-	delete(vm.storage, key)
-}
-
 func (vm *VM) execRequire() {
 	condition := vm.pop("OP_REQUIRE")
 
@@ -979,6 +1132,38 @@ func (vm *VM) execRequire() {
 	}
 }
 
+// execCheck records a failed check and lets execution continue.
+func (vm *VM) execCheck() {
+	errMap, ok := vm.pop("OP_CHECK").(map[string]interface{})
+	if !ok {
+		errMap = map[string]interface{}{"code": "CHECK_FAILED", "message": "check failed"}
+	}
+	vm.checkFailures = append(vm.checkFailures, errMap)
+	vm.markAssertionError(errMap)
+}
+
+// checkError reports every failed check. If the call also aborted with an
+// error, that error is kept and listed after the checks.
+func (vm *VM) checkError(abort map[string]interface{}) map[string]interface{} {
+	failures := make([]interface{}, 0, len(vm.checkFailures)+1)
+	messages := make([]string, 0, len(vm.checkFailures)+1)
+	for _, f := range vm.checkFailures {
+		failures = append(failures, f)
+		messages = append(messages, fmt.Sprintf("%v", f["message"]))
+	}
+
+	errMap := map[string]interface{}{
+		"code":     "CHECK_FAILED",
+		"message":  fmt.Sprintf("%d check(s) failed: %s", len(vm.checkFailures), strings.Join(messages, "; ")),
+		"failures": failures,
+	}
+	if abort != nil {
+		errMap = deepCopy(abort).(map[string]interface{})
+		errMap["failures"] = append(failures, abort)
+	}
+	return errMap
+}
+
 func (vm *VM) execErr() {
 	raw := vm.pop("OP_ERR")
 
@@ -998,13 +1183,30 @@ func (vm *VM) execErr() {
 		}
 	}
 
+	vm.raise(errMap)
+}
+
+// raise reports errMap as the current error. If a try block is active the
+// VM unwinds to its handler, discarding any call frames and stack values
+// pushed since OP_TRY, and stores the error in the catch slot; otherwise
+// execution aborts at the next instruction. A handled error is no longer
+// the call's error.
+func (vm *VM) raise(errMap map[string]interface{}) {
 	vm.lastError = errMap
+	if vm.failingAssertion {
+		vm.failingAssertion = false
+		vm.markAssertionError(errMap)
+	}
 
 	if len(vm.tryStack) > 0 {
+		vm.lastError = nil
 		h := vm.tryStack[len(vm.tryStack)-1]
 		vm.tryStack = vm.tryStack[:len(vm.tryStack)-1]
 
-		if len(vm.callStack) < h.callDepth {
+		if len(vm.callStack) > h.callDepth {
+			vm.callStack = vm.callStack[:h.callDepth]
+		}
+		if len(vm.stack) > h.stackDepth {
 			vm.stack = vm.stack[:h.stackDepth]
 		}
 